@@ -8,12 +8,19 @@ import (
 	"os"
 	"time"
 
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/admin"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/email"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/healthcheck"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/sms"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/webhook"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/accesslog"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/graceful"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/content"
 	"github.com/go-ozzo/ozzo-routing/v2/cors"
@@ -37,48 +44,151 @@ func main() {
 		os.Exit(-1)
 	}
 
+	// set up distributed tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, "notification-service", Version)
+	if err != nil {
+		logger.Errorf("failed to set up tracing: %s", err)
+		os.Exit(-1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error(err)
+		}
+	}()
+
 	// create notification storage and service
-	storage := notification.NewInMemoryStorage(logger)
-	notificationService := notification.NewService(storage, logger, *cfg)
+	storage, err := notification.NewStorage(cfg.Storage, logger)
+	if err != nil {
+		logger.Errorf("failed to create notification storage: %s", err)
+		os.Exit(-1)
+	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			logger.Error(err)
+		}
+	}()
+	// every circuit breaker is registered by name so that it can be inspected and controlled through the admin API
+	breakers := circuitbreaker.NewRegistry()
+	// messages are rendered from templates, which are checked before the service starts
+	messages, err := notification.LoadMessages(cfg.Messages)
+	if err != nil {
+		logger.Errorf("failed to load notification message templates: %s", err)
+		os.Exit(-1)
+	}
+	notificationService := notification.NewService(storage, breakers, logger, *cfg, messages)
+	// created notifications are delivered to the webhook endpoints registered by the service providers, which are
+	// kept by the storage backend of the notifications
+	webhookStorage, err := webhook.NewStorage(cfg.Storage)
+	if err != nil {
+		logger.Errorf("failed to create webhook storage: %s", err)
+		os.Exit(-1)
+	}
+	defer func() {
+		if err := webhookStorage.Close(); err != nil {
+			logger.Error(err)
+		}
+	}()
+	webhookService := webhook.NewService(webhookStorage, breakers, logger, cfg.Channels.Webhook)
+	notificationService.RegisterChannel(webhookService, cfg.Channels.Webhook)
+	// by email when an email transport is configured
+	emailService, err := newEmailService(cfg.Email, notificationService, logger)
+	if err != nil {
+		logger.Errorf("failed to create email service: %s", err)
+		os.Exit(-1)
+	}
+	if emailService != nil {
+		notificationService.RegisterChannel(emailService, cfg.Channels.Email)
+	}
+	// and by SMS when enabled
+	if cfg.SMS.Enabled {
+		notificationService.RegisterChannel(sms.NewChannel(logger), cfg.Channels.SMS)
+	}
 
-	// start cleanup worker in background
+	// start cleanup, quiet hours release and digest workers in background
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go notificationService.StartCleanupWorker(ctx)
+	go notificationService.StartReleaseWorker(ctx)
+	go notificationService.StartDigestWorker(ctx)
+
+	// readiness checks of the dependencies
+	checks := []healthcheck.Check{
+		{Name: "storage", Critical: true, Run: storage.Ping},
+	}
+	if cb, ok := breakers.Get(notification.CircuitBreakerName); ok {
+		check := healthcheck.CircuitBreakerCheck("storage-circuit-breaker", cb)
+		check.Critical = true
+		checks = append(checks, check)
+	}
+	health := healthcheck.New(Version, checks...)
 
 	// build HTTP server
 	address := fmt.Sprintf(":%d", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
-		Handler: buildHandler(logger, notificationService, Version),
+		Handler: buildHandler(cfg, logger, notificationService, webhookService, emailService, breakers, health),
 	}
 
-	// start the HTTP server with graceful shutdown
-	go func() {
-		defer cancel() // cancel the context to stop background workers when server shuts down
-		routing.GracefulShutdown(hs, 30*time.Second, logger.Infof)
-	}()
+	// start the HTTP server with graceful shutdown; readiness turns false as soon as shutdown starts
+	// and background workers are stopped once the server no longer serves requests
+	server := graceful.New(hs, 30*time.Second, logger.Infof)
+	server.Delay = cfg.ShutdownDelay
+	server.BeforeShutdown(health.Shutdown)
+	// open notification streams never become idle, so they are closed as soon as the server stops accepting requests
+	hs.RegisterOnShutdown(notificationService.CloseSubscriptions)
+	server.OnShutdown(func(context.Context) { cancel() })
+	server.OnShutdown(func(ctx context.Context) {
+		if err := notificationService.Close(ctx); err != nil {
+			logger.Errorf("failed to deliver the queued notifications: %s", err)
+		}
+	})
 	logger.Infof("server %v is running at %v", Version, address)
-	if err := hs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Error(err)
 		os.Exit(-1)
 	}
 }
 
 // buildHandler sets up the HTTP routing and middleware stack.
-func buildHandler(logger log.Logger, notificationService notification.Service, version string) http.Handler {
+func buildHandler(cfg *config.Config, logger log.Logger, notificationService notification.Service, webhookService webhook.Service, emailService email.Service, breakers *circuitbreaker.Registry, health *healthcheck.Health) http.Handler {
 	router := routing.New()
 
 	router.Use(
 		accesslog.Handler(logger),
+		tracing.Handler(),
 		errors.Handler(logger),
 		content.TypeNegotiator(content.JSON),
 		cors.Handler(cors.AllowAll),
 	)
 
-	healthcheck.RegisterHandlers(router, version)
-	notification.RegisterHandlers(router, notificationService, logger)
+	healthcheck.RegisterHandlers(router, health)
+	if cfg.AdminToken != "" {
+		admin.RegisterHandlers(router.Group("/admin"), breakers, cfg.AdminToken, logger)
+	}
+	notification.RegisterHandlers(router, notificationService, cfg.Stream, cfg.ProviderTokenSecret, logger)
+	if cfg.ProviderTokenSecret != "" {
+		webhook.RegisterHandlers(router.Group("/api/webhooks"), webhookService, cfg.ProviderTokenSecret, logger)
+		if emailService != nil {
+			email.RegisterHandlers(router.Group("/api/email-preferences"), emailService, cfg.ProviderTokenSecret, logger)
+		}
+	} else {
+		logger.Warn("provider_token_secret is not set: the notification preferences, webhook, email preferences and WebSocket endpoints are disabled")
+	}
 
 	return router
 }
+
+// newEmailService creates the email service with the configured transport, which keeps its settings in the
+// notification preferences. It returns nil when email notifications are disabled.
+func newEmailService(cfg config.EmailConfig, preferences email.PreferenceStore, logger log.Logger) (email.Service, error) {
+	transport, err := email.NewTransport(cfg)
+	if err != nil || transport == nil {
+		return nil, err
+	}
+	renderer, err := email.NewRenderer()
+	if err != nil {
+		return nil, err
+	}
+	return email.NewService(preferences, transport, renderer, logger, cfg), nil
+}
@@ -0,0 +1,101 @@
+// Package admin provides operational endpoints for inspecting and controlling the service at runtime.
+package admin
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// OperatorHeader is the request header that identifies the operator performing an admin action.
+const OperatorHeader = "X-Operator"
+
+// operatorKey is the routing context key under which the operator identity is stored.
+const operatorKey = "admin.operator"
+
+// CircuitBreaker is the admin representation of a registered circuit breaker.
+type CircuitBreaker struct {
+	Name  string                 `json:"name"`
+	Stats map[string]interface{} `json:"stats"`
+}
+
+// RegisterHandlers sets up the routing of the admin HTTP handlers.
+// All routes require the given bearer token and an X-Operator header identifying the caller.
+func RegisterHandlers(r *routing.RouteGroup, breakers *circuitbreaker.Registry, token string, logger log.Logger) {
+	res := resource{breakers, logger}
+
+	r.Use(authHandler(token))
+
+	r.Get("/circuit-breakers", res.list)
+	r.Get("/circuit-breakers/<name>", res.get)
+	r.Post("/circuit-breakers/<name>/trip", res.control("trip", (*circuitbreaker.CircuitBreaker).Trip))
+	r.Post("/circuit-breakers/<name>/reset", res.control("reset", (*circuitbreaker.CircuitBreaker).Reset))
+	r.Post("/circuit-breakers/<name>/force-close", res.control("force-close", (*circuitbreaker.CircuitBreaker).ForceClose))
+}
+
+// authHandler returns a middleware that authenticates admin requests with a bearer token
+// and records the operator identity for audit logging.
+func authHandler(token string) routing.Handler {
+	return func(c *routing.Context) error {
+		provided, ok := strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return errors.Unauthorized("")
+		}
+		operator := strings.TrimSpace(c.Request.Header.Get(OperatorHeader))
+		if operator == "" {
+			return errors.BadRequest("The " + OperatorHeader + " header is required.")
+		}
+		c.Set(operatorKey, operator)
+		return nil
+	}
+}
+
+type resource struct {
+	breakers *circuitbreaker.Registry
+	logger   log.Logger
+}
+
+func (r resource) list(c *routing.Context) error {
+	names := r.breakers.Names()
+	items := make([]CircuitBreaker, 0, len(names))
+	for _, name := range names {
+		if cb, ok := r.breakers.Get(name); ok {
+			items = append(items, CircuitBreaker{Name: name, Stats: cb.GetStats()})
+		}
+	}
+	return c.Write(items)
+}
+
+func (r resource) get(c *routing.Context) error {
+	name := c.Param("name")
+	cb, ok := r.breakers.Get(name)
+	if !ok {
+		return errors.NotFound("")
+	}
+	return c.Write(CircuitBreaker{Name: name, Stats: cb.GetStats()})
+}
+
+// control returns a handler that applies the given manual action to a circuit breaker and logs it with the operator identity.
+func (r resource) control(action string, apply func(*circuitbreaker.CircuitBreaker)) routing.Handler {
+	return func(c *routing.Context) error {
+		name := c.Param("name")
+		cb, ok := r.breakers.Get(name)
+		if !ok {
+			return errors.NotFound("")
+		}
+		before := cb.GetState()
+		apply(cb)
+		r.logger.With(c.Request.Context(),
+			"operator", c.Get(operatorKey),
+			"circuit_breaker", name,
+			"action", action,
+			"previous_state", before.String(),
+			"state", cb.GetState().String(),
+		).Info("Circuit breaker state changed by operator")
+		return c.Write(CircuitBreaker{Name: name, Stats: cb.GetStats()})
+	}
+}
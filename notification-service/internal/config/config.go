@@ -7,7 +7,9 @@ import (
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/qiangxue/go-env"
 	"gopkg.in/yaml.v2"
 )
@@ -16,6 +18,20 @@ const (
 	defaultServerPort = 8081
 )
 
+const (
+	// StorageMemory keeps notifications in memory. They are lost when the service restarts.
+	StorageMemory = "memory"
+	// StorageBolt keeps notifications in an embedded bbolt database file.
+	StorageBolt = "bolt"
+)
+
+const (
+	// EmailSMTP sends email notifications through an SMTP server.
+	EmailSMTP = "smtp"
+	// EmailFile writes email notifications as .eml files into a directory, which is useful in development.
+	EmailFile = "file"
+)
+
 // Config represents an application configuration.
 type Config struct {
 	// the server port. Defaults to 8081
@@ -29,6 +45,40 @@ type Config struct {
 
 	// notification cleanup configuration
 	Cleanup CleanupConfig `yaml:"cleanup" env:"CLEANUP"`
+
+	// notification storage configuration
+	Storage StorageConfig `yaml:"storage" env:"STORAGE"`
+
+	// live notification stream configuration
+	Stream StreamConfig `yaml:"stream" env:"STREAM"`
+
+	// coalescing of bursts of ratings
+	Coalescing CoalescingConfig `yaml:"coalescing" env:"COALESCING"`
+
+	// notification message templates
+	Messages MessagesConfig `yaml:"messages" env:"MESSAGES"`
+
+	// delivery settings of the notification channels
+	Channels ChannelsConfig `yaml:"channels" env:"CHANNELS"`
+
+	// email notification configuration. It is loaded with its SMTP password, hence masked in the logs.
+	Email EmailConfig `yaml:"email" env:"EMAIL,secret"`
+
+	// SMS notification configuration
+	SMS SMSConfig `yaml:"sms" env:"SMS"`
+
+	// distributed tracing configuration
+	Tracing tracing.Config `yaml:"tracing" env:"TRACING"`
+
+	// time to keep serving after readiness turns false on shutdown, so load balancers can drain the instance
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	// bearer token protecting the admin API. The admin API is disabled when empty.
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN,secret"`
+	// secret verifying the provider tokens, of at least 32 characters. The endpoints which require a provider token
+	// are disabled when empty: the notification preferences (/api/notifications/<id>/preferences), the webhooks
+	// (/api/webhooks), the email preferences (/api/email-preferences) and the WebSocket endpoint
+	// (/api/notifications/<id>/ws).
+	ProviderTokenSecret string `yaml:"provider_token_secret" env:"PROVIDER_TOKEN_SECRET,secret"`
 }
 
 // CleanupConfig represents notification cleanup configuration
@@ -45,6 +95,159 @@ func (c CleanupConfig) Validate() error {
 	)
 }
 
+// StorageConfig represents notification storage configuration
+type StorageConfig struct {
+	// the storage backend: "memory" (default) or "bolt"
+	Backend string `yaml:"backend" json:"backend"`
+	// the database file of the bolt backend
+	Path string `yaml:"path" json:"path"`
+	// the database file of the webhook subscriptions and their deliveries with the bolt backend. Defaults to
+	// webhooks.db in the directory of Path
+	WebhooksPath string `yaml:"webhooks_path" json:"webhooksPath"`
+}
+
+// Validate validates the storage configuration
+func (c StorageConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Backend, validation.In(StorageMemory, StorageBolt)),
+		validation.Field(&c.Path, validation.When(c.Backend == StorageBolt, validation.Required)),
+	)
+}
+
+// StreamConfig represents the configuration of the live notification streams
+type StreamConfig struct {
+	// the interval of the heartbeats which keep idle connections open
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" json:"heartbeatInterval"`
+	// the maximum number of open streams per service provider
+	MaxConnections int `yaml:"max_connections" json:"maxConnections"`
+	// the number of notifications buffered per stream; a stream which falls further behind is closed
+	BufferSize int `yaml:"buffer_size" json:"bufferSize"`
+}
+
+// Validate validates the stream configuration
+func (c StreamConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.HeartbeatInterval, validation.Min(time.Second)),
+		validation.Field(&c.MaxConnections, validation.Min(0)),
+		validation.Field(&c.BufferSize, validation.Min(0)),
+	)
+}
+
+// CoalescingConfig represents the configuration of the coalescing of bursts of ratings
+type CoalescingConfig struct {
+	// the first rating of a burst is notified right away, and the ratings a service provider receives within the
+	// window after it are merged into a single notification, which is sent up to half the window (at most a minute)
+	// after the window ends and opens the next window. 0 (default) disables coalescing.
+	Window time.Duration `yaml:"window" json:"window"`
+}
+
+// Validate validates the coalescing configuration
+func (c CoalescingConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Window, validation.Min(0), validation.Max(time.Hour)),
+	)
+}
+
+// MessagesConfig represents the configuration of the notification message templates
+type MessagesConfig struct {
+	// the directory with message templates named "<locale>/<event type>.tmpl", which add locales to the built-in
+	// English templates or override them. Only the built-in templates are used when empty.
+	Dir string `yaml:"dir" json:"dir"`
+	// the locale of the messages of service providers without a locale preference or with a locale without
+	// templates. Defaults to "en"
+	DefaultLocale string `yaml:"default_locale" json:"defaultLocale"`
+}
+
+// ChannelsConfig represents the delivery settings of the notification channels
+type ChannelsConfig struct {
+	InApp   ChannelConfig `yaml:"in_app" json:"inApp"`
+	Webhook ChannelConfig `yaml:"webhook" json:"webhook"`
+	Email   ChannelConfig `yaml:"email" json:"email"`
+	SMS     ChannelConfig `yaml:"sms" json:"sms"`
+}
+
+// Validate validates the channel configurations
+func (c ChannelsConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.InApp),
+		validation.Field(&c.Webhook),
+		validation.Field(&c.Email),
+		validation.Field(&c.SMS),
+	)
+}
+
+// ChannelConfig represents the delivery settings of a notification channel
+type ChannelConfig struct {
+	// the number of notifications sent concurrently. Defaults to 1
+	Workers int `yaml:"workers" json:"workers"`
+	// the number of notifications waiting for a worker; notifications which do not fit fail. Defaults to 1000
+	QueueSize int `yaml:"queue_size" json:"queueSize"`
+	// the timeout of a single attempt. Defaults to 10s
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+	// retry configuration of the attempts
+	Retry retry.RetryConfig `yaml:"retry" json:"retry"`
+	// circuit breaker configuration of the channel; the webhook channel has a circuit breaker per endpoint instead
+	CircuitBreaker circuitbreaker.Config `yaml:"circuit_breaker" json:"circuitBreaker"`
+}
+
+// Validate validates the channel configuration. Settings which are not given use their defaults.
+func (c ChannelConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Workers, validation.Min(0)),
+		validation.Field(&c.QueueSize, validation.Min(0)),
+		validation.Field(&c.Timeout, validation.Min(0)),
+		validation.Field(&c.Retry, validation.Skip.When(c.Retry.MaxAttempts == 0)),
+		validation.Field(&c.CircuitBreaker, validation.Skip.When(c.CircuitBreaker == (circuitbreaker.Config{}))),
+	)
+}
+
+// SMSConfig represents the configuration of the SMS notifications
+type SMSConfig struct {
+	// whether notifications are sent by SMS. Only a stub transport which logs the messages exists so far.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+// EmailConfig represents the configuration of the email notifications
+type EmailConfig struct {
+	// the transport sending the emails: "smtp", "file", or empty to disable email notifications
+	Transport string `yaml:"transport" json:"transport"`
+	// the sender address
+	From string `yaml:"from" json:"from"`
+	// the SMTP server of the smtp transport
+	SMTP SMTPConfig `yaml:"smtp" json:"smtp"`
+	// the directory the file transport writes the emails to
+	OutboxDir string `yaml:"outbox_dir" json:"outboxDir"`
+}
+
+// SMTPConfig represents the connection settings of an SMTP server. STARTTLS is used when the server supports it.
+type SMTPConfig struct {
+	Host string `yaml:"host" json:"host"`
+	// the server port. Defaults to 587
+	Port     int    `yaml:"port" json:"port"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+}
+
+// Validate validates the email configuration. Settings which are not given use their defaults.
+func (c EmailConfig) Validate() error {
+	enabled := c.Transport != ""
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Transport, validation.In(EmailSMTP, EmailFile)),
+		validation.Field(&c.From, validation.When(enabled, validation.Required, is.EmailFormat)),
+		validation.Field(&c.SMTP, validation.Skip.When(c.Transport != EmailSMTP)),
+		validation.Field(&c.OutboxDir, validation.When(c.Transport == EmailFile, validation.Required)),
+	)
+}
+
+// Validate validates the SMTP configuration
+func (c SMTPConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Host, validation.Required, is.Host),
+		validation.Field(&c.Port, validation.Min(0), validation.Max(65535)),
+		validation.Field(&c.Password, validation.When(c.Username != "", validation.Required)),
+	)
+}
+
 // Validate validates the application configuration.
 func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
@@ -52,9 +255,27 @@ func (c Config) Validate() error {
 		validation.Field(&c.Retry, validation.Required),
 		validation.Field(&c.CircuitBreaker, validation.Required),
 		validation.Field(&c.Cleanup, validation.Required),
+		validation.Field(&c.Storage),
+		validation.Field(&c.Stream),
+		validation.Field(&c.Coalescing),
+		validation.Field(&c.Channels),
+		validation.Field(&c.Email),
+		validation.Field(&c.Tracing),
+		validation.Field(&c.ProviderTokenSecret, validation.Length(32, 0)),
 	)
 }
 
+// defaultChannelConfig returns the default delivery settings of a channel with the given workers and timeout.
+func defaultChannelConfig(workers int, timeout time.Duration) ChannelConfig {
+	return ChannelConfig{
+		Workers:        workers,
+		QueueSize:      1000,
+		Timeout:        timeout,
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+}
+
 // Load returns an application configuration which is populated from the given configuration file and environment variables.
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
@@ -66,6 +287,27 @@ func Load(file string, logger log.Logger) (*Config, error) {
 			Interval: 5 * time.Minute,
 			MaxAge:   1 * time.Hour,
 		},
+		Storage: StorageConfig{
+			Backend: StorageMemory,
+		},
+		Stream: StreamConfig{
+			HeartbeatInterval: 15 * time.Second,
+			MaxConnections:    5,
+			BufferSize:        64,
+		},
+		Messages: MessagesConfig{
+			DefaultLocale: "en",
+		},
+		Channels: ChannelsConfig{
+			InApp:   defaultChannelConfig(1, 5*time.Second),
+			Webhook: defaultChannelConfig(4, 10*time.Second),
+			Email:   defaultChannelConfig(2, 30*time.Second),
+			SMS:     defaultChannelConfig(1, 10*time.Second),
+		},
+		Email: EmailConfig{
+			SMTP: SMTPConfig{Port: 587},
+		},
+		Tracing: tracing.DefaultConfig(),
 	}
 
 	// load from YAML config file
@@ -25,6 +25,8 @@ func TestConfigLoad(t *testing.T) {
 	assert.NotNil(t, config.Retry)
 	assert.NotNil(t, config.CircuitBreaker)
 	assert.NotNil(t, config.Cleanup)
+	assert.Equal(t, "./config/messages", config.Messages.Dir)
+	assert.Equal(t, "en", config.Messages.DefaultLocale)
 }
 
 func TestConfigLoadWithEnvironmentVariables(t *testing.T) {
@@ -81,6 +83,48 @@ func TestConfigValidation(t *testing.T) {
 			},
 			hasErr: false,
 		},
+		{
+			name: "short provider token secret",
+			config: Config{
+				ServerPort:     8081,
+				Retry:          retry.DefaultRetryConfig(),
+				CircuitBreaker: circuitbreaker.DefaultConfig(),
+				Cleanup: CleanupConfig{
+					Interval: 5 * time.Minute,
+					MaxAge:   1 * time.Hour,
+				},
+				ProviderTokenSecret: "secret",
+			},
+			hasErr: true,
+		},
+		{
+			name: "smtp email without host",
+			config: Config{
+				ServerPort:     8081,
+				Retry:          retry.DefaultRetryConfig(),
+				CircuitBreaker: circuitbreaker.DefaultConfig(),
+				Cleanup: CleanupConfig{
+					Interval: 5 * time.Minute,
+					MaxAge:   1 * time.Hour,
+				},
+				Email: EmailConfig{Transport: EmailSMTP, From: "notifications@homerun.example"},
+			},
+			hasErr: true,
+		},
+		{
+			name: "negative coalescing window",
+			config: Config{
+				ServerPort:     8081,
+				Retry:          retry.DefaultRetryConfig(),
+				CircuitBreaker: circuitbreaker.DefaultConfig(),
+				Cleanup: CleanupConfig{
+					Interval: 5 * time.Minute,
+					MaxAge:   1 * time.Hour,
+				},
+				Coalescing: CoalescingConfig{Window: -time.Second},
+			},
+			hasErr: true,
+		},
 		{
 			name: "invalid server port",
 			config: Config{
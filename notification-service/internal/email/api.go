@@ -0,0 +1,56 @@
+package email
+
+import (
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// RegisterHandlers sets up the routing of the email preference HTTP handlers.
+// All routes require a provider token of the service provider in the path, see notification.SignProviderToken.
+func RegisterHandlers(r *routing.RouteGroup, service Service, tokenSecret string, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(notification.ProviderAuthHandler(tokenSecret))
+
+	r.Get("/<serviceProviderId>", res.get)
+	r.Put("/<serviceProviderId>", res.update)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// get handles GET /api/email-preferences/{serviceProviderId}
+func (r resource) get(c *routing.Context) error {
+	preference, err := r.service.GetPreference(c.Request.Context(), c.Param("serviceProviderId"))
+	if err != nil {
+		return err
+	}
+	return c.Write(preference)
+}
+
+// update handles PUT /api/email-preferences/{serviceProviderId}
+func (r resource) update(c *routing.Context) error {
+	var req UpdatePreferenceRequest
+	if err := c.Read(&req); err != nil {
+		r.logger.With(c.Request.Context(), "error", err).Error("Failed to parse email preference request")
+		return errors.BadRequest("Invalid request format")
+	}
+	if err := validation.ValidateStruct(&req,
+		validation.Field(&req.Enabled, validation.NotNil),
+		validation.Field(&req.Address, validation.Length(0, 254), is.EmailFormat),
+	); err != nil {
+		return err
+	}
+
+	preference, err := r.service.UpdatePreference(c.Request.Context(), c.Param("serviceProviderId"), req)
+	if err != nil {
+		return err
+	}
+	return c.Write(preference)
+}
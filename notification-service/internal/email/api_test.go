@@ -0,0 +1,39 @@
+package email
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/test"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	RegisterHandlers(router.Group("/api/email-preferences"), newTestService(t, &fakeTransport{}), secret, logger)
+
+	header := func(serviceProviderID string) http.Header {
+		h := http.Header{}
+		h.Set("Authorization", "Bearer "+notification.SignProviderToken(secret, serviceProviderID, time.Now().Add(time.Minute)))
+		return h
+	}
+	url := "/api/email-preferences/" + serviceProviderID
+
+	tests := []test.APITestCase{
+		{Name: "missing token", Method: "GET", URL: url, WantStatus: http.StatusUnauthorized},
+		{Name: "token of another service provider", Method: "PUT", URL: url, Body: `{"enabled":false}`, Header: header("other"), WantStatus: http.StatusUnauthorized},
+		{Name: "get defaults", Method: "GET", URL: url, Header: header(serviceProviderID), WantStatus: http.StatusOK, WantResponse: `*"enabled":true*`},
+		{Name: "update", Method: "PUT", URL: url, Body: `{"enabled":false,"address":"office@example.com"}`, Header: header(serviceProviderID), WantStatus: http.StatusOK, WantResponse: `*"address":"office@example.com"*`},
+		{Name: "get updated", Method: "GET", URL: url, Header: header(serviceProviderID), WantStatus: http.StatusOK, WantResponse: `*"enabled":false*`},
+		{Name: "update without enabled", Method: "PUT", URL: url, Body: `{"address":"office@example.com"}`, Header: header(serviceProviderID), WantStatus: http.StatusBadRequest},
+		{Name: "update with invalid address", Method: "PUT", URL: url, Body: `{"enabled":true,"address":"office"}`, Header: header(serviceProviderID), WantStatus: http.StatusBadRequest},
+		{Name: "update with invalid body", Method: "PUT", URL: url, Body: `{`, Header: header(serviceProviderID), WantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
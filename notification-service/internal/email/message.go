@@ -0,0 +1,80 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message represents an email with a plain text body and an optional HTML alternative.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Bytes formats the message as a MIME email dated at the given time, ready to be handed to an SMTP server.
+// Bodies are quoted-printable encoded and the subject is encoded when it contains non-ASCII characters or line breaks,
+// so the message content cannot inject headers.
+func (m Message) Bytes(date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	header := []string{
+		"From: " + (&mail.Address{Address: m.From}).String(),
+		"To: " + (&mail.Address{Address: m.To}).String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date: " + date.Format(time.RFC1123Z),
+		"Message-ID: " + fmt.Sprintf("<%s@%s>", uuid.New().String(), domain(m.From)),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + body.Boundary(),
+	}
+	buf.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	if err := writePart(body, "text/plain", m.Text); err != nil {
+		return nil, err
+	}
+	if m.HTML != "" {
+		if err := writePart(body, "text/html", m.HTML); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writePart writes a quoted-printable encoded UTF-8 part of the given content type.
+func writePart(body *multipart.Writer, contentType, content string) error {
+	part, err := body.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	w := quotedprintable.NewWriter(part)
+	if _, err := w.Write([]byte(content)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// domain returns the domain of an email address, which identifies the sender in message IDs.
+func domain(address string) string {
+	if _, host, ok := strings.Cut(address, "@"); ok && host != "" {
+		return host
+	}
+	return "localhost"
+}
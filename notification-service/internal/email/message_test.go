@@ -0,0 +1,61 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	msg := Message{
+		From:    "notifications@homerun.example",
+		To:      "provider@example.com",
+		Subject: "Neue Bewertung von Jürgen\r\nBcc: attacker@example.com",
+		Text:    "5 stars – great work",
+		HTML:    "<p>5 stars</p>",
+	}
+	data, err := msg.Bytes(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "<notifications@homerun.example>", parsed.Header.Get("From"))
+	assert.Equal(t, "<provider@example.com>", parsed.Header.Get("To"))
+	assert.Empty(t, parsed.Header.Get("Bcc"), "the subject cannot inject headers")
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Subject, subject)
+	assert.Contains(t, parsed.Header.Get("Message-ID"), "@homerun.example>")
+	date, err := parsed.Header.Date()
+	require.NoError(t, err)
+	assert.True(t, date.Equal(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, "quoted-printable", part.Header.Get("Content-Transfer-Encoding"))
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		require.NoError(t, err)
+		bodies = append(bodies, part.Header.Get("Content-Type")+": "+string(body))
+	}
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8: 5 stars – great work",
+		"text/html; charset=utf-8: <p>5 stars</p>",
+	}, bodies)
+}
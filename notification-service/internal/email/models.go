@@ -0,0 +1,21 @@
+// Package email sends the notifications of service providers by email.
+package email
+
+import "time"
+
+// Preference represents the email settings of a service provider. Emails are sent to the address given by the rating
+// service unless the service provider chose another one. The settings are part of the notification preferences: Enabled
+// is the email channel of notification.Preferences and Address is its EmailAddress.
+type Preference struct {
+	ServiceProviderID string    `json:"serviceProviderId"`
+	Enabled           bool      `json:"enabled"`
+	Address           string    `json:"address,omitempty"`
+	UpdatedAt         time.Time `json:"updatedAt,omitempty"`
+}
+
+// UpdatePreferenceRequest represents a request replacing the email settings of a service provider.
+// An empty address restores the address given by the rating service.
+type UpdatePreferenceRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Address string `json:"address"`
+}
@@ -0,0 +1,164 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("github.com/berkaykrc/homerun-ratings-system/notification-service/internal/email")
+
+// Service manages the email preferences of the service providers and emails their notifications.
+// It is the email notification.Channel.
+type Service interface {
+	// GetPreference returns the email preferences of a service provider.
+	GetPreference(ctx context.Context, serviceProviderID string) (Preference, error)
+	UpdatePreference(ctx context.Context, serviceProviderID string, req UpdatePreferenceRequest) (Preference, error)
+	Name() string
+	// Send emails a notification unless its service provider disabled emails or has no address.
+	Send(ctx context.Context, notification notification.Notification) error
+}
+
+// PreferenceStore represents the store of the notification preferences, which hold the email settings as well.
+// It is implemented by notification.Service.
+type PreferenceStore interface {
+	GetPreferences(ctx context.Context, serviceProviderID string) (*notification.Preferences, error)
+	SavePreferences(ctx context.Context, preferences notification.Preferences) (*notification.Preferences, error)
+}
+
+// service implements the Service interface
+type service struct {
+	preferences PreferenceStore
+	transport   Transport
+	renderer    *Renderer
+	config      config.EmailConfig
+	logger      log.Logger
+}
+
+// NewService creates an email service which keeps its settings in the given preference store and sends through the
+// given transport.
+func NewService(preferences PreferenceStore, transport Transport, renderer *Renderer, logger log.Logger, cfg config.EmailConfig) Service {
+	return &service{
+		preferences: preferences,
+		transport:   transport,
+		renderer:    renderer,
+		config:      cfg,
+		logger:      logger,
+	}
+}
+
+// GetPreference returns the email settings of a service provider from its notification preferences
+func (s *service) GetPreference(ctx context.Context, serviceProviderID string) (Preference, error) {
+	preferences, err := s.preferences.GetPreferences(ctx, serviceProviderID)
+	if err != nil {
+		return Preference{}, fmt.Errorf("failed to get email preferences: %w", err)
+	}
+	return newPreference(*preferences), nil
+}
+
+// UpdatePreference replaces the email settings of a service provider and keeps its other notification preferences
+func (s *service) UpdatePreference(ctx context.Context, serviceProviderID string, req UpdatePreferenceRequest) (Preference, error) {
+	preferences, err := s.preferences.GetPreferences(ctx, serviceProviderID)
+	if err != nil {
+		return Preference{}, fmt.Errorf("failed to get email preferences: %w", err)
+	}
+
+	updated := *preferences
+	// the stored preferences may be shared, so the channels are copied before they are changed
+	updated.Channels = make(map[string]bool, len(preferences.Channels)+1)
+	for channel, enabled := range preferences.Channels {
+		updated.Channels[channel] = enabled
+	}
+	updated.Channels[notification.ChannelEmail] = *req.Enabled
+	updated.EmailAddress = req.Address
+
+	saved, err := s.preferences.SavePreferences(ctx, updated)
+	if err != nil {
+		return Preference{}, fmt.Errorf("failed to save email preferences: %w", err)
+	}
+
+	preference := newPreference(*saved)
+	s.logger.With(ctx, "service_provider_id", serviceProviderID, "enabled", preference.Enabled).
+		Info("Updated email preferences")
+	return preference, nil
+}
+
+// newPreference returns the email settings held by the notification preferences of a service provider.
+func newPreference(preferences notification.Preferences) Preference {
+	return Preference{
+		ServiceProviderID: preferences.ServiceProviderID,
+		Enabled:           preferences.ChannelEnabled(notification.ChannelEmail),
+		Address:           preferences.EmailAddress,
+		UpdatedAt:         preferences.UpdatedAt,
+	}
+}
+
+// Name returns the channel name
+func (s *service) Name() string {
+	return notification.ChannelEmail
+}
+
+// Send renders the email of a notification and sends it. Failures which retrying cannot fix are permanent.
+func (s *service) Send(ctx context.Context, n notification.Notification) error {
+	preference, err := s.GetPreference(ctx, n.ServiceProviderID)
+	if err != nil {
+		return err
+	}
+	if !preference.Enabled {
+		return fmt.Errorf("%w: email notifications are disabled", notification.ErrChannelSkipped)
+	}
+	to := preference.Address
+	if to == "" {
+		to = n.ServiceProviderEmail
+	}
+	if to == "" {
+		return fmt.Errorf("%w: no email address", notification.ErrChannelSkipped)
+	}
+
+	subject, text, html, err := s.renderer.Render(n)
+	if err != nil {
+		return notification.Permanent(fmt.Errorf("failed to render email: %w", err))
+	}
+	msg := Message{From: s.config.From, To: to, Subject: subject, Text: text, HTML: html}
+
+	ctx, span := tracer.Start(ctx, "email.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("notification.id", n.ID)),
+	)
+	err = s.transport.Send(ctx, msg)
+	tracing.End(span, err)
+	if err != nil {
+		if !isRetryableError(err) {
+			return notification.Permanent(err)
+		}
+		return err
+	}
+
+	s.logger.With(ctx, "service_provider_id", n.ServiceProviderID, "notification_id", n.ID).Info("Sent email")
+	return nil
+}
+
+// isRetryableError determines if a failed send attempt can be retried
+func isRetryableError(err error) bool {
+	// SMTP servers reply with 4xx codes to transient failures and 5xx codes to permanent ones
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code < 500
+	}
+
+	// Retry on timeouts and network errors such as refused connections or DNS failures
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
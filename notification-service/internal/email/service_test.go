@@ -0,0 +1,253 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const serviceProviderID = "123e4567-e89b-12d3-a456-426614174000"
+
+// fakeTransport records the emails it is asked to send and fails with the given errors in turn.
+type fakeTransport struct {
+	mu       sync.Mutex
+	errs     []error
+	attempts int
+	sent     []Message
+}
+
+func (t *fakeTransport) Send(ctx context.Context, msg Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.attempts++
+	if len(t.errs) > 0 {
+		err := t.errs[0]
+		t.errs = t.errs[1:]
+		return err
+	}
+	t.sent = append(t.sent, msg)
+	return nil
+}
+
+func (t *fakeTransport) messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Message(nil), t.sent...)
+}
+
+// fakePreferenceStore keeps the notification preferences in memory. Service providers without stored preferences have
+// the defaults.
+type fakePreferenceStore struct {
+	mu          sync.Mutex
+	preferences map[string]notification.Preferences
+}
+
+func (f *fakePreferenceStore) GetPreferences(ctx context.Context, serviceProviderID string) (*notification.Preferences, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	preferences, ok := f.preferences[serviceProviderID]
+	if !ok {
+		preferences = notification.Preferences{ServiceProviderID: serviceProviderID, Channels: map[string]bool{}, Events: map[string]bool{}}
+	}
+	return &preferences, nil
+}
+
+func (f *fakePreferenceStore) SavePreferences(ctx context.Context, preferences notification.Preferences) (*notification.Preferences, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	preferences.UpdatedAt = time.Now()
+	f.preferences[preferences.ServiceProviderID] = preferences
+	return &preferences, nil
+}
+
+func newTestService(t *testing.T, transport Transport) Service {
+	return newTestServiceWithStore(t, transport, &fakePreferenceStore{preferences: map[string]notification.Preferences{}})
+}
+
+func newTestServiceWithStore(t *testing.T, transport Transport, store PreferenceStore) Service {
+	logger, _ := log.NewForTest()
+	renderer, err := NewRenderer()
+	require.NoError(t, err)
+	return NewService(store, transport, renderer, logger, config.EmailConfig{
+		From: "notifications@homerun.example",
+	})
+}
+
+func testNotification(email string) notification.Notification {
+	return notification.NewNotification(notification.RatingNotificationRequest{
+		ServiceProviderID:    serviceProviderID,
+		ServiceProviderEmail: email,
+		RatingID:             "456e7890-e89b-12d3-a456-426614174001",
+		Rating:               5,
+		CustomerName:         "Jane",
+		Comment:              "Great <work>",
+	})
+}
+
+func TestRenderer_Render(t *testing.T) {
+	renderer, err := NewRenderer()
+	require.NoError(t, err)
+
+	subject, text, html, err := renderer.Render(testNotification(""))
+	require.NoError(t, err)
+	assert.Equal(t, `New 5-star rating received from Jane: "Great <work>"`, subject)
+	assert.Contains(t, text, `New 5-star rating received from Jane: "Great <work>"`)
+	assert.Contains(t, text, "456e7890-e89b-12d3-a456-426614174001")
+	assert.Contains(t, html, "Great &lt;work&gt;", "the HTML body escapes the notification")
+
+	_, _, _, err = renderer.Render(notification.Notification{Type: "rating.deleted"})
+	assert.ErrorIs(t, err, ErrNoTemplate)
+}
+
+func TestRenderer_RenderCoalesced(t *testing.T) {
+	renderer, err := NewRenderer()
+	require.NoError(t, err)
+
+	n := testNotification("")
+	n.RatingID = ""
+	n.RatingIDs = []string{"r-1", "r-2"}
+	n.Message = "2 new ratings, average 4.5"
+	subject, text, html, err := renderer.Render(n)
+	require.NoError(t, err)
+	assert.Equal(t, "2 new ratings, average 4.5", subject)
+	assert.Contains(t, text, "Ratings:\n- r-1\n- r-2\nReceived:")
+	assert.Contains(t, html, "Ratings: r-1, r-2<br>")
+}
+
+func TestRenderer_RenderDigest(t *testing.T) {
+	renderer, err := NewRenderer()
+	require.NoError(t, err)
+
+	periodEnd := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	n := notification.Notification{
+		ServiceProviderID: serviceProviderID,
+		Type:              notification.EventRatingDigest,
+		Message:           "Daily digest: 2 new ratings, 3.5 stars on average",
+		Digest: &notification.Digest{
+			Frequency:     notification.DigestDaily,
+			PeriodStart:   periodEnd.AddDate(0, 0, -1),
+			PeriodEnd:     periodEnd,
+			Count:         2,
+			AverageRating: 3.5,
+			LowestRatings: []notification.DigestEntry{
+				{RatingID: "r-1", Rating: 2, CustomerName: "Jane", Comment: "Late <again>"},
+				{RatingID: "r-2", Rating: 5},
+			},
+		},
+	}
+	subject, text, html, err := renderer.Render(n)
+	require.NoError(t, err)
+	assert.Equal(t, "Daily digest: 2 new ratings, 3.5 stars on average", subject)
+	assert.Contains(t, text, "Average: 3.5 stars")
+	assert.Contains(t, text, `- 2 stars from Jane: "Late <again>"`)
+	assert.Contains(t, text, "- 5 stars\n")
+	assert.Contains(t, html, "Late &lt;again&gt;", "the HTML body escapes the comments")
+}
+
+func TestService_Send(t *testing.T) {
+	transport := &fakeTransport{}
+	s := newTestService(t, transport)
+	ctx := context.Background()
+	assert.Equal(t, notification.ChannelEmail, s.Name())
+
+	require.NoError(t, s.Send(ctx, testNotification("provider@example.com")))
+	err := s.Send(ctx, testNotification(""))
+	assert.ErrorIs(t, err, notification.ErrChannelSkipped, "notifications without an address are not emailed")
+
+	sent := transport.messages()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "notifications@homerun.example", sent[0].From)
+	assert.Equal(t, "provider@example.com", sent[0].To)
+	assert.Contains(t, sent[0].Subject, "New 5-star rating received")
+	assert.NotEmpty(t, sent[0].Text)
+	assert.NotEmpty(t, sent[0].HTML)
+}
+
+func TestService_Preferences(t *testing.T) {
+	transport := &fakeTransport{}
+	s := newTestService(t, transport)
+	ctx := context.Background()
+
+	preference, err := s.GetPreference(ctx, serviceProviderID)
+	require.NoError(t, err)
+	assert.True(t, preference.Enabled, "emails are enabled by default")
+
+	enabled := true
+	preference, err = s.UpdatePreference(ctx, serviceProviderID, UpdatePreferenceRequest{Enabled: &enabled, Address: "office@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "office@example.com", preference.Address)
+	require.NoError(t, s.Send(ctx, testNotification("provider@example.com")))
+
+	enabled = false
+	_, err = s.UpdatePreference(ctx, serviceProviderID, UpdatePreferenceRequest{Enabled: &enabled})
+	require.NoError(t, err)
+	err = s.Send(ctx, testNotification("provider@example.com"))
+	assert.ErrorIs(t, err, notification.ErrChannelSkipped, "disabled emails are not sent")
+
+	sent := transport.messages()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "office@example.com", sent[0].To, "the chosen address overrides the one of the rating service")
+}
+
+func TestService_PreferencesAreNotificationPreferences(t *testing.T) {
+	store := &fakePreferenceStore{preferences: map[string]notification.Preferences{
+		serviceProviderID: {
+			ServiceProviderID: serviceProviderID,
+			MinRating:         3,
+			Channels:          map[string]bool{notification.ChannelEmail: false, notification.ChannelWebhook: false},
+			EmailAddress:      "office@example.com",
+		},
+	}}
+	s := newTestServiceWithStore(t, &fakeTransport{}, store)
+	ctx := context.Background()
+
+	preference, err := s.GetPreference(ctx, serviceProviderID)
+	require.NoError(t, err)
+	assert.False(t, preference.Enabled, "the email channel of the notification preferences is the switch")
+	assert.Equal(t, "office@example.com", preference.Address)
+
+	enabled := true
+	_, err = s.UpdatePreference(ctx, serviceProviderID, UpdatePreferenceRequest{Enabled: &enabled})
+	require.NoError(t, err)
+	preferences, err := store.GetPreferences(ctx, serviceProviderID)
+	require.NoError(t, err)
+	assert.True(t, preferences.Channels[notification.ChannelEmail])
+	assert.Empty(t, preferences.EmailAddress)
+	assert.False(t, preferences.Channels[notification.ChannelWebhook], "the other channels are kept")
+	assert.Equal(t, 3, preferences.MinRating, "the other preferences are kept")
+}
+
+func TestService_SendFailures(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantPermanent bool
+	}{
+		{"transient failure", &textproto.Error{Code: 421, Msg: "Try again later"}, false},
+		{"permanent failure", &textproto.Error{Code: 550, Msg: "No such user"}, true},
+		{"timeout", context.DeadlineExceeded, false},
+		{"unknown failure", errors.New("broken pipe"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &fakeTransport{errs: []error{tt.err}}
+			s := newTestService(t, transport)
+
+			err := s.Send(context.Background(), testNotification("provider@example.com"))
+			require.ErrorIs(t, err, tt.err)
+			var permanentErr *notification.PermanentError
+			assert.Equal(t, tt.wantPermanent, errors.As(err, &permanentErr))
+			assert.Equal(t, 1, transport.attempts)
+			assert.Empty(t, transport.messages())
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+)
+
+// ErrNoTemplate is returned when rendering a notification whose event type has no email templates.
+var ErrNoTemplate = errors.New("no email template for the event type")
+
+// templateFS holds the email templates. Every event type has a subject, a plain text and an HTML template named
+// "<event type>.subject.tmpl", "<event type>.txt.tmpl" and "<event type>.html.tmpl", rendered with the notification.
+//
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Renderer renders the emails of notifications.
+type Renderer struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// NewRenderer parses the embedded email templates.
+func NewRenderer() (*Renderer, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/*.subject.tmpl", "templates/*.txt.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmltemplate.ParseFS(templateFS, "templates/*.html.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{text: text, html: html}, nil
+}
+
+// Render returns the subject and the plain text and HTML bodies of the email of a notification.
+func (r *Renderer) Render(n notification.Notification) (subject, text, html string, err error) {
+	subjectTmpl := r.text.Lookup(n.Type + ".subject.tmpl")
+	textTmpl := r.text.Lookup(n.Type + ".txt.tmpl")
+	htmlTmpl := r.html.Lookup(n.Type + ".html.tmpl")
+	if subjectTmpl == nil || textTmpl == nil || htmlTmpl == nil {
+		return "", "", "", ErrNoTemplate
+	}
+
+	var buf bytes.Buffer
+	if err := subjectTmpl.Execute(&buf, n); err != nil {
+		return "", "", "", err
+	}
+	// a subject is a single line
+	subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := textTmpl.Execute(&buf, n); err != nil {
+		return "", "", "", err
+	}
+	text = buf.String()
+
+	buf.Reset()
+	if err := htmlTmpl.Execute(&buf, n); err != nil {
+		return "", "", "", err
+	}
+	html = buf.String()
+
+	return subject, text, html, nil
+}
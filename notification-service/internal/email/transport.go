@@ -0,0 +1,142 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+)
+
+// Transport sends email messages.
+type Transport interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewTransport creates the transport selected by the configuration. It returns nil when email notifications are
+// disabled.
+func NewTransport(cfg config.EmailConfig) (Transport, error) {
+	switch cfg.Transport {
+	case "":
+		return nil, nil
+	case config.EmailSMTP:
+		return NewSMTPTransport(cfg.SMTP), nil
+	case config.EmailFile:
+		return NewFileTransport(cfg.OutboxDir)
+	default:
+		return nil, fmt.Errorf("unknown email transport %q", cfg.Transport)
+	}
+}
+
+// smtpTransport sends emails through an SMTP server, opening a connection per email.
+type smtpTransport struct {
+	cfg config.SMTPConfig
+}
+
+// NewSMTPTransport creates a transport which sends emails through the given SMTP server. The connection is upgraded
+// with STARTTLS when the server supports it, and authenticated with PLAIN when a username is given.
+func NewSMTPTransport(cfg config.SMTPConfig) Transport {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &smtpTransport{cfg: cfg}
+}
+
+// Send delivers a message to the SMTP server. The connection is bound to the deadline of the context.
+func (t *smtpTransport) Send(ctx context.Context, msg Message) error {
+	data, err := msg.Bytes(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to format email: %w", err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(t.cfg.Host, strconv.Itoa(t.cfg.Port)))
+	if err != nil {
+		return fmt.Errorf("failed to connect to the SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, t.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to connect to the SMTP server: %w", err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: t.cfg.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if t.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.cfg.Username, t.cfg.Password, t.cfg.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate with the SMTP server: %w", err)
+		}
+	}
+	if err := client.Mail(msg.From); err != nil {
+		return fmt.Errorf("SMTP server rejected the sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP server rejected the recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP server rejected the email: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected the email: %w", err)
+	}
+	return client.Quit()
+}
+
+// fileTransport writes emails as .eml files into a directory instead of sending them.
+type fileTransport struct {
+	dir string
+}
+
+// NewFileTransport creates a transport which writes every email into its own .eml file in dir, creating the
+// directory if needed. The files can be opened with any mail client, which makes the transport useful in development.
+func NewFileTransport(dir string) (Transport, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create email outbox directory: %w", err)
+	}
+	return &fileTransport{dir: dir}, nil
+}
+
+// Send writes a message into a new file. The file is written under a temporary name first, so that readers of the
+// directory never see partial emails.
+func (t *fileTransport) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := msg.Bytes(now)
+	if err != nil {
+		return fmt.Errorf("failed to format email: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := filepath.Join(t.dir, fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix)))
+	if err := os.WriteFile(name+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		_ = os.Remove(name + ".tmp")
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
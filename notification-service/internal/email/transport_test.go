@@ -0,0 +1,178 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpServer is a minimal SMTP server which accepts every email, or rejects the recipients with the given reply.
+type smtpServer struct {
+	addr     string
+	reject   string
+	received chan string
+}
+
+func newSMTPServer(t *testing.T, reject string) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &smtpServer{addr: ln.Addr().String(), reject: reject, received: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost")
+			_ = tp.PrintfLine("250 8BITMIME")
+		case "RCPT":
+			if s.reject != "" {
+				_ = tp.PrintfLine("%s", s.reject)
+				continue
+			}
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.received <- string(data)
+			_ = tp.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) config(t *testing.T) config.SMTPConfig {
+	host, port, err := net.SplitHostPort(s.addr)
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return config.SMTPConfig{Host: host, Port: p}
+}
+
+func TestSMTPTransport_Send(t *testing.T) {
+	server := newSMTPServer(t, "")
+	transport := NewSMTPTransport(server.config(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, transport.Send(ctx, Message{From: "notifications@homerun.example", To: "provider@example.com", Subject: "New rating", Text: "5 stars"}))
+
+	select {
+	case data := <-server.received:
+		msg, err := mail.ReadMessage(strings.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, "New rating", msg.Header.Get("Subject"))
+		assert.Equal(t, "<provider@example.com>", msg.Header.Get("To"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the email was not received")
+	}
+}
+
+func TestSMTPTransport_Rejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		retryable bool
+	}{
+		{"mailbox unavailable", "550 No such user", false},
+		{"mailbox busy", "450 Mailbox busy", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSMTPServer(t, tt.reply)
+			transport := NewSMTPTransport(server.config(t))
+
+			err := transport.Send(context.Background(), Message{From: "notifications@homerun.example", To: "provider@example.com", Subject: "New rating", Text: "5 stars"})
+			require.Error(t, err)
+			assert.Equal(t, tt.retryable, isRetryableError(err))
+		})
+	}
+}
+
+func TestSMTPTransport_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &smtpServer{addr: ln.Addr().String()}
+	cfg := server.config(t)
+	require.NoError(t, ln.Close())
+
+	err = NewSMTPTransport(cfg).Send(context.Background(), Message{From: "notifications@homerun.example", To: "provider@example.com"})
+	require.Error(t, err)
+	assert.True(t, isRetryableError(err))
+}
+
+func TestFileTransport_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	transport, err := NewFileTransport(dir)
+	require.NoError(t, err)
+
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		require.NoError(t, transport.Send(context.Background(), Message{From: "notifications@homerun.example", To: to, Subject: "New rating", Text: "5 stars"}))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 2, "every email gets its own file and no temporary files are left")
+	var recipients []string
+	for _, file := range files {
+		assert.Equal(t, ".eml", filepath.Ext(file))
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		msg, err := mail.ReadMessage(bufio.NewReader(f))
+		require.NoError(t, err)
+		recipients = append(recipients, msg.Header.Get("To"))
+		_ = f.Close()
+	}
+	assert.ElementsMatch(t, []string{"<a@example.com>", "<b@example.com>"}, recipients)
+}
+
+func TestNewTransport(t *testing.T) {
+	transport, err := NewTransport(config.EmailConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, transport, "email notifications are disabled without a transport")
+
+	transport, err = NewTransport(config.EmailConfig{Transport: config.EmailFile, OutboxDir: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &fileTransport{}, transport)
+
+	_, err = NewTransport(config.EmailConfig{Transport: "carrier-pigeon"})
+	assert.Error(t, err)
+}
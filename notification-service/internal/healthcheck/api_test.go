@@ -1,6 +1,8 @@
 package healthcheck
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/test"
@@ -10,7 +12,8 @@ import (
 func TestHealthcheck(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
-	RegisterHandlers(router, "1.0.0")
+	health := New("1.0.0", Check{Name: "storage", Critical: true, Run: func(ctx context.Context) error { return nil }})
+	RegisterHandlers(router, health)
 
 	test.Endpoint(t, router, test.APITestCase{
 		Name:         "healthcheck",
@@ -19,4 +22,47 @@ func TestHealthcheck(t *testing.T) {
 		WantStatus:   200,
 		WantResponse: "*OK 1.0.0*",
 	})
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "livez",
+		Method:       "GET",
+		URL:          "/livez",
+		WantStatus:   200,
+		WantResponse: `*"status":"ok"*`,
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "readyz",
+		Method:       "GET",
+		URL:          "/readyz",
+		WantStatus:   200,
+		WantResponse: `*"storage":{"status":"ok"*`,
+	})
+
+	health.Shutdown()
+	test.Endpoint(t, router, test.APITestCase{
+		Name:       "readyz while shutting down",
+		Method:     "GET",
+		URL:        "/readyz",
+		WantStatus: 503,
+	})
+}
+
+func TestHealthcheck_ReadyzFailure(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	RegisterHandlers(router, New("1.0.0", Check{Name: "storage", Critical: true, Run: func(ctx context.Context) error { return errors.New("unavailable") }}))
+
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "critical check failed",
+		Method:       "GET",
+		URL:          "/readyz",
+		WantStatus:   503,
+		WantResponse: "*unavailable*",
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "healthcheck with a failed critical check",
+		Method:       "GET",
+		URL:          "/healthcheck",
+		WantStatus:   503,
+		WantResponse: "*FAIL 1.0.0*",
+	})
 }
@@ -0,0 +1,22 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+)
+
+// CircuitBreakerCheck returns a non-critical check that fails while the given circuit breaker is open.
+func CircuitBreakerCheck(name string, cb *circuitbreaker.CircuitBreaker) Check {
+	return Check{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			stats := cb.GetStats()
+			if stats["state"] == circuitbreaker.StateOpen.String() {
+				return fmt.Errorf("circuit breaker is %v after %v failures", stats["state"], stats["failure_count"])
+			}
+			return nil
+		},
+	}
+}
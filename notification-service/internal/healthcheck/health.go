@@ -0,0 +1,193 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StatusOK indicates that a check or the whole service is healthy.
+	StatusOK = "ok"
+	// StatusDegraded indicates that a non-critical check failed; the service can still serve traffic.
+	StatusDegraded = "degraded"
+	// StatusFail indicates that a critical check failed or the service is shutting down.
+	StatusFail = "fail"
+)
+
+// defaultCheckTimeout is used when a Check does not set its own timeout.
+const defaultCheckTimeout = 2 * time.Second
+
+// Check describes a single dependency health check.
+type Check struct {
+	// Name identifies the check in the health report.
+	Name string
+	// Critical checks make the service unready when they fail. Failures of non-critical checks
+	// are reported as degraded but do not take the service out of rotation.
+	Critical bool
+	// Timeout bounds the duration of the check. Defaults to 2 seconds.
+	Timeout time.Duration
+	// Run performs the check and returns an error if the dependency is unhealthy.
+	Run func(ctx context.Context) error
+}
+
+// CheckResult represents the outcome of a single check.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// BuildInfo describes the build of the running binary.
+type BuildInfo struct {
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// Report is the response of the liveness and readiness endpoints.
+type Report struct {
+	Status        string                 `json:"status"`
+	Version       string                 `json:"version"`
+	Build         BuildInfo              `json:"build"`
+	Uptime        string                 `json:"uptime"`
+	UptimeSeconds int64                  `json:"uptimeSeconds"`
+	ShuttingDown  bool                   `json:"shuttingDown,omitempty"`
+	Checks        map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health tracks the liveness and readiness of the service.
+type Health struct {
+	version      string
+	build        BuildInfo
+	startTime    time.Time
+	checks       []Check
+	shuttingDown atomic.Bool
+}
+
+// New creates a Health instance which reports the given version and runs the given checks on readiness requests.
+func New(version string, checks ...Check) *Health {
+	return &Health{
+		version:   version,
+		build:     readBuildInfo(),
+		startTime: time.Now(),
+		checks:    checks,
+	}
+}
+
+// Shutdown marks the service as shutting down so that readiness reports fail
+// and load balancers stop routing new traffic to this instance.
+func (h *Health) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// Live returns the liveness report. Liveness only reflects that the process is up and serving requests.
+func (h *Health) Live() Report {
+	return h.report(StatusOK)
+}
+
+// Ready runs all checks concurrently and returns the readiness report.
+func (h *Health) Ready(ctx context.Context) Report {
+	results := make(map[string]CheckResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status := StatusOK
+	for _, result := range results {
+		if result.Status == StatusOK {
+			continue
+		}
+		if result.Critical {
+			status = StatusFail
+			break
+		}
+		status = StatusDegraded
+	}
+	if h.shuttingDown.Load() {
+		status = StatusFail
+	}
+
+	report := h.report(status)
+	report.Checks = results
+	return report
+}
+
+// report builds a report with the common service information.
+func (h *Health) report(status string) Report {
+	uptime := time.Since(h.startTime)
+	return Report{
+		Status:        status,
+		Version:       h.version,
+		Build:         h.build,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		ShuttingDown:  h.shuttingDown.Load(),
+	}
+}
+
+// StatusCode returns the HTTP status code that corresponds to the report status.
+func (r Report) StatusCode() int {
+	if r.Status == StatusFail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// runCheck runs a single check with its timeout and measures its latency.
+func runCheck(ctx context.Context, check Check) CheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		Critical:  check.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// readBuildInfo extracts the Go version and VCS information embedded in the binary.
+func readBuildInfo() BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return BuildInfo{}
+	}
+	build := BuildInfo{GoVersion: info.GoVersion}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
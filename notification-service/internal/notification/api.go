@@ -1,8 +1,16 @@
 package notification
 
 import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
@@ -10,20 +18,54 @@ import (
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 )
 
+const (
+	// maxBatchSize is the maximum number of notifications accepted in a single batch request.
+	maxBatchSize = 100
+	// maxAcknowledgeIDs is the maximum number of notifications acknowledged by a single request.
+	maxAcknowledgeIDs = 1000
+	// defaultPageSize is the number of notifications returned when no limit is given.
+	defaultPageSize = 100
+	// maxPageSize is the maximum number of notifications returned by a single request.
+	maxPageSize = 500
+	// maxWait is the longest time a request waits for new notifications.
+	maxWait = time.Minute
+	// maxDataKeys is the maximum number of keys of the data of a notification.
+	maxDataKeys = 20
+)
+
+// clientIDPattern is the format of the client IDs which identify the devices of a service provider.
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
 // RegisterHandlers sets up the routing of the HTTP handlers.
-func RegisterHandlers(rg *routing.Router, service Service, logger log.Logger) {
-	res := resource{service, logger}
+// The WebSocket and preferences endpoints are only registered when a secret for verifying provider tokens is given.
+func RegisterHandlers(rg *routing.Router, service Service, stream config.StreamConfig, tokenSecret string, logger log.Logger) {
+	if stream.HeartbeatInterval <= 0 {
+		stream.HeartbeatInterval = 15 * time.Second
+	}
+	res := resource{service, stream, tokenSecret, logger}
 
 	// Internal endpoint for receiving notifications from rating service
 	rg.Post("/api/internal/notifications", res.createNotification)
+	rg.Post("/api/internal/notifications/batch", res.createNotificationBatch)
 
-	// Public endpoint for service providers to get notifications
+	// Public endpoints for service providers to get and acknowledge notifications
 	rg.Get("/api/notifications/<serviceProviderId>", res.getNotifications)
+	rg.Get("/api/notifications/<serviceProviderId>/unread-count", res.countUnread)
+	rg.Post("/api/notifications/<serviceProviderId>/ack", res.acknowledgeNotifications)
+	rg.Get("/api/notifications/<serviceProviderId>/stream", res.streamNotifications)
+	rg.Get("/api/notifications/<serviceProviderId>/<id>/deliveries", res.getDeliveries)
+	if tokenSecret != "" {
+		rg.Get("/api/notifications/<serviceProviderId>/ws", res.openSocket)
+		rg.Get("/api/notifications/<serviceProviderId>/preferences", ProviderAuthHandler(tokenSecret), res.getPreferences)
+		rg.Put("/api/notifications/<serviceProviderId>/preferences", ProviderAuthHandler(tokenSecret), res.updatePreferences)
+	}
 }
 
 type resource struct {
-	service Service
-	logger  log.Logger
+	service     Service
+	stream      config.StreamConfig
+	tokenSecret string
+	logger      log.Logger
 }
 
 // createNotification handles POST /api/internal/notifications
@@ -45,15 +87,90 @@ func (r resource) createNotification(c *routing.Context) error {
 		return err
 	}
 
-	return c.WriteWithStatus(resp, 201)
+	// a replayed request gets the original notification with 200 so that clients can safely retry
+	if resp.Duplicate || resp.Suppressed || resp.Coalesced {
+		return c.Write(resp)
+	}
+	return c.WriteWithStatus(resp, http.StatusCreated)
+}
+
+// createNotificationBatch handles POST /api/internal/notifications/batch.
+// Every notification is validated and stored on its own, and the response reports the outcome of each of them.
+func (r resource) createNotificationBatch(c *routing.Context) error {
+	var req BatchNotificationRequest
+	if err := c.Read(&req); err != nil {
+		r.logger.With(c.Request.Context(), "error", err).Error("Failed to parse notification batch request")
+		return errors.BadRequest("Invalid request format")
+	}
+	if len(req.Notifications) == 0 || len(req.Notifications) > maxBatchSize {
+		return errors.BadRequest(fmt.Sprintf("A batch must contain between 1 and %d notifications", maxBatchSize))
+	}
+
+	resp := BatchNotificationResponse{Results: make([]BatchItemResult, 0, len(req.Notifications))}
+	for i, item := range req.Notifications {
+		result := BatchItemResult{Index: i, Status: http.StatusCreated}
+		created, err := r.createBatchItem(c.Request.Context(), item)
+		if err != nil {
+			var errResp errors.ErrorResponse
+			var validationErrs validation.Errors
+			switch {
+			case stderrors.As(err, &validationErrs):
+				errResp = errors.InvalidInput(validationErrs)
+			default:
+				errResp = errors.InternalServerError("")
+			}
+			result.Status = errResp.Status
+			result.Message = errResp.Message
+			result.Details = errResp.Details
+			resp.Failed++
+		} else if created.Duplicate {
+			result.Status = http.StatusOK
+			result.ID = created.ID
+			result.Message = created.Message
+			resp.Duplicates++
+		} else if created.Suppressed {
+			result.Status = http.StatusOK
+			result.Message = created.Message
+			resp.Suppressed++
+		} else if created.Coalesced {
+			result.Status = http.StatusOK
+			result.Message = created.Message
+			resp.Coalesced++
+		} else {
+			result.ID = created.ID
+			result.Message = created.Message
+			resp.Created++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	r.logger.With(c.Request.Context(), "created", resp.Created, "duplicates", resp.Duplicates, "suppressed", resp.Suppressed, "coalesced", resp.Coalesced, "failed", resp.Failed).Info("Processed notification batch")
+	return c.Write(resp)
+}
+
+// createBatchItem validates and creates a single notification of a batch request
+func (r resource) createBatchItem(ctx context.Context, req RatingNotificationRequest) (*CreateNotificationResponse, error) {
+	if err := r.validateCreateNotificationRequest(req); err != nil {
+		return nil, err
+	}
+	return r.service.CreateNotification(ctx, req)
 }
 
-// getNotifications handles GET /api/notifications/{serviceProviderId}
+// getNotifications handles GET /api/notifications/{serviceProviderId}.
+// The returned notifications are marked as read unless peek=true is given. With a clientId, the notifications
+// after the client's cursor are returned instead, see Query. At most limit notifications are returned per request;
+// hasMore tells whether the next page, which starts after nextCursor, holds more. With wait, a request which
+// selects no notifications waits for a new one until the wait expires (long polling). The shape of the notifications
+// depends on the API version, see apiVersion.
 func (r resource) getNotifications(c *routing.Context) error {
 	serviceProviderID := c.Param("serviceProviderId")
 	if serviceProviderID == "" {
 		return errors.BadRequest("Service provider ID is required")
 	}
+	version, err := apiVersion(c)
+	if err != nil {
+		return err
+	}
 
 	// Parse lastChecked parameter (optional)
 	lastChecked := time.Time{} // Default to epoch if not provided
@@ -67,23 +184,213 @@ func (r resource) getNotifications(c *routing.Context) error {
 		lastChecked = parsed
 	}
 
-	resp, err := r.service.GetNotifications(c.Request.Context(), serviceProviderID, lastChecked)
+	peek := false
+	if peekStr := c.Query("peek"); peekStr != "" {
+		parsed, err := strconv.ParseBool(peekStr)
+		if err != nil {
+			return errors.BadRequest("Invalid peek value. Use true or false")
+		}
+		peek = parsed
+	}
+
+	query := Query{
+		ServiceProviderID: serviceProviderID,
+		LastChecked:       lastChecked,
+		Peek:              peek,
+		ClientID:          c.Query("clientId"),
+		Limit:             defaultPageSize,
+	}
+	if err := validation.Validate(query.ClientID, validation.Length(1, 64), validation.Match(clientIDPattern)); err != nil {
+		return errors.BadRequest("Invalid clientId. Use up to 64 letters, digits, '.', '_' or '-'")
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return errors.BadRequest(fmt.Sprintf("Invalid limit. Use a number between 1 and %d", maxPageSize))
+		}
+		query.Limit = limit
+	}
+	if afterStr := c.Query("after"); afterStr != "" {
+		after, err := strconv.ParseUint(afterStr, 10, 64)
+		if err != nil {
+			return errors.BadRequest("Invalid after value. Use a sequence number")
+		}
+		query.After = &after
+	}
+	if waitStr := c.Query("wait"); waitStr != "" {
+		wait, err := time.ParseDuration(waitStr)
+		if err != nil || wait < 0 || wait > maxWait {
+			return errors.BadRequest(fmt.Sprintf("Invalid wait. Use a duration up to %s, e.g. 30s", maxWait))
+		}
+		query.Wait = wait
+	}
+
+	resp, err := r.service.GetNotifications(c.Request.Context(), query)
+	if err != nil && c.Request.Context().Err() != nil {
+		// the client went away while waiting, so there is no one to respond to
+		r.logger.With(c.Request.Context(), "service_provider_id", serviceProviderID).Debug("Client stopped waiting for notifications")
+		return nil
+	}
 	if err != nil {
 		r.logger.With(c.Request.Context(), "error", err, "service_provider_id", serviceProviderID).
 			Error("Failed to get notifications")
 		return err
 	}
 
+	for i, notification := range resp.Notifications {
+		resp.Notifications[i] = notification.ForVersion(version)
+	}
+	return c.Write(resp)
+}
+
+// apiVersion returns the API version requested with the version query parameter, which defaults to 1 so that
+// existing clients keep getting the shape they know. A query parameter is used instead of a header because browsers
+// cannot set headers on streams and WebSocket requests.
+func apiVersion(c *routing.Context) (int, error) {
+	versionStr := c.Query("version")
+	if versionStr == "" {
+		return APIVersion1, nil
+	}
+	version, err := strconv.Atoi(versionStr)
+	if err != nil || version < APIVersion1 || version > APIVersion2 {
+		return 0, errors.BadRequest(fmt.Sprintf("Invalid version. Use %d or %d", APIVersion1, APIVersion2))
+	}
+	return version, nil
+}
+
+// acknowledgeNotifications handles POST /api/notifications/{serviceProviderId}/ack
+func (r resource) acknowledgeNotifications(c *routing.Context) error {
+	serviceProviderID := c.Param("serviceProviderId")
+	if serviceProviderID == "" {
+		return errors.BadRequest("Service provider ID is required")
+	}
+
+	var req AcknowledgeRequest
+	if err := c.Read(&req); err != nil {
+		r.logger.With(c.Request.Context(), "error", err).Error("Failed to parse acknowledge request")
+		return errors.BadRequest("Invalid request format")
+	}
+	if err := r.validateAcknowledgeRequest(req); err != nil {
+		return err
+	}
+
+	resp, err := r.service.AcknowledgeNotifications(c.Request.Context(), serviceProviderID, req)
+	if err != nil {
+		return err
+	}
+	return c.Write(resp)
+}
+
+// countUnread handles GET /api/notifications/{serviceProviderId}/unread-count
+func (r resource) countUnread(c *routing.Context) error {
+	serviceProviderID := c.Param("serviceProviderId")
+	if serviceProviderID == "" {
+		return errors.BadRequest("Service provider ID is required")
+	}
+
+	resp, err := r.service.CountUnread(c.Request.Context(), serviceProviderID)
+	if err != nil {
+		return err
+	}
 	return c.Write(resp)
 }
 
+// getDeliveries handles GET /api/notifications/{serviceProviderId}/{id}/deliveries
+func (r resource) getDeliveries(c *routing.Context) error {
+	deliveries, err := r.service.GetDeliveries(c.Request.Context(), c.Param("serviceProviderId"), c.Param("id"))
+	if stderrors.Is(err, ErrNotFound) {
+		return errors.NotFound("")
+	}
+	if err != nil {
+		return err
+	}
+	return c.Write(deliveries)
+}
+
+// getPreferences handles GET /api/notifications/{serviceProviderId}/preferences
+func (r resource) getPreferences(c *routing.Context) error {
+	preferences, err := r.service.GetPreferences(c.Request.Context(), c.Param("serviceProviderId"))
+	if err != nil {
+		return err
+	}
+	return c.Write(preferences)
+}
+
+// updatePreferences handles PUT /api/notifications/{serviceProviderId}/preferences
+func (r resource) updatePreferences(c *routing.Context) error {
+	var req UpdatePreferencesRequest
+	if err := c.Read(&req); err != nil {
+		r.logger.With(c.Request.Context(), "error", err).Error("Failed to parse preferences request")
+		return errors.BadRequest("Invalid request format")
+	}
+	if err := r.validateUpdatePreferencesRequest(req); err != nil {
+		return err
+	}
+
+	preferences, err := r.service.UpdatePreferences(c.Request.Context(), c.Param("serviceProviderId"), req)
+	if err != nil {
+		return err
+	}
+	return c.Write(preferences)
+}
+
+// ProviderAuthHandler returns a middleware that authenticates the service provider in the serviceProviderId path
+// parameter with a provider token given as bearer token, see SignProviderToken.
+func ProviderAuthHandler(tokenSecret string) routing.Handler {
+	return func(c *routing.Context) error {
+		token, ok := strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if !ok || tokenSecret == "" {
+			return errors.Unauthorized("")
+		}
+		if err := VerifyProviderToken(tokenSecret, token, c.Param("serviceProviderId"), time.Now()); err != nil {
+			return errors.Unauthorized("")
+		}
+		return nil
+	}
+}
+
+// validateAcknowledgeRequest validates the acknowledge request
+func (r resource) validateAcknowledgeRequest(req AcknowledgeRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.IDs, validation.Required, validation.Length(1, maxAcknowledgeIDs), validation.Each(validation.Required)),
+		validation.Field(&req.State, validation.In(StateRead, StateArchived)),
+	)
+}
+
+// validateUpdatePreferencesRequest validates the update preferences request
+func (r resource) validateUpdatePreferencesRequest(req UpdatePreferencesRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.MinRating, validation.Min(0), validation.Max(5)),
+		validation.Field(&req.Channels, keysIn(ChannelInApp, ChannelWebhook, ChannelEmail, ChannelSMS)),
+		validation.Field(&req.Events, keysIn(EventRatingCreated)),
+		validation.Field(&req.QuietHours),
+		validation.Field(&req.Digest),
+		validation.Field(&req.Locale, validation.Match(localePattern).Error("must be a locale such as tr or pt-BR")),
+		validation.Field(&req.EmailAddress, validation.Length(0, 254), is.EmailFormat),
+	)
+}
+
 // validateCreateNotificationRequest validates the create notification request
 func (r resource) validateCreateNotificationRequest(req RatingNotificationRequest) error {
 	return validation.ValidateStruct(&req,
 		validation.Field(&req.ServiceProviderID, validation.Required, is.UUID),
+		validation.Field(&req.ServiceProviderEmail, validation.Length(0, 254), is.EmailFormat),
 		validation.Field(&req.RatingID, validation.Required, is.UUID),
+		validation.Field(&req.Type, validation.In(EventRatingCreated)),
 		validation.Field(&req.Rating, validation.Required, validation.Min(1), validation.Max(5)),
 		validation.Field(&req.CustomerName, validation.Length(1, 255)),
 		validation.Field(&req.Comment, validation.Length(0, 1000)),
+		validation.Field(&req.Data, validation.Length(0, maxDataKeys), validation.By(validateDataKeys)),
 	)
 }
+
+// validateDataKeys checks that the keys of the data of a notification are neither empty nor longer than 64 characters.
+func validateDataKeys(value interface{}) error {
+	data, _ := value.(map[string]interface{})
+	for key := range data {
+		if len(key) == 0 || len(key) > 64 {
+			return stderrors.New("keys must be between 1 and 64 characters long")
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -69,6 +70,42 @@ func TestNotificationAPI_CreateNotification(t *testing.T) {
 				assert.Contains(t, response["message"], "problem with the data")
 			},
 		},
+		{
+			name: "valid notification request with data",
+			request: RatingNotificationRequest{
+				ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+				RatingID:          "456e7890-e89b-12d3-a456-426614174011",
+				Rating:            4,
+				Data:              map[string]interface{}{"ratingUrl": "https://homerun.example/ratings/1"},
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "data with an empty key",
+			request: RatingNotificationRequest{
+				ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+				RatingID:          "456e7890-e89b-12d3-a456-426614174012",
+				Rating:            4,
+				Data:              map[string]interface{}{"": "value"},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "data with too many keys",
+			request: RatingNotificationRequest{
+				ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+				RatingID:          "456e7890-e89b-12d3-a456-426614174013",
+				Rating:            4,
+				Data: func() map[string]interface{} {
+					data := make(map[string]interface{})
+					for i := 0; i <= maxDataKeys; i++ {
+						data[fmt.Sprintf("key%d", i)] = i
+					}
+					return data
+				}(),
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name: "invalid rating (too low)",
 			request: RatingNotificationRequest{
@@ -99,6 +136,26 @@ func TestNotificationAPI_CreateNotification(t *testing.T) {
 				assert.Contains(t, response["message"], "problem with the data")
 			},
 		},
+		{
+			name: "unknown event type",
+			request: RatingNotificationRequest{
+				ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+				RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+				Type:              "rating.deleted",
+				Rating:            5,
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid service provider email",
+			request: RatingNotificationRequest{
+				ServiceProviderID:    "123e4567-e89b-12d3-a456-426614174000",
+				ServiceProviderEmail: "not-an-email",
+				RatingID:             "456e7890-e89b-12d3-a456-426614174001",
+				Rating:               5,
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name: "invalid UUID format",
 			request: RatingNotificationRequest{
@@ -130,7 +187,7 @@ func TestNotificationAPI_CreateNotification(t *testing.T) {
 					MaxAge:   1 * time.Hour,
 				},
 			}
-			service := NewService(storage, logger, cfg)
+			service := NewService(storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
 
 			// Create router
 			router := routing.New()
@@ -138,7 +195,7 @@ func TestNotificationAPI_CreateNotification(t *testing.T) {
 				errors.Handler(logger),
 				content.TypeNegotiator(content.JSON),
 			)
-			RegisterHandlers(router, service, logger)
+			RegisterHandlers(router, service, config.StreamConfig{}, "", logger)
 
 			// Prepare request body
 			var requestBody []byte
@@ -171,6 +228,48 @@ func TestNotificationAPI_CreateNotification(t *testing.T) {
 	}
 }
 
+func TestNotificationAPI_CreateNotification_Replay(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+	service := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+
+	router := routing.New()
+	router.Use(
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+	)
+	RegisterHandlers(router, service, config.StreamConfig{}, "", logger)
+
+	body := mustMarshal(t, RatingNotificationRequest{
+		ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+		RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+		Type:              EventRatingCreated,
+		Rating:            5,
+	})
+	send := func() (int, CreateNotificationResponse) {
+		httpReq := httptest.NewRequest("POST", "/api/internal/notifications", bytes.NewBufferString(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+
+		var response CreateNotificationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	status, first := send()
+	assert.Equal(t, http.StatusCreated, status)
+	assert.False(t, first.Duplicate)
+
+	status, replay := send()
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, replay.Duplicate)
+	assert.Equal(t, first.ID, replay.ID)
+}
+
 func TestNotificationAPI_GetNotifications(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -250,6 +349,75 @@ func TestNotificationAPI_GetNotifications(t *testing.T) {
 				assert.False(t, response.HasMore)
 			},
 		},
+		{
+			name:              "version 2 returns the rating details",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			setupNotifications: []Notification{
+				{
+					ID:                "detailed-notification",
+					ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+					Type:              EventRatingCreated,
+					Message:           "New 4-star rating received from Jane",
+					RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+					Rating:            4,
+					CustomerName:      "Jane",
+					Comment:           "Tidy work",
+					Data:              map[string]interface{}{"ratingUrl": "https://homerun.example/ratings/1"},
+					CreatedAt:         time.Now(),
+				},
+			},
+			queryParams:    "?version=2",
+			expectedStatus: http.StatusOK,
+			validateFunc: func(t *testing.T, body []byte) {
+				var response GetNotificationsResponse
+				require.NoError(t, json.Unmarshal(body, &response))
+				require.Len(t, response.Notifications, 1)
+				notification := response.Notifications[0]
+				assert.Equal(t, EventRatingCreated, notification.Type)
+				assert.Equal(t, "New 4-star rating received from Jane", notification.Message)
+				assert.Equal(t, 4, notification.Rating)
+				assert.Equal(t, "Jane", notification.CustomerName)
+				assert.Equal(t, "Tidy work", notification.Comment)
+				assert.Equal(t, "https://homerun.example/ratings/1", notification.Data["ratingUrl"])
+			},
+		},
+		{
+			name:              "version 1 is the default",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			setupNotifications: []Notification{
+				{
+					ID:                "detailed-notification",
+					ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+					Type:              EventRatingCreated,
+					Message:           "New 4-star rating received from Jane",
+					RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+					Rating:            4,
+					CustomerName:      "Jane",
+					Comment:           "Tidy work",
+					Data:              map[string]interface{}{"ratingUrl": "https://homerun.example/ratings/1"},
+					CreatedAt:         time.Now(),
+				},
+			},
+			expectedStatus: http.StatusOK,
+			validateFunc: func(t *testing.T, body []byte) {
+				var response struct {
+					Notifications []map[string]interface{} `json:"notifications"`
+				}
+				require.NoError(t, json.Unmarshal(body, &response))
+				require.Len(t, response.Notifications, 1)
+				notification := response.Notifications[0]
+				assert.Equal(t, "New 4-star rating received from Jane", notification["message"])
+				for _, key := range []string{"rating", "customerName", "comment", "data"} {
+					assert.NotContains(t, notification, key)
+				}
+			},
+		},
+		{
+			name:              "invalid version",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			queryParams:       "?version=3",
+			expectedStatus:    http.StatusBadRequest,
+		},
 		{
 			name:              "invalid lastChecked format",
 			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
@@ -262,6 +430,111 @@ func TestNotificationAPI_GetNotifications(t *testing.T) {
 				assert.Contains(t, response["message"], "Invalid lastChecked format")
 			},
 		},
+		{
+			name:              "get notifications of a client",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			setupNotifications: []Notification{
+				{
+					ID:                "test-notification-1",
+					ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+					RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+					CreatedAt:         time.Now(),
+				},
+				{
+					ID:                "test-notification-2",
+					ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+					RatingID:          "456e7890-e89b-12d3-a456-426614174002",
+					CreatedAt:         time.Now(),
+				},
+			},
+			queryParams:    "?clientId=phone&after=1",
+			expectedStatus: http.StatusOK,
+			validateFunc: func(t *testing.T, body []byte) {
+				var response GetNotificationsResponse
+				err := json.Unmarshal(body, &response)
+				require.NoError(t, err)
+				require.Len(t, response.Notifications, 1)
+				assert.Equal(t, uint64(2), response.Notifications[0].Sequence)
+				assert.Equal(t, uint64(2), response.NextCursor)
+				assert.False(t, response.Gap)
+			},
+		},
+		{
+			name:              "invalid clientId",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			queryParams:       "?clientId=" + url.QueryEscape("my phone"),
+			expectedStatus:    http.StatusBadRequest,
+		},
+		{
+			name:              "get a page of notifications",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			setupNotifications: []Notification{
+				{
+					ID:                "test-notification-1",
+					ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+					RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+					CreatedAt:         time.Now(),
+				},
+				{
+					ID:                "test-notification-2",
+					ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+					RatingID:          "456e7890-e89b-12d3-a456-426614174002",
+					CreatedAt:         time.Now(),
+				},
+				{
+					ID:                "test-notification-3",
+					ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+					RatingID:          "456e7890-e89b-12d3-a456-426614174003",
+					CreatedAt:         time.Now(),
+				},
+			},
+			queryParams:    "?peek=true&after=1&limit=1",
+			expectedStatus: http.StatusOK,
+			validateFunc: func(t *testing.T, body []byte) {
+				var response GetNotificationsResponse
+				err := json.Unmarshal(body, &response)
+				require.NoError(t, err)
+				require.Len(t, response.Notifications, 1)
+				assert.Equal(t, "test-notification-2", response.Notifications[0].ID)
+				assert.True(t, response.HasMore)
+				assert.Equal(t, uint64(2), response.NextCursor)
+			},
+		},
+		{
+			name:              "limit too large",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			queryParams:       "?limit=501",
+			expectedStatus:    http.StatusBadRequest,
+		},
+		{
+			name:              "invalid limit",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			queryParams:       "?limit=0",
+			expectedStatus:    http.StatusBadRequest,
+		},
+		{
+			name:              "invalid wait",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			queryParams:       "?wait=2m",
+			expectedStatus:    http.StatusBadRequest,
+		},
+		{
+			name:              "wait expires without notifications",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			queryParams:       "?wait=10ms",
+			expectedStatus:    http.StatusOK,
+			validateFunc: func(t *testing.T, body []byte) {
+				var response GetNotificationsResponse
+				require.NoError(t, json.Unmarshal(body, &response))
+				assert.Empty(t, response.Notifications)
+			},
+		},
+		{
+			name:              "invalid after",
+			serviceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+			queryParams:       "?clientId=phone&after=-1",
+			expectedStatus:    http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -278,7 +551,7 @@ func TestNotificationAPI_GetNotifications(t *testing.T) {
 					MaxAge:   1 * time.Hour,
 				},
 			}
-			service := NewService(storage, logger, cfg)
+			service := NewService(storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
 
 			// Create router
 			router := routing.New()
@@ -286,11 +559,11 @@ func TestNotificationAPI_GetNotifications(t *testing.T) {
 				errors.Handler(logger),
 				content.TypeNegotiator(content.JSON),
 			)
-			RegisterHandlers(router, service, logger)
+			RegisterHandlers(router, service, config.StreamConfig{}, "", logger)
 
 			// Setup test notifications
 			for _, notification := range tt.setupNotifications {
-				err := storage.StoreNotification(context.Background(), notification)
+				_, _, err := storage.StoreNotification(context.Background(), notification)
 				require.NoError(t, err)
 			}
 
@@ -314,3 +587,282 @@ func TestNotificationAPI_GetNotifications(t *testing.T) {
 		})
 	}
 }
+
+func TestNotificationAPI_CreateNotificationBatch(t *testing.T) {
+	valid := RatingNotificationRequest{
+		ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+		RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+		Rating:            5,
+		CustomerName:      "John Doe",
+	}
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectedStatus int
+		validateFunc   func(t *testing.T, body []byte)
+	}{
+		{
+			name:           "mixed batch",
+			requestBody:    mustMarshal(t, BatchNotificationRequest{Notifications: []RatingNotificationRequest{valid, {Rating: 6}, valid}}),
+			expectedStatus: http.StatusOK,
+			validateFunc: func(t *testing.T, body []byte) {
+				var response BatchNotificationResponse
+				require.NoError(t, json.Unmarshal(body, &response))
+				assert.Equal(t, 1, response.Created)
+				assert.Equal(t, 1, response.Duplicates)
+				assert.Equal(t, 1, response.Failed)
+				require.Len(t, response.Results, 3)
+				assert.Equal(t, http.StatusCreated, response.Results[0].Status)
+				assert.NotEmpty(t, response.Results[0].ID)
+				assert.Equal(t, 1, response.Results[1].Index)
+				assert.Equal(t, http.StatusBadRequest, response.Results[1].Status)
+				assert.Empty(t, response.Results[1].ID)
+				assert.NotEmpty(t, response.Results[1].Details)
+				assert.Equal(t, http.StatusOK, response.Results[2].Status)
+				assert.Equal(t, response.Results[0].ID, response.Results[2].ID)
+			},
+		},
+		{
+			name:           "invalid JSON",
+			requestBody:    "invalid json",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty batch",
+			requestBody:    `{"notifications":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "batch too large",
+			requestBody:    mustMarshal(t, BatchNotificationRequest{Notifications: make([]RatingNotificationRequest, maxBatchSize+1)}),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := log.NewForTest()
+			cfg := config.Config{
+				Retry:          retry.DefaultRetryConfig(),
+				CircuitBreaker: circuitbreaker.DefaultConfig(),
+			}
+			service := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+
+			router := routing.New()
+			router.Use(
+				errors.Handler(logger),
+				content.TypeNegotiator(content.JSON),
+			)
+			RegisterHandlers(router, service, config.StreamConfig{}, "", logger)
+
+			httpReq := httptest.NewRequest("POST", "/api/internal/notifications/batch", bytes.NewBufferString(tt.requestBody))
+			httpReq.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httpReq)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.validateFunc != nil {
+				tt.validateFunc(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestNotificationAPI_AcknowledgeNotifications(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+	storage := NewInMemoryStorage(logger)
+	service := NewService(storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+
+	router := routing.New()
+	router.Use(
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+	)
+	RegisterHandlers(router, service, config.StreamConfig{}, "", logger)
+
+	serviceProviderID := "123e4567-e89b-12d3-a456-426614174000"
+	for _, id := range []string{"notif-1", "notif-2"} {
+		_, _, err := storage.StoreNotification(context.Background(), Notification{
+			ID:                id,
+			ServiceProviderID: serviceProviderID,
+			Type:              EventRatingCreated,
+			RatingID:          id,
+			CreatedAt:         time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		httpReq := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+		return w
+	}
+	unread := func() int {
+		w := do("GET", "/api/notifications/"+serviceProviderID+"/unread-count", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response UnreadCountResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Unread
+	}
+
+	// peeking returns the unread notifications without consuming them
+	w := do("GET", "/api/notifications/"+serviceProviderID+"?peek=true", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var notifications GetNotificationsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &notifications))
+	assert.Len(t, notifications.Notifications, 2)
+	assert.Equal(t, 2, unread())
+
+	w = do("POST", "/api/notifications/"+serviceProviderID+"/ack", `{"ids":["notif-1","unknown"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var ack AcknowledgeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ack))
+	assert.Equal(t, 1, ack.Acknowledged)
+	assert.Equal(t, 1, unread())
+
+	w = do("POST", "/api/notifications/"+serviceProviderID+"/ack", `{"ids":["notif-1","notif-2"],"state":"archived"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ack))
+	assert.Equal(t, 2, ack.Acknowledged)
+	assert.Equal(t, 0, unread())
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{"invalid peek", "/api/notifications/" + serviceProviderID + "?peek=maybe", ""},
+		{"invalid JSON", "/api/notifications/" + serviceProviderID + "/ack", "invalid json"},
+		{"no IDs", "/api/notifications/" + serviceProviderID + "/ack", `{"ids":[]}`},
+		{"empty ID", "/api/notifications/" + serviceProviderID + "/ack", `{"ids":[""]}`},
+		{"unknown state", "/api/notifications/" + serviceProviderID + "/ack", `{"ids":["notif-1"],"state":"unread"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := "POST"
+			if tt.body == "" {
+				method = "GET"
+			}
+			assert.Equal(t, http.StatusBadRequest, do(method, tt.url, tt.body).Code)
+		})
+	}
+}
+
+func TestNotificationAPI_GetDeliveries(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+	service := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+
+	router := routing.New()
+	router.Use(
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+	)
+	RegisterHandlers(router, service, config.StreamConfig{}, "", logger)
+
+	serviceProviderID := "123e4567-e89b-12d3-a456-426614174000"
+	resp, err := service.CreateNotification(context.Background(), RatingNotificationRequest{
+		ServiceProviderID: serviceProviderID,
+		RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+		Rating:            5,
+	})
+	require.NoError(t, err)
+	require.NoError(t, service.Close(context.Background()))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/notifications/"+serviceProviderID+"/"+resp.ID+"/deliveries", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var deliveries []Delivery
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deliveries))
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, ChannelInApp, deliveries[0].Channel)
+	assert.Equal(t, DeliverySucceeded, deliveries[0].State)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/notifications/other/"+resp.ID+"/deliveries", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNotificationAPI_Preferences(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+	service := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+
+	router := routing.New()
+	router.Use(
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+	)
+	RegisterHandlers(router, service, config.StreamConfig{}, secret, logger)
+
+	serviceProviderID := "123e4567-e89b-12d3-a456-426614174000"
+	url := "/api/notifications/" + serviceProviderID + "/preferences"
+	token := SignProviderToken(secret, serviceProviderID, time.Now().Add(time.Minute))
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"missing token", "GET", "", "", http.StatusUnauthorized, ""},
+		{"token of another service provider", "GET", SignProviderToken(secret, "other", time.Now().Add(time.Minute)), "", http.StatusUnauthorized, ""},
+		{"defaults", "GET", token, "", http.StatusOK, `"minRating":0`},
+		{"update", "PUT", token, `{"minRating":4,"channels":{"email":false},"events":{"rating.created":true},"quietHours":{"start":"22:00","end":"07:00","timezone":"Europe/Istanbul"}}`, http.StatusOK, `"minRating":4`},
+		{"get updated", "GET", token, "", http.StatusOK, `"timezone":"Europe/Istanbul"`},
+		{"rating out of range", "PUT", token, `{"minRating":6}`, http.StatusBadRequest, "minRating"},
+		{"unknown channel", "PUT", token, `{"channels":{"pager":true}}`, http.StatusBadRequest, "channels"},
+		{"unknown event type", "PUT", token, `{"events":{"rating.deleted":false}}`, http.StatusBadRequest, "events"},
+		{"invalid quiet hours", "PUT", token, `{"quietHours":{"start":"22:00","end":"25:00","timezone":"Europe/Istanbul"}}`, http.StatusBadRequest, "end"},
+		{"unknown time zone", "PUT", token, `{"quietHours":{"start":"22:00","end":"07:00","timezone":"Mars/Olympus"}}`, http.StatusBadRequest, "IANA time zone"},
+		{"email address", "PUT", token, `{"emailAddress":"office@example.com"}`, http.StatusOK, `"emailAddress":"office@example.com"`},
+		{"invalid email address", "PUT", token, `{"emailAddress":"office"}`, http.StatusBadRequest, "emailAddress"},
+		{"update digest", "PUT", token, `{"digest":{"frequency":"weekly","timezone":"Europe/Istanbul"}}`, http.StatusOK, `"frequency":"weekly"`},
+		{"unknown digest frequency", "PUT", token, `{"digest":{"frequency":"hourly","timezone":"UTC"}}`, http.StatusBadRequest, "frequency"},
+		{"digest without time zone", "PUT", token, `{"digest":{"frequency":"daily"}}`, http.StatusBadRequest, "timezone"},
+		{"locale", "PUT", token, `{"digest":{"frequency":"weekly","timezone":"Europe/Istanbul"},"locale":"tr"}`, http.StatusOK, `"locale":"tr"`},
+		{"invalid locale", "PUT", token, `{"locale":"Turkish"}`, http.StatusBadRequest, "locale"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+
+	// the ratings of service providers who opted into digests are collected instead of notified
+	w := httptest.NewRecorder()
+	body := `{"serviceProviderId":"` + serviceProviderID + `","ratingId":"456e7890-e89b-12d3-a456-426614174001","rating":3}`
+	req := httptest.NewRequest("POST", "/api/internal/notifications", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"suppressed":true`)
+}
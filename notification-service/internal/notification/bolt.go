@@ -0,0 +1,627 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// notificationsBucket holds a bucket per service provider which maps a sequence number to a notification,
+	// so that the notifications of a service provider are iterated in the order they were stored
+	notificationsBucket = []byte("notifications")
+	// idempotencyBucket maps the idempotency keys of a notification to its sequence number
+	idempotencyBucket = []byte("idempotency_keys")
+	// idsBucket maps the ID of a notification to its sequence number
+	idsBucket = []byte("notification_ids")
+	// cursorsBucket maps a service provider ID and a client ID to the cursor of the client
+	cursorsBucket = []byte("cursors")
+	// deliveriesBucket holds a bucket per notification ID which maps a channel name to a delivery
+	deliveriesBucket = []byte("deliveries")
+	// preferencesBucket maps a service provider ID to its preferences
+	preferencesBucket = []byte("preferences")
+	// digestsBucket holds a bucket per service provider which maps a rating ID to a digest entry
+	digestsBucket = []byte("digests")
+)
+
+// boltStorage implements Storage using an embedded bbolt database file
+type boltStorage struct {
+	db     *bolt.DB
+	logger log.Logger
+}
+
+// NewBoltStorage opens or creates the bbolt database file at the given path and returns a storage backed by it.
+func NewBoltStorage(path string, logger log.Logger) (Storage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notification database %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{notificationsBucket, idempotencyBucket, idsBucket, cursorsBucket, deliveriesBucket, preferencesBucket, digestsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize notification database %s: %w", path, err)
+	}
+	return &boltStorage{db: db, logger: logger}, nil
+}
+
+// StoreNotification stores a notification in the database unless it is a duplicate of a stored one
+func (s *boltStorage) StoreNotification(ctx context.Context, notification Notification) (stored Notification, created bool, err error) {
+	_, span := tracer.Start(ctx, "notification.Storage.StoreNotification")
+	defer func() { tracing.End(span, err) }()
+
+	if notification.State == "" {
+		notification.State = StateUnread
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(notification.IdempotencyKey())
+		keys := tx.Bucket(idempotencyBucket)
+		provider, err := tx.Bucket(notificationsBucket).CreateBucketIfNotExists([]byte(notification.ServiceProviderID))
+		if err != nil {
+			return err
+		}
+
+		if seq := keys.Get(key); seq != nil {
+			stored, err = decodeNotification(provider.Get(seq))
+			return err
+		}
+
+		id, err := provider.NextSequence()
+		if err != nil {
+			return err
+		}
+		seq := encodeSequence(id)
+		notification.Sequence = id
+		if err := putNotification(provider, seq, notification); err != nil {
+			return err
+		}
+		if err := tx.Bucket(idsBucket).Put([]byte(notification.ID), seq); err != nil {
+			return err
+		}
+		stored, created = notification, true
+		for _, key := range notification.IdempotencyKeys() {
+			if keys.Get([]byte(key)) != nil {
+				continue
+			}
+			if err := keys.Put([]byte(key), seq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Notification{}, false, err
+	}
+
+	if created {
+		s.logger.With(ctx, "service_provider_id", notification.ServiceProviderID, "notification_id", notification.ID).
+			Info("Storing notification")
+	} else {
+		s.logger.With(ctx, "service_provider_id", notification.ServiceProviderID, "notification_id", stored.ID).
+			Info("Notification already stored")
+	}
+	return stored, created, nil
+}
+
+// GetNotifications retrieves the notifications selected by the query
+func (s *boltStorage) GetNotifications(ctx context.Context, query Query) (result QueryResult, err error) {
+	_, span := tracer.Start(ctx, "notification.Storage.GetNotifications")
+	defer func() { tracing.End(span, err) }()
+
+	s.logger.With(ctx, "service_provider_id", query.ServiceProviderID, "last_checked", query.LastChecked, "peek", query.Peek).
+		Debug("Retrieving notifications")
+
+	collect := func(tx *bolt.Tx) error {
+		result, err = selectNotifications(tx, query)
+		return err
+	}
+	if query.Peek {
+		err = s.db.View(collect)
+	} else {
+		err = s.db.Update(collect)
+	}
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	s.logger.With(ctx, "service_provider_id", query.ServiceProviderID, "new_count", len(result.Notifications)).
+		Debug("Retrieved notifications")
+
+	return result, nil
+}
+
+// selectNotifications selects the notifications of the query, marks them as read or moves the client's cursor,
+// depending on the query.
+func selectNotifications(tx *bolt.Tx, query Query) (QueryResult, error) {
+	// the provider bucket is nil when no notification was ever stored for the service provider
+	provider := tx.Bucket(notificationsBucket).Bucket([]byte(query.ServiceProviderID))
+	cursors := tx.Bucket(cursorsBucket)
+	key := []byte(query.ServiceProviderID + "\x00" + query.ClientID)
+
+	selection := newSelection(query)
+	if query.ClientID != "" {
+		var stored uint64
+		value := cursors.Get(key)
+		if value != nil {
+			stored = binary.BigEndian.Uint64(value)
+		}
+		oldest := uint64(1)
+		if provider != nil {
+			oldest = provider.Sequence() + 1
+			if k, _ := provider.Cursor().First(); k != nil {
+				oldest = binary.BigEndian.Uint64(k)
+			}
+		}
+		selection = newClientSelection(query, stored, value != nil, oldest)
+	}
+	if provider == nil {
+		return selection.result, nil
+	}
+
+	c := provider.Cursor()
+	for k, v := c.Seek(encodeSequence(selection.after + 1)); k != nil; k, v = c.Next() {
+		notification, err := decodeNotification(v)
+		if err != nil {
+			return QueryResult{}, err
+		}
+		selected, more := selection.add(notification)
+		if selected && selection.consumes() {
+			notification.State = StateRead
+			selection.result.Notifications[len(selection.result.Notifications)-1].State = StateRead
+			// updating the value under the cursor's current key does not invalidate the cursor
+			if err := putNotification(provider, k, notification); err != nil {
+				return QueryResult{}, err
+			}
+		}
+		if !more {
+			break
+		}
+	}
+
+	if selection.moved() {
+		if err := cursors.Put(key, encodeSequence(selection.result.Cursor)); err != nil {
+			return QueryResult{}, err
+		}
+	}
+	return selection.result, nil
+}
+
+// GetNotification returns a notification of a service provider
+func (s *boltStorage) GetNotification(ctx context.Context, serviceProviderID, id string) (notification Notification, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		provider := tx.Bucket(notificationsBucket).Bucket([]byte(serviceProviderID))
+		seq := tx.Bucket(idsBucket).Get([]byte(id))
+		if provider == nil || seq == nil {
+			return ErrNotFound
+		}
+		value := provider.Get(seq)
+		if value == nil {
+			return ErrNotFound
+		}
+		if notification, err = decodeNotification(value); err != nil {
+			return err
+		}
+		// sequence numbers are per service provider, so the ID must be checked as well
+		if notification.ID != id {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return notification, err
+}
+
+// UpdateState moves the given notifications of a service provider to the given state
+func (s *boltStorage) UpdateState(ctx context.Context, serviceProviderID string, ids []string, state string) (updated int, err error) {
+	_, span := tracer.Start(ctx, "notification.Storage.UpdateState")
+	defer func() { tracing.End(span, err) }()
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		provider := tx.Bucket(notificationsBucket).Bucket([]byte(serviceProviderID))
+		if provider == nil {
+			return nil
+		}
+		index := tx.Bucket(idsBucket)
+
+		for _, id := range ids {
+			seq := index.Get([]byte(id))
+			if seq == nil {
+				continue
+			}
+			value := provider.Get(seq)
+			if value == nil {
+				continue
+			}
+			notification, err := decodeNotification(value)
+			if err != nil {
+				return err
+			}
+			// sequence numbers are per service provider, so the ID must be checked as well
+			if notification.ID != id || !canTransition(notification.State, state) {
+				continue
+			}
+			notification.State = state
+			if err := putNotification(provider, seq, notification); err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// CountNotifications returns the number of notifications of a service provider in the given state
+func (s *boltStorage) CountNotifications(ctx context.Context, serviceProviderID string, state string) (count int, err error) {
+	_, span := tracer.Start(ctx, "notification.Storage.CountNotifications")
+	defer func() { tracing.End(span, err) }()
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		provider := tx.Bucket(notificationsBucket).Bucket([]byte(serviceProviderID))
+		if provider == nil {
+			return nil
+		}
+		return provider.ForEach(func(k, v []byte) error {
+			notification, err := decodeNotification(v)
+			if err != nil {
+				return err
+			}
+			if notification.State == state {
+				count++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// SaveDelivery stores the delivery of a notification through a channel
+func (s *boltStorage) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		deliveries, err := tx.Bucket(deliveriesBucket).CreateBucketIfNotExists([]byte(delivery.NotificationID))
+		if err != nil {
+			return err
+		}
+		return deliveries.Put([]byte(delivery.Channel), value)
+	})
+}
+
+// GetDeliveries returns the deliveries of a notification
+func (s *boltStorage) GetDeliveries(ctx context.Context, notificationID string) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		deliveries, err = decodeDeliveries(tx.Bucket(deliveriesBucket).Bucket([]byte(notificationID)))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ListHeldDeliveries returns the held deliveries which are due
+func (s *boltStorage) ListHeldDeliveries(ctx context.Context, until time.Time) ([]Delivery, error) {
+	var held []Delivery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveriesBucket).ForEachBucket(func(k []byte) error {
+			deliveries, err := decodeDeliveries(tx.Bucket(deliveriesBucket).Bucket(k))
+			if err != nil {
+				return err
+			}
+			for _, delivery := range deliveries {
+				if delivery.State == DeliveryHeld && !delivery.ReleaseAt.After(until) {
+					held = append(held, delivery)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return held, nil
+}
+
+// GetPreferences returns the preferences of a service provider
+func (s *boltStorage) GetPreferences(ctx context.Context, serviceProviderID string) (preferences Preferences, found bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(preferencesBucket).Get([]byte(serviceProviderID))
+		if value == nil {
+			return nil
+		}
+		found = true
+		if err := json.Unmarshal(value, &preferences); err != nil {
+			return fmt.Errorf("failed to decode stored preferences: %w", err)
+		}
+		return nil
+	})
+	return preferences, found, err
+}
+
+// SavePreferences stores the preferences of a service provider
+func (s *boltStorage) SavePreferences(ctx context.Context, preferences Preferences) error {
+	value, err := json.Marshal(preferences)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(preferencesBucket).Put([]byte(preferences.ServiceProviderID), value)
+	})
+}
+
+// AddDigestEntry stores a digest entry unless the rating was collected or notified before
+func (s *boltStorage) AddDigestEntry(ctx context.Context, entry DigestEntry) (existing Notification, added bool, err error) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return Notification{}, false, err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if seq := tx.Bucket(idempotencyBucket).Get([]byte(ratingIdempotencyKey(entry.ServiceProviderID, entry.RatingID))); seq != nil {
+			existing, err = decodeNotification(tx.Bucket(notificationsBucket).Bucket([]byte(entry.ServiceProviderID)).Get(seq))
+			return err
+		}
+		entries, err := tx.Bucket(digestsBucket).CreateBucketIfNotExists([]byte(entry.ServiceProviderID))
+		if err != nil {
+			return err
+		}
+		if entries.Get([]byte(entry.RatingID)) != nil {
+			return nil
+		}
+		added = true
+		return entries.Put([]byte(entry.RatingID), value)
+	})
+	if err != nil {
+		return Notification{}, false, err
+	}
+	return existing, added, nil
+}
+
+// ListDigestServiceProviders returns the service providers with digest entries
+func (s *boltStorage) ListDigestServiceProviders(ctx context.Context) ([]string, error) {
+	serviceProviderIDs := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(digestsBucket).ForEachBucket(func(k []byte) error {
+			serviceProviderIDs = append(serviceProviderIDs, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serviceProviderIDs, nil
+}
+
+// GetDigestEntries returns the digest entries of a service provider created before the given time
+func (s *boltStorage) GetDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) ([]DigestEntry, error) {
+	entries := []DigestEntry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(digestsBucket).Bucket([]byte(serviceProviderID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var entry DigestEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("failed to decode stored digest entry: %w", err)
+			}
+			if entry.CreatedAt.Before(before) {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortDigestEntries(entries)
+	return entries, nil
+}
+
+// DeleteDigestEntries removes the digest entries of a service provider created before the given time
+func (s *boltStorage) DeleteDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(digestsBucket).Bucket([]byte(serviceProviderID))
+		if bucket == nil {
+			return nil
+		}
+		var keys [][]byte
+		remaining := 0
+		if err := bucket.ForEach(func(k, v []byte) error {
+			var entry DigestEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("failed to decode stored digest entry: %w", err)
+			}
+			if entry.CreatedAt.Before(before) {
+				keys = append(keys, append([]byte(nil), k...))
+			} else {
+				remaining++
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return tx.Bucket(digestsBucket).DeleteBucket([]byte(serviceProviderID))
+		}
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Cleanup removes notifications older than maxAge together with their idempotency keys and deliveries
+func (s *boltStorage) Cleanup(ctx context.Context, maxAge time.Duration) (err error) {
+	_, span := tracer.Start(ctx, "notification.Storage.Cleanup")
+	defer func() { tracing.End(span, err) }()
+
+	cutoff := time.Now().Add(-maxAge)
+	totalRemoved := 0
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(notificationsBucket)
+		keys := tx.Bucket(idempotencyBucket)
+		index := tx.Bucket(idsBucket)
+		deliveries := tx.Bucket(deliveriesBucket)
+
+		var providers [][]byte
+		if err := root.ForEachBucket(func(k []byte) error {
+			providers = append(providers, k)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, name := range providers {
+			provider := root.Bucket(name)
+			var expired [][]byte
+			err := provider.ForEach(func(k, v []byte) error {
+				notification, err := decodeNotification(v)
+				if err != nil {
+					return err
+				}
+				if notification.CreatedAt.After(cutoff) {
+					return nil
+				}
+				notificationDeliveries, err := decodeDeliveries(deliveries.Bucket([]byte(notification.ID)))
+				if err != nil {
+					return err
+				}
+				for _, delivery := range notificationDeliveries {
+					if delivery.State == DeliveryHeld {
+						return nil
+					}
+				}
+				expired = append(expired, k)
+				if err := index.Delete([]byte(notification.ID)); err != nil {
+					return err
+				}
+				if deliveries.Bucket([]byte(notification.ID)) != nil {
+					if err := deliveries.DeleteBucket([]byte(notification.ID)); err != nil {
+						return err
+					}
+				}
+				for _, key := range notification.IdempotencyKeys() {
+					if !bytes.Equal(keys.Get([]byte(key)), k) {
+						continue
+					}
+					if err := keys.Delete([]byte(key)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, k := range expired {
+				if err := provider.Delete(k); err != nil {
+					return err
+				}
+			}
+			// empty provider buckets are kept, as they hold the sequence number of the service provider
+			totalRemoved += len(expired)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if totalRemoved > 0 {
+		s.logger.With(ctx, "removed_notifications", totalRemoved, "cutoff", cutoff).
+			Info("Cleaned up old notifications")
+	}
+	return nil
+}
+
+// Close closes the database file.
+func (s *boltStorage) Close() error {
+	return s.db.Close()
+}
+
+// Ping opens a read transaction and checks that the buckets of the database exist. It fails once the database was
+// closed or when the database file cannot be read.
+func (s *boltStorage) Ping(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(notificationsBucket) == nil {
+			return fmt.Errorf("the %s bucket is missing", notificationsBucket)
+		}
+		return nil
+	})
+}
+
+// encodeSequence encodes a sequence number as a big-endian key so that keys sort in sequence order.
+func encodeSequence(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// storedNotification is the encoding of a stored notification, which includes the fields left out of responses.
+type storedNotification struct {
+	Notification
+	ServiceProviderEmail string `json:"serviceProviderEmail,omitempty"`
+}
+
+// putNotification encodes and stores a notification under the given key.
+func putNotification(bucket *bolt.Bucket, key []byte, notification Notification) error {
+	value, err := json.Marshal(storedNotification{Notification: notification, ServiceProviderEmail: notification.ServiceProviderEmail})
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, value)
+}
+
+// decodeNotification decodes a stored notification.
+func decodeNotification(value []byte) (Notification, error) {
+	var stored storedNotification
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return Notification{}, fmt.Errorf("failed to decode stored notification: %w", err)
+	}
+	stored.Notification.ServiceProviderEmail = stored.ServiceProviderEmail
+	return stored.Notification, nil
+}
+
+// decodeDeliveries decodes the deliveries of a notification from its bucket, which may be nil.
+func decodeDeliveries(bucket *bolt.Bucket) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	if bucket == nil {
+		return deliveries, nil
+	}
+	err := bucket.ForEach(func(k, v []byte) error {
+		var delivery Delivery
+		if err := json.Unmarshal(v, &delivery); err != nil {
+			return fmt.Errorf("failed to decode stored delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+		return nil
+	})
+	return deliveries, err
+}
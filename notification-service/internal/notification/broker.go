@@ -0,0 +1,136 @@
+package notification
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrTooManySubscribers is returned when a service provider already has the maximum number of subscriptions.
+	ErrTooManySubscribers = errors.New("too many subscribers")
+	// ErrBrokerClosed is returned when subscribing to a closed broker.
+	ErrBrokerClosed = errors.New("broker closed")
+	// ErrSubscriberTooSlow is the reason of a subscription closed because its buffer was full.
+	ErrSubscriberTooSlow = errors.New("subscriber too slow")
+)
+
+// Subscription receives the notifications published for a service provider.
+type Subscription struct {
+	// C receives the notifications. It is closed when the subscription is closed, either by Close, by closing the
+	// broker, or because the subscriber did not keep up with the published notifications.
+	C <-chan Notification
+
+	c      chan Notification
+	broker *Broker
+	key    string
+	once   sync.Once
+	err    error
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// Err returns why the broker closed the subscription: ErrBrokerClosed or ErrSubscriberTooSlow. It returns nil while
+// the subscription is open and after Close, and must only be called once C is closed.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Broker is an in-process pub/sub which fans out created notifications to the subscribers of their service provider.
+type Broker struct {
+	mu             sync.Mutex
+	subscribers    map[string]map[*Subscription]struct{} // map[serviceProviderID]subscriptions
+	maxSubscribers int
+	bufferSize     int
+	closed         bool
+}
+
+// NewBroker creates a broker which allows up to maxSubscribers subscriptions per service provider, each buffering up
+// to bufferSize notifications. A maxSubscribers of 0 means no limit.
+func NewBroker(maxSubscribers, bufferSize int) *Broker {
+	return &Broker{
+		subscribers:    make(map[string]map[*Subscription]struct{}),
+		maxSubscribers: maxSubscribers,
+		bufferSize:     bufferSize,
+	}
+}
+
+// Subscribe subscribes to the notifications of a service provider.
+func (b *Broker) Subscribe(serviceProviderID string) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	subscribers := b.subscribers[serviceProviderID]
+	if b.maxSubscribers > 0 && len(subscribers) >= b.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	if subscribers == nil {
+		subscribers = make(map[*Subscription]struct{})
+		b.subscribers[serviceProviderID] = subscribers
+	}
+
+	c := make(chan Notification, b.bufferSize)
+	s := &Subscription{C: c, c: c, broker: b, key: serviceProviderID}
+	subscribers[s] = struct{}{}
+	return s, nil
+}
+
+// Publish sends a notification to the subscribers of its service provider without blocking. A subscriber whose
+// buffer is full is unsubscribed, so that it can catch up from the storage instead of silently missing notifications.
+func (b *Broker) Publish(notification Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers[notification.ServiceProviderID] {
+		select {
+		case s.c <- notification:
+		default:
+			b.remove(s, ErrSubscriberTooSlow)
+		}
+	}
+}
+
+// Subscribers returns the number of subscriptions of a service provider.
+func (b *Broker) Subscribers(serviceProviderID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[serviceProviderID])
+}
+
+// Close closes all subscriptions and rejects new ones.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, subscribers := range b.subscribers {
+		for s := range subscribers {
+			b.remove(s, ErrBrokerClosed)
+		}
+	}
+}
+
+// unsubscribe removes a subscription.
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s, nil)
+}
+
+// remove removes a subscription and closes its channel for the given reason. The caller must hold the mutex.
+func (b *Broker) remove(s *Subscription, reason error) {
+	subscribers := b.subscribers[s.key]
+	delete(subscribers, s)
+	if len(subscribers) == 0 {
+		delete(b.subscribers, s.key)
+	}
+	s.once.Do(func() {
+		s.err = reason
+		close(s.c)
+	})
+}
@@ -0,0 +1,76 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker_Publish(t *testing.T) {
+	broker := NewBroker(0, 10)
+	first, err := broker.Subscribe("sp-1")
+	require.NoError(t, err)
+	second, err := broker.Subscribe("sp-1")
+	require.NoError(t, err)
+	other, err := broker.Subscribe("sp-2")
+	require.NoError(t, err)
+
+	broker.Publish(Notification{ID: "n1", ServiceProviderID: "sp-1"})
+
+	assert.Equal(t, "n1", (<-first.C).ID)
+	assert.Equal(t, "n1", (<-second.C).ID)
+	assert.Empty(t, other.C)
+
+	first.Close()
+	first.Close()
+	assert.Equal(t, 1, broker.Subscribers("sp-1"))
+	_, ok := <-first.C
+	assert.False(t, ok)
+	assert.NoError(t, first.Err())
+}
+
+func TestBroker_MaxSubscribers(t *testing.T) {
+	broker := NewBroker(1, 10)
+	subscription, err := broker.Subscribe("sp-1")
+	require.NoError(t, err)
+
+	_, err = broker.Subscribe("sp-1")
+	assert.ErrorIs(t, err, ErrTooManySubscribers)
+	_, err = broker.Subscribe("sp-2")
+	assert.NoError(t, err)
+
+	subscription.Close()
+	_, err = broker.Subscribe("sp-1")
+	assert.NoError(t, err)
+}
+
+func TestBroker_DropsSlowSubscribers(t *testing.T) {
+	broker := NewBroker(0, 1)
+	subscription, err := broker.Subscribe("sp-1")
+	require.NoError(t, err)
+
+	broker.Publish(Notification{ID: "n1", ServiceProviderID: "sp-1"})
+	broker.Publish(Notification{ID: "n2", ServiceProviderID: "sp-1"})
+
+	assert.Equal(t, "n1", (<-subscription.C).ID)
+	_, ok := <-subscription.C
+	assert.False(t, ok, "the subscription is closed once its buffer overflows")
+	assert.ErrorIs(t, subscription.Err(), ErrSubscriberTooSlow)
+	assert.Equal(t, 0, broker.Subscribers("sp-1"))
+}
+
+func TestBroker_Close(t *testing.T) {
+	broker := NewBroker(0, 1)
+	subscription, err := broker.Subscribe("sp-1")
+	require.NoError(t, err)
+
+	broker.Close()
+	_, ok := <-subscription.C
+	assert.False(t, ok)
+	assert.ErrorIs(t, subscription.Err(), ErrBrokerClosed)
+	subscription.Close()
+
+	_, err = broker.Subscribe("sp-1")
+	assert.ErrorIs(t, err, ErrBrokerClosed)
+}
@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"sync"
+	"time"
+)
+
+// bursts tracks the coalescing windows of the service providers. The first rating of a burst is notified right away
+// and opens a window; the ratings within the window are collected and notified together when it ends, which opens
+// the next window.
+type bursts struct {
+	mu      sync.Mutex
+	window  time.Duration
+	windows map[string]time.Time // map[serviceProviderID]end of the window
+}
+
+// newBursts creates the coalescing windows of the given length.
+func newBursts(window time.Duration) *bursts {
+	return &bursts{window: window, windows: make(map[string]time.Time)}
+}
+
+// lead reports whether a rating of the service provider at the given time leads a burst and is notified right away,
+// and opens a window in that case. Ratings within an open window are coalesced instead.
+func (b *bursts) lead(serviceProviderID string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if end, ok := b.windows[serviceProviderID]; ok && now.Before(end) {
+		return false
+	}
+	b.windows[serviceProviderID] = now.Add(b.window)
+	return true
+}
+
+// end returns the end of the window of the service provider, or the zero time when it has no window.
+func (b *bursts) end(serviceProviderID string) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.windows[serviceProviderID]
+}
+
+// open opens a window of the service provider at the given time.
+func (b *bursts) open(serviceProviderID string, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.windows[serviceProviderID] = now.Add(b.window)
+}
+
+// prune removes the windows which ended by the given time.
+func (b *bursts) prune(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for serviceProviderID, end := range b.windows {
+		if !now.Before(end) {
+			delete(b.windows, serviceProviderID)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package notification
+
+import (
+	"context"
+	"errors"
+)
+
+// Channel names
+const (
+	// ChannelInApp pushes notifications to the provider dashboard: open streams, WebSocket connections and long polls.
+	ChannelInApp = "in_app"
+	// ChannelWebhook posts notifications to the webhook endpoints of the service provider.
+	ChannelWebhook = "webhook"
+	// ChannelEmail emails notifications to the service provider.
+	ChannelEmail = "email"
+	// ChannelSMS sends notifications by text message.
+	ChannelSMS = "sms"
+)
+
+// ErrChannelSkipped is returned by channels which do not deliver a notification, e.g. because the service provider
+// has no address for the channel. Wrap it to give the reason.
+var ErrChannelSkipped = errors.New("skipped")
+
+// Channel delivers notifications to service providers through one medium. Send is called by the dispatcher with
+// retries and behind a circuit breaker, so it makes a single attempt.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, notification Notification) error
+}
+
+// RecipientGuard is implemented by channels which guard every recipient with its own circuit breaker, such as the
+// webhook channel with one per endpoint. The dispatcher does not put them behind a circuit breaker for the whole
+// channel, so that one failing recipient does not stop the deliveries to all others.
+type RecipientGuard interface {
+	GuardsRecipients() bool
+}
+
+// PermanentError is a delivery failure which retrying cannot fix, such as a rejected recipient.
+type PermanentError struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks a delivery failure as permanent, so that the dispatcher does not retry it and it does not count
+// against the circuit breaker of the channel. It returns nil for a nil error.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// inAppChannel records the deliveries of notifications to the provider dashboard. The notifications are published to
+// the streams and long polls as soon as they are stored, so that fetching, streaming and long polling agree, and the
+// channel has nothing left to send.
+type inAppChannel struct{}
+
+// Name returns the channel name
+func (c inAppChannel) Name() string {
+	return ChannelInApp
+}
+
+// Send reports the notification as delivered, since it was published when it was stored
+func (c inAppChannel) Send(ctx context.Context, n Notification) error {
+	return nil
+}
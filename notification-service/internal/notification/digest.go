@@ -0,0 +1,207 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
+	"github.com/google/uuid"
+)
+
+// maxDigestLowestRatings is the number of lowest ratings listed in a digest.
+const maxDigestLowestRatings = 3
+
+// sendDigests creates and dispatches the digest notifications of the periods and the coalesced notifications of the
+// coalescing windows which ended by the given time.
+func (s *service) sendDigests(ctx context.Context, now time.Time) {
+	s.bursts.prune(now)
+	serviceProviderIDs, err := s.storage.ListDigestServiceProviders(ctx)
+	if err != nil {
+		s.logger.With(ctx, "error", err).Error("Failed to list the service providers with digest entries")
+		return
+	}
+	for _, serviceProviderID := range serviceProviderIDs {
+		if err := s.sendDigest(ctx, serviceProviderID, now); err != nil {
+			s.logger.With(ctx, "error", err, "service_provider_id", serviceProviderID).Error("Failed to send digest")
+		}
+	}
+}
+
+// sendDigest creates and dispatches the digest of a service provider when its period ended. The ratings of service
+// providers without digests are coalesced instead.
+func (s *service) sendDigest(ctx context.Context, serviceProviderID string, now time.Time) error {
+	preferences, err := s.GetPreferences(ctx, serviceProviderID)
+	if err != nil {
+		return err
+	}
+	if preferences.Digest == nil {
+		return s.sendCoalesced(ctx, *preferences, now)
+	}
+
+	periodEnd := preferences.Digest.periodStart(now)
+	entries, err := s.getDigestEntries(ctx, serviceProviderID, periodEnd)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	notification := newDigestNotification(s.messages, preferences.Locale, serviceProviderID, *preferences.Digest, entries, periodEnd)
+	return s.summarize(ctx, notification, *preferences, periodEnd, now)
+}
+
+// sendCoalesced creates and dispatches a notification for the ratings of a service provider collected while its
+// coalescing window was open, once the window ended, and opens the next window. The ratings left over when a service
+// provider turned digests off are coalesced right away, even without a window.
+func (s *service) sendCoalesced(ctx context.Context, preferences Preferences, now time.Time) error {
+	if now.Before(s.bursts.end(preferences.ServiceProviderID)) {
+		return nil
+	}
+	entries, err := s.getDigestEntries(ctx, preferences.ServiceProviderID, now)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	notification := newCoalescedNotification(s.messages, preferences.Locale, preferences.ServiceProviderID, entries)
+	if err := s.summarize(ctx, notification, preferences, now, now); err != nil {
+		return err
+	}
+	if s.coalescingWindow > 0 {
+		// the ratings following a coalesced notification are coalesced as well, so that a long burst is notified
+		// once per window
+		s.bursts.open(preferences.ServiceProviderID, now)
+	}
+	return nil
+}
+
+// getDigestEntries returns the digest entries of a service provider created before the given time with circuit
+// breaker and retry logic.
+func (s *service) getDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) ([]DigestEntry, error) {
+	var entries []DigestEntry
+
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		entries, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) ([]DigestEntry, error) {
+			return s.storage.GetDigestEntries(ctx, serviceProviderID, before)
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest entries: %w", err)
+	}
+	return entries, nil
+}
+
+// summarize stores and dispatches a notification summarizing the digest entries created before the given time, and
+// removes the entries. A notification which was stored before its entries could be removed is not created again.
+func (s *service) summarize(ctx context.Context, notification Notification, preferences Preferences, before, now time.Time) error {
+	notification, created, err := s.storeNotification(ctx, notification)
+	if err != nil {
+		return err
+	}
+	if created {
+		s.logger.With(ctx, "notification_id", notification.ID, "service_provider_id", notification.ServiceProviderID, "type", notification.Type).
+			Info("Created summary notification")
+		s.publish(notification)
+		s.dispatcher.dispatch(ctx, notification, preferences, now)
+	}
+
+	err = s.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
+		return retry.WithRetry(ctx, s.retryConfig, func(ctx context.Context) error {
+			return s.storage.DeleteDigestEntries(ctx, notification.ServiceProviderID, before)
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete digest entries: %w", err)
+	}
+	return nil
+}
+
+// newDigestNotification creates the digest notification summarizing the given entries of a period ending at
+// periodEnd, with the message in the given locale.
+func newDigestNotification(messages *Messages, locale, serviceProviderID string, preferences DigestPreferences, entries []DigestEntry, periodEnd time.Time) Notification {
+	digest := Digest{
+		Frequency:   preferences.Frequency,
+		PeriodStart: preferences.previousPeriodStart(periodEnd),
+		PeriodEnd:   periodEnd,
+		Count:       len(entries),
+	}
+
+	total := 0
+	email := ""
+	ratingIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		total += entry.Rating
+		ratingIDs = append(ratingIDs, entry.RatingID)
+		if entry.CreatedAt.Before(digest.PeriodStart) {
+			// entries of earlier periods are left over when no digest could be sent for them
+			digest.PeriodStart = entry.CreatedAt
+		}
+		if entry.ServiceProviderEmail != "" {
+			email = entry.ServiceProviderEmail
+		}
+	}
+	digest.AverageRating = float64(total) / float64(len(entries))
+
+	lowest := append([]DigestEntry(nil), entries...)
+	sort.SliceStable(lowest, func(i, j int) bool {
+		return lowest[i].Rating < lowest[j].Rating
+	})
+	lowest = lowest[:min(len(lowest), maxDigestLowestRatings)]
+	for i := range lowest {
+		// the service provider is the recipient of the digest
+		lowest[i].ServiceProviderID = ""
+		lowest[i].ServiceProviderEmail = ""
+	}
+	digest.LowestRatings = lowest
+
+	return Notification{
+		ID:                   uuid.New().String(),
+		ServiceProviderID:    serviceProviderID,
+		ServiceProviderEmail: email,
+		Type:                 EventRatingDigest,
+		State:                StateUnread,
+		Message:              messages.render(EventRatingDigest, locale, digestMessageData(&digest)),
+		RatingIDs:            ratingIDs,
+		Digest:               &digest,
+		CreatedAt:            time.Now(),
+	}
+}
+
+// newCoalescedNotification creates the notification of a burst of ratings with the message in the given locale. The
+// notification of a single rating is the same as without coalescing.
+func newCoalescedNotification(messages *Messages, locale, serviceProviderID string, entries []DigestEntry) Notification {
+	if len(entries) == 1 {
+		return newNotification(messages, locale, RatingNotificationRequest{
+			ServiceProviderID:    serviceProviderID,
+			ServiceProviderEmail: entries[0].ServiceProviderEmail,
+			RatingID:             entries[0].RatingID,
+			Rating:               entries[0].Rating,
+			CustomerName:         entries[0].CustomerName,
+			Comment:              entries[0].Comment,
+			Data:                 entries[0].Data,
+		})
+	}
+
+	ratingIDs := make([]string, 0, len(entries))
+	total := 0
+	email := ""
+	for _, entry := range entries {
+		ratingIDs = append(ratingIDs, entry.RatingID)
+		total += entry.Rating
+		if entry.ServiceProviderEmail != "" {
+			email = entry.ServiceProviderEmail
+		}
+	}
+
+	average := float64(total) / float64(len(entries))
+	return Notification{
+		ID:                   uuid.New().String(),
+		ServiceProviderID:    serviceProviderID,
+		ServiceProviderEmail: email,
+		Type:                 EventRatingCreated,
+		State:                StateUnread,
+		Message:              messages.render(EventRatingCreated, locale, MessageData{Count: len(entries), AverageRating: average}),
+		RatingIDs:            ratingIDs,
+		Data:                 map[string]interface{}{"count": len(entries), "averageRating": average},
+		CreatedAt:            time.Now(),
+	}
+}
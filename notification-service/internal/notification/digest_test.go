@@ -0,0 +1,255 @@
+package notification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDigestNotification(t *testing.T) {
+	periodEnd := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	entries := []DigestEntry{
+		{ServiceProviderID: "sp-1", ServiceProviderEmail: "provider@example.com", RatingID: "r-1", Rating: 5, CreatedAt: periodEnd.Add(-20 * time.Hour)},
+		{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 2, CustomerName: "Jane", Comment: "Late", CreatedAt: periodEnd.Add(-10 * time.Hour)},
+		{ServiceProviderID: "sp-1", RatingID: "r-3", Rating: 4, CreatedAt: periodEnd.Add(-5 * time.Hour)},
+		{ServiceProviderID: "sp-1", RatingID: "r-4", Rating: 2, CreatedAt: periodEnd.Add(-time.Hour)},
+	}
+
+	n := newDigestNotification(defaultMessages, "", "sp-1", DigestPreferences{Frequency: DigestDaily, Timezone: "UTC"}, entries, periodEnd)
+	assert.Equal(t, EventRatingDigest, n.Type)
+	assert.Equal(t, StateUnread, n.State)
+	assert.Equal(t, "provider@example.com", n.ServiceProviderEmail)
+	assert.Empty(t, n.RatingID)
+	assert.Equal(t, []string{"r-1", "r-2", "r-3", "r-4"}, n.RatingIDs)
+	assert.Equal(t, "Daily digest: 4 new ratings, 3.2 stars on average", n.Message)
+	require.NotNil(t, n.Digest)
+	assert.Equal(t, DigestDaily, n.Digest.Frequency)
+	assert.True(t, periodEnd.AddDate(0, 0, -1).Equal(n.Digest.PeriodStart))
+	assert.True(t, periodEnd.Equal(n.Digest.PeriodEnd))
+	assert.Equal(t, 4, n.Digest.Count)
+	assert.InDelta(t, 3.25, n.Digest.AverageRating, 0.001)
+	require.Len(t, n.Digest.LowestRatings, maxDigestLowestRatings)
+	assert.Equal(t, "r-2", n.Digest.LowestRatings[0].RatingID, "ratings of the same value keep their order")
+	assert.Equal(t, "Late", n.Digest.LowestRatings[0].Comment)
+	assert.Equal(t, "r-4", n.Digest.LowestRatings[1].RatingID)
+	assert.Equal(t, "r-3", n.Digest.LowestRatings[2].RatingID)
+	assert.Empty(t, n.Digest.LowestRatings[0].ServiceProviderID, "the service provider is the recipient")
+	assert.Equal(t, "sp-1/2026-10-17T00:00:00Z/rating.digest", n.IdempotencyKey())
+
+	// entries of earlier periods which were not summarized yet extend the period
+	old := append([]DigestEntry{{ServiceProviderID: "sp-1", RatingID: "r-0", Rating: 1, CreatedAt: periodEnd.AddDate(0, 0, -3)}}, entries...)
+	n = newDigestNotification(defaultMessages, "", "sp-1", DigestPreferences{Frequency: DigestDaily, Timezone: "UTC"}, old, periodEnd)
+	assert.True(t, periodEnd.AddDate(0, 0, -3).Equal(n.Digest.PeriodStart))
+}
+
+func TestService_SendDigests(t *testing.T) {
+	logger, _ := log.NewForTest()
+	storage := NewInMemoryStorage(logger)
+	s := NewService(storage, circuitbreaker.NewRegistry(), logger, config.Config{Retry: retry.DefaultRetryConfig()}, defaultMessages)
+	email := &recordingChannel{name: ChannelEmail}
+	s.RegisterChannel(email, testChannelConfig())
+	ctx := context.Background()
+
+	_, err := s.UpdatePreferences(ctx, "sp-1", UpdatePreferencesRequest{
+		MinRating: 2,
+		Digest:    &DigestPreferences{Frequency: DigestDaily, Timezone: "UTC"},
+	})
+	require.NoError(t, err)
+
+	for i, req := range []RatingNotificationRequest{
+		{ServiceProviderID: "sp-1", ServiceProviderEmail: "provider@example.com", RatingID: "r-1", Rating: 5},
+		{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 2, CustomerName: "Jane", Comment: "Late"},
+		{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 2, CustomerName: "Jane", Comment: "Late"},
+		{ServiceProviderID: "sp-1", RatingID: "r-3", Rating: 4},
+	} {
+		resp, err := s.CreateNotification(ctx, req)
+		require.NoError(t, err)
+		assert.True(t, resp.Suppressed)
+		assert.Equal(t, i == 2, resp.Duplicate, "a rating sent again is collected once")
+		assert.Equal(t, "Notification collected for the daily digest", resp.Message)
+	}
+	resp, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-4", Rating: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "Notification suppressed: ratings below 2 stars are not notified", resp.Message, "the preferences filter before the digest")
+
+	count, err := s.CountUnread(ctx, "sp-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count.Unread, "collected ratings are not notified one by one")
+
+	// the digest of the day is sent once the day is over
+	now := time.Now().UTC()
+	s.(*service).sendDigests(ctx, now)
+	count, err = s.CountUnread(ctx, "sp-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count.Unread)
+
+	tomorrow := now.AddDate(0, 0, 1)
+	s.(*service).sendDigests(ctx, tomorrow)
+	s.(*service).sendDigests(ctx, tomorrow)
+	require.NoError(t, s.Close(ctx))
+
+	result, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp-1", Peek: true})
+	require.NoError(t, err)
+	require.Len(t, result.Notifications, 1, "a digest is sent once")
+	digest := result.Notifications[0]
+	assert.Equal(t, EventRatingDigest, digest.Type)
+	assert.Equal(t, "provider@example.com", digest.ServiceProviderEmail)
+	require.NotNil(t, digest.Digest)
+	assert.Equal(t, 3, digest.Digest.Count)
+	assert.InDelta(t, 11.0/3, digest.Digest.AverageRating, 0.001)
+	assert.Equal(t, "r-2", digest.Digest.LowestRatings[0].RatingID)
+	assert.True(t, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Equal(digest.Digest.PeriodStart))
+	assert.Equal(t, []string{digest.ID}, email.sent(), "the digest is dispatched through the channels")
+
+	entries, err := storage.GetDigestEntries(ctx, "sp-1", tomorrow)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the summarized entries are removed")
+	serviceProviderIDs, err := storage.ListDigestServiceProviders(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, serviceProviderIDs)
+
+	// a rating sent again after its digest is not collected for the next one
+	resp, err = s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-3", Rating: 4})
+	require.NoError(t, err)
+	assert.True(t, resp.Duplicate)
+	assert.False(t, resp.Suppressed)
+	assert.Equal(t, digest.ID, resp.ID)
+	serviceProviderIDs, err = storage.ListDigestServiceProviders(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, serviceProviderIDs)
+}
+
+func TestService_SendDigests_DigestTurnedOff(t *testing.T) {
+	logger, _ := log.NewForTest()
+	storage := NewInMemoryStorage(logger)
+	s := NewService(storage, circuitbreaker.NewRegistry(), logger, config.Config{Retry: retry.DefaultRetryConfig()}, defaultMessages)
+	ctx := context.Background()
+
+	_, err := s.UpdatePreferences(ctx, "sp-1", UpdatePreferencesRequest{Digest: &DigestPreferences{Frequency: DigestWeekly, Timezone: "UTC"}})
+	require.NoError(t, err)
+	resp, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 3})
+	require.NoError(t, err)
+	assert.True(t, resp.Suppressed)
+
+	_, err = s.UpdatePreferences(ctx, "sp-1", UpdatePreferencesRequest{})
+	require.NoError(t, err)
+	resp, err = s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 3})
+	require.NoError(t, err)
+	assert.False(t, resp.Suppressed)
+
+	// the collected ratings are notified right away
+	s.(*service).sendDigests(ctx, time.Now())
+	require.NoError(t, s.Close(ctx))
+	result, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp-1", Peek: true})
+	require.NoError(t, err)
+	require.Len(t, result.Notifications, 2)
+	assert.Equal(t, EventRatingCreated, result.Notifications[1].Type)
+	assert.Equal(t, "r-1", result.Notifications[1].RatingID)
+	assert.Equal(t, "New 3-star rating received", result.Notifications[1].Message)
+}
+
+func TestNewCoalescedNotification(t *testing.T) {
+	entries := []DigestEntry{
+		{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 5, CustomerName: "Jane", Comment: "Great", Data: map[string]interface{}{"bookingId": "b-1"}},
+		{ServiceProviderID: "sp-1", ServiceProviderEmail: "provider@example.com", RatingID: "r-2", Rating: 4},
+		{ServiceProviderID: "sp-1", RatingID: "r-3", Rating: 4},
+		{ServiceProviderID: "sp-1", RatingID: "r-4", Rating: 3},
+		{ServiceProviderID: "sp-1", RatingID: "r-5", Rating: 5},
+	}
+
+	n := newCoalescedNotification(defaultMessages, "", "sp-1", entries)
+	assert.Equal(t, EventRatingCreated, n.Type)
+	assert.Equal(t, "5 new ratings, average 4.2", n.Message)
+	assert.Empty(t, n.RatingID)
+	assert.Equal(t, []string{"r-1", "r-2", "r-3", "r-4", "r-5"}, n.RatingIDs)
+	assert.Equal(t, "provider@example.com", n.ServiceProviderEmail)
+	assert.Equal(t, "sp-1/r-1/rating.created", n.IdempotencyKey())
+	assert.Equal(t, map[string]interface{}{"count": 5, "averageRating": 4.2}, n.Data)
+
+	// a single rating is notified as without coalescing
+	n = newCoalescedNotification(defaultMessages, "", "sp-1", entries[:1])
+	assert.Equal(t, `New 5-star rating received from Jane: "Great"`, n.Message)
+	assert.Equal(t, "r-1", n.RatingID)
+	assert.Empty(t, n.RatingIDs)
+	assert.Equal(t, 5, n.Rating)
+	assert.Equal(t, map[string]interface{}{"bookingId": "b-1"}, n.Data)
+}
+
+func TestService_Coalescing(t *testing.T) {
+	logger, _ := log.NewForTest()
+	storage := NewInMemoryStorage(logger)
+	cfg := config.Config{Retry: retry.DefaultRetryConfig(), Coalescing: config.CoalescingConfig{Window: time.Minute}}
+	s := NewService(storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+	ctx := context.Background()
+	create := func(ratingID string) *CreateNotificationResponse {
+		resp, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: ratingID, Rating: 3})
+		require.NoError(t, err)
+		return resp
+	}
+
+	// the first rating of a burst is notified right away and opens the window
+	start := time.Now()
+	resp := create("r-1")
+	assert.NotEmpty(t, resp.ID)
+	assert.False(t, resp.Coalesced)
+	resp = create("r-other")
+	assert.True(t, resp.Coalesced)
+	assert.False(t, resp.Suppressed)
+	assert.Empty(t, resp.ID)
+	assert.Equal(t, "Notification coalesced with the ratings within 1m0s", resp.Message)
+	other, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-2", RatingID: "r-2", Rating: 5})
+	require.NoError(t, err)
+	assert.NotEmpty(t, other.ID, "every service provider has its own window")
+	create("r-3")
+
+	s.(*service).sendDigests(ctx, start.Add(30*time.Second))
+	count, err := s.CountUnread(ctx, "sp-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count.Unread, "the window is open")
+
+	// the ratings of the window are notified together when it ends, and the next window opens
+	s.(*service).sendDigests(ctx, start.Add(90*time.Second))
+	resp = create("r-4")
+	assert.True(t, resp.Coalesced, "the ratings following a coalesced notification are coalesced")
+	s.(*service).sendDigests(ctx, start.Add(120*time.Second))
+	s.(*service).sendDigests(ctx, start.Add(150*time.Second))
+
+	// once the windows ended, the next rating is notified right away
+	s.(*service).sendDigests(ctx, start.Add(300*time.Second))
+	assert.Empty(t, s.(*service).bursts.windows)
+	resp = create("r-5")
+	assert.NotEmpty(t, resp.ID)
+	require.NoError(t, s.Close(ctx))
+
+	result, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp-1", Peek: true})
+	require.NoError(t, err)
+	require.Len(t, result.Notifications, 4)
+	assert.Equal(t, "r-1", result.Notifications[0].RatingID)
+	assert.Equal(t, "2 new ratings, average 3.0", result.Notifications[1].Message)
+	assert.Equal(t, []string{"r-other", "r-3"}, result.Notifications[1].RatingIDs)
+	assert.Equal(t, "New 3-star rating received", result.Notifications[2].Message, "a rating alone in its window is notified as usual")
+	assert.Equal(t, "r-4", result.Notifications[2].RatingID)
+	assert.Equal(t, "r-5", result.Notifications[3].RatingID)
+
+	// the rating service sends ratings again when it does not know whether they arrived
+	replays := map[string]string{"r-1": result.Notifications[0].ID, "r-3": result.Notifications[1].ID, "r-4": result.Notifications[2].ID}
+	for ratingID, notificationID := range replays {
+		resp = create(ratingID)
+		assert.True(t, resp.Duplicate, ratingID)
+		assert.Equal(t, notificationID, resp.ID, ratingID)
+	}
+	_, _, err = storage.AddDigestEntry(ctx, DigestEntry{ServiceProviderID: "sp-1", RatingID: "r-6", Rating: 3, CreatedAt: time.Now()})
+	require.NoError(t, err)
+	s.(*service).bursts.open("sp-1", time.Now())
+	resp = create("r-6")
+	assert.True(t, resp.Duplicate, "the rating waits for its window")
+	assert.True(t, resp.Coalesced)
+	assert.Empty(t, resp.ID)
+}
@@ -0,0 +1,295 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrDispatchQueueFull is the error of a delivery which did not fit in the queue of its channel.
+	ErrDispatchQueueFull = errors.New("the channel queue is full")
+	// ErrDispatcherClosed is the error of a delivery dispatched after the dispatcher was closed.
+	ErrDispatcherClosed = errors.New("the dispatcher is closed")
+)
+
+// dispatcher fans the created notifications out to the registered channels. Every channel has its own queue and
+// workers, so that a slow channel does not delay the others, and its own retry and circuit breaker settings.
+// The state of every delivery is recorded in the storage.
+type dispatcher struct {
+	storage  Storage
+	breakers *circuitbreaker.Registry
+	logger   log.Logger
+
+	// mu guards channels and closed; dispatchers hold the read lock so that no queue is closed under them
+	mu       sync.RWMutex
+	channels []*channelWorker
+	closed   bool
+	workers  sync.WaitGroup
+}
+
+// channelWorker delivers the queued notifications of a channel.
+type channelWorker struct {
+	channel Channel
+	config  config.ChannelConfig
+	// breaker is nil for channels which guard their recipients themselves
+	breaker *circuitbreaker.CircuitBreaker
+	queue   chan queuedNotification
+}
+
+// queuedNotification is a notification waiting in the queue of a channel. It is delivered with a context which is not
+// cancelled with the one it was dispatched with but keeps its values, such as the request ID and the trace context.
+type queuedNotification struct {
+	ctx          context.Context
+	notification Notification
+}
+
+// newDispatcher creates a dispatcher without channels.
+func newDispatcher(storage Storage, breakers *circuitbreaker.Registry, logger log.Logger) *dispatcher {
+	return &dispatcher{storage: storage, breakers: breakers, logger: logger}
+}
+
+// register adds a channel and starts its workers. The circuit breaker of the channel is registered as
+// "channel:<name>".
+func (d *dispatcher) register(channel Channel, cfg config.ChannelConfig) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Retry.MaxAttempts == 0 {
+		cfg.Retry = retry.DefaultRetryConfig()
+	}
+	if cfg.CircuitBreaker == (circuitbreaker.Config{}) {
+		cfg.CircuitBreaker = circuitbreaker.DefaultConfig()
+	}
+
+	w := &channelWorker{channel: channel, config: cfg, queue: make(chan queuedNotification, cfg.QueueSize)}
+	if guard, ok := channel.(RecipientGuard); !ok || !guard.GuardsRecipients() {
+		w.breaker = d.breakers.New("channel:"+channel.Name(), cfg.CircuitBreaker, d.logger)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.channels = append(d.channels, w)
+	for range cfg.Workers {
+		d.workers.Add(1)
+		go d.work(w)
+	}
+}
+
+// dispatch records a delivery of a notification for every channel according to the preferences of its service
+// provider at the given time: deliveries through disabled channels are skipped, the ones during quiet hours are held
+// until they end, and the others are queued without blocking.
+func (d *dispatcher) dispatch(ctx context.Context, n Notification, preferences Preferences, now time.Time) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	releaseAt, quiet := preferences.QuietHours.releaseAt(now)
+	for _, w := range d.channels {
+		delivery := Delivery{
+			NotificationID:    n.ID,
+			ServiceProviderID: n.ServiceProviderID,
+			Channel:           w.channel.Name(),
+			State:             DeliveryPending,
+			UpdatedAt:         time.Now(),
+		}
+		switch {
+		case !preferences.ChannelEnabled(delivery.Channel):
+			delivery.State = DeliverySkipped
+			delivery.Error = fmt.Errorf("%w: the channel is disabled by the preferences", ErrChannelSkipped).Error()
+			d.saveDelivery(ctx, delivery)
+		case quiet:
+			delivery.State = DeliveryHeld
+			delivery.ReleaseAt = &releaseAt
+			d.saveDelivery(ctx, delivery)
+		default:
+			d.enqueue(ctx, w, n, delivery)
+		}
+	}
+}
+
+// release queues the held deliveries which are due at the given time.
+func (d *dispatcher) release(ctx context.Context, now time.Time) {
+	held, err := d.storage.ListHeldDeliveries(ctx, now)
+	if err != nil {
+		d.logger.With(ctx, "error", err).Error("Failed to list held notification deliveries")
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, delivery := range held {
+		delivery.State = DeliveryPending
+		delivery.ReleaseAt = nil
+		delivery.UpdatedAt = time.Now()
+
+		n, err := d.storage.GetNotification(ctx, delivery.ServiceProviderID, delivery.NotificationID)
+		w := d.worker(delivery.Channel)
+		if err == nil && w == nil {
+			err = fmt.Errorf("the %s channel is not registered", delivery.Channel)
+		}
+		if err != nil {
+			d.logger.With(ctx, "error", err, "notification_id", delivery.NotificationID, "channel", delivery.Channel).
+				Error("Failed to release notification delivery")
+			delivery.State = DeliveryFailed
+			delivery.Error = err.Error()
+			d.saveDelivery(ctx, delivery)
+			continue
+		}
+		d.enqueue(ctx, w, n, delivery)
+	}
+	if len(held) > 0 {
+		d.logger.With(ctx, "deliveries", len(held)).Info("Released held notification deliveries")
+	}
+}
+
+// enqueue records a pending delivery and queues its notification without blocking. A delivery which cannot be
+// queued is recorded as failed. The caller holds the read lock.
+func (d *dispatcher) enqueue(ctx context.Context, w *channelWorker, n Notification, delivery Delivery) {
+	err := ErrDispatcherClosed
+	if !d.closed {
+		d.saveDelivery(ctx, delivery)
+		select {
+		case w.queue <- queuedNotification{ctx: context.WithoutCancel(ctx), notification: n}:
+			return
+		default:
+			err = ErrDispatchQueueFull
+		}
+	}
+
+	d.logger.With(ctx, "error", err, "notification_id", n.ID, "channel", delivery.Channel).
+		Error("Failed to queue notification delivery")
+	delivery.State = DeliveryFailed
+	delivery.Error = err.Error()
+	d.saveDelivery(ctx, delivery)
+}
+
+// worker returns the worker of a channel, or nil when the channel is not registered. The caller holds the read lock.
+func (d *dispatcher) worker(channel string) *channelWorker {
+	for _, w := range d.channels {
+		if w.channel.Name() == channel {
+			return w
+		}
+	}
+	return nil
+}
+
+// close stops accepting notifications and waits until the queued ones are delivered or the context is done.
+func (d *dispatcher) close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, w := range d.channels {
+			close(w.queue)
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work delivers the queued notifications of a channel until its queue is closed.
+func (d *dispatcher) work(w *channelWorker) {
+	defer d.workers.Done()
+	for queued := range w.queue {
+		d.deliver(queued.ctx, w, queued.notification)
+	}
+}
+
+// deliver sends a notification through a channel with retries and behind the circuit breaker of the channel,
+// and records the outcome. Skipped and permanently failed deliveries are neither retried nor counted against the
+// circuit breaker.
+func (d *dispatcher) deliver(ctx context.Context, w *channelWorker, n Notification) {
+	ctx, span := tracer.Start(ctx, "notification.deliver")
+	span.SetAttributes(
+		attribute.String("notification.id", n.ID),
+		attribute.String("notification.channel", w.channel.Name()),
+	)
+
+	delivery := Delivery{
+		NotificationID:    n.ID,
+		ServiceProviderID: n.ServiceProviderID,
+		Channel:           w.channel.Name(),
+	}
+	var sendErr error
+	send := func(ctx context.Context) error {
+		return retry.WithRetry(ctx, w.config.Retry, func(ctx context.Context) error {
+			delivery.Attempts++
+			ctx, cancel := context.WithTimeout(ctx, w.config.Timeout)
+			defer cancel()
+			sendErr = w.channel.Send(ctx, n)
+			if errors.Is(sendErr, ErrChannelSkipped) || isPermanent(sendErr) {
+				return nil
+			}
+			return sendErr
+		}, func(error) bool { return true }, d.logger)
+	}
+	var err error
+	if w.breaker != nil {
+		err = w.breaker.Execute(ctx, send)
+	} else {
+		err = send(ctx)
+	}
+	// report the last failure of the channel rather than the retry summary
+	if sendErr != nil {
+		err = sendErr
+	}
+
+	delivery.UpdatedAt = time.Now()
+	logger := d.logger.With(ctx, "notification_id", n.ID, "channel", delivery.Channel, "attempts", delivery.Attempts)
+	switch {
+	case err == nil:
+		delivery.State = DeliverySucceeded
+		logger.Debug("Delivered notification")
+	case errors.Is(err, ErrChannelSkipped):
+		delivery.State = DeliverySkipped
+		delivery.Error = err.Error()
+		err = nil
+		logger.With(ctx, "reason", delivery.Error).Debug("Skipped notification delivery")
+	default:
+		delivery.State = DeliveryFailed
+		delivery.Error = err.Error()
+		logger.With(ctx, "error", err).Error("Failed to deliver notification")
+	}
+	tracing.End(span, err)
+	d.saveDelivery(ctx, delivery)
+}
+
+// saveDelivery records a delivery, logging failures since there is nobody to report them to.
+func (d *dispatcher) saveDelivery(ctx context.Context, delivery Delivery) {
+	if err := d.storage.SaveDelivery(ctx, delivery); err != nil {
+		d.logger.With(ctx, "error", err, "notification_id", delivery.NotificationID, "channel", delivery.Channel).
+			Error("Failed to save notification delivery")
+	}
+}
+
+// isPermanent reports whether a delivery failure is permanent.
+func isPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
@@ -0,0 +1,231 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingChannel records the notifications it delivers and fails with the given errors in turn.
+type recordingChannel struct {
+	name   string
+	guards bool
+	mu     sync.Mutex
+	errs   []error
+	ids    []string
+}
+
+func (c *recordingChannel) Name() string {
+	return c.name
+}
+
+func (c *recordingChannel) Send(ctx context.Context, n Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	c.ids = append(c.ids, n.ID)
+	return nil
+}
+
+func (c *recordingChannel) GuardsRecipients() bool {
+	return c.guards
+}
+
+// sent returns the IDs of the delivered notifications.
+func (c *recordingChannel) sent() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.ids...)
+}
+
+// testChannelConfig returns channel settings with short retry delays whose circuit breaker opens on the first failure.
+func testChannelConfig() config.ChannelConfig {
+	return config.ChannelConfig{
+		Workers:   1,
+		QueueSize: 10,
+		Timeout:   time.Second,
+		Retry: retry.RetryConfig{
+			MaxAttempts:   3,
+			InitialDelay:  time.Millisecond,
+			MaxDelay:      5 * time.Millisecond,
+			BackoffFactor: 2,
+		},
+		CircuitBreaker: circuitbreaker.Config{
+			FailureThreshold: 1,
+			RecoveryTimeout:  time.Hour,
+			MinimumRequests:  1,
+		},
+	}
+}
+
+func TestService_Dispatch(t *testing.T) {
+	transient := errors.New("connection refused")
+	tests := []struct {
+		name         string
+		errs         []error
+		wantState    string
+		wantAttempts int
+		wantError    string
+	}{
+		{"delivered", nil, DeliverySucceeded, 1, ""},
+		{"transient failure", []error{transient}, DeliverySucceeded, 2, ""},
+		{"persistent failure", []error{transient, transient, transient}, DeliveryFailed, 3, "connection refused"},
+		{"permanent failure", []error{Permanent(errors.New("mailbox unavailable"))}, DeliveryFailed, 1, "mailbox unavailable"},
+		{"skipped", []error{fmt.Errorf("%w: no email address", ErrChannelSkipped)}, DeliverySkipped, 1, "skipped: no email address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := log.NewForTest()
+			s := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, config.Config{Retry: retry.DefaultRetryConfig()}, defaultMessages)
+			s.RegisterChannel(&recordingChannel{name: ChannelEmail, errs: tt.errs}, testChannelConfig())
+			ctx := context.Background()
+
+			resp, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 5})
+			require.NoError(t, err)
+			require.NoError(t, s.Close(ctx))
+
+			deliveries, err := s.GetDeliveries(ctx, "sp-1", resp.ID)
+			require.NoError(t, err)
+			require.Len(t, deliveries, 2)
+			assert.Equal(t, ChannelEmail, deliveries[0].Channel)
+			assert.Equal(t, tt.wantState, deliveries[0].State)
+			assert.Equal(t, tt.wantAttempts, deliveries[0].Attempts)
+			assert.Equal(t, tt.wantError, deliveries[0].Error)
+			assert.Equal(t, ChannelInApp, deliveries[1].Channel)
+			assert.Equal(t, DeliverySucceeded, deliveries[1].State)
+
+			_, err = s.GetDeliveries(ctx, "sp-2", resp.ID)
+			assert.ErrorIs(t, err, ErrNotFound, "the notifications of other service providers are not found")
+			_, err = s.GetDeliveries(ctx, "sp-1", "unknown")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestService_Dispatch_CircuitBreaker(t *testing.T) {
+	failure := errors.New("connection refused")
+	tests := []struct {
+		name        string
+		guards      bool
+		wantBreaker bool
+		wantState   string
+	}{
+		{"channel circuit breaker opens", false, true, DeliveryFailed},
+		{"recipient guard has no channel circuit breaker", true, false, DeliverySucceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := log.NewForTest()
+			breakers := circuitbreaker.NewRegistry()
+			s := NewService(NewInMemoryStorage(logger), breakers, logger, config.Config{Retry: retry.DefaultRetryConfig()}, defaultMessages)
+			channel := &recordingChannel{name: ChannelWebhook, guards: tt.guards, errs: []error{failure, failure, failure}}
+			s.RegisterChannel(channel, testChannelConfig())
+			ctx := context.Background()
+
+			first, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 5})
+			require.NoError(t, err)
+			// wait for the first delivery to fail before dispatching the next one
+			require.Eventually(t, func() bool {
+				deliveries, _ := s.GetDeliveries(ctx, "sp-1", first.ID)
+				return len(deliveries) == 2 && deliveries[1].State == DeliveryFailed
+			}, time.Second, 5*time.Millisecond)
+			second, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 5})
+			require.NoError(t, err)
+			require.NoError(t, s.Close(ctx))
+
+			_, ok := breakers.Get("channel:" + ChannelWebhook)
+			assert.Equal(t, tt.wantBreaker, ok)
+			deliveries, err := s.GetDeliveries(ctx, "sp-1", second.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantState, deliveries[1].State)
+		})
+	}
+}
+
+func TestService_Dispatch_Closed(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, config.Config{Retry: retry.DefaultRetryConfig()}, defaultMessages)
+	ctx := context.Background()
+	require.NoError(t, s.Close(ctx))
+
+	resp, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 5})
+	require.NoError(t, err)
+	deliveries, err := s.GetDeliveries(ctx, "sp-1", resp.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, DeliveryFailed, deliveries[0].State)
+	assert.Equal(t, ErrDispatcherClosed.Error(), deliveries[0].Error)
+}
+
+func TestService_Dispatch_Preferences(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, config.Config{Retry: retry.DefaultRetryConfig()}, defaultMessages)
+	email := &recordingChannel{name: ChannelEmail}
+	webhook := &recordingChannel{name: ChannelWebhook}
+	s.RegisterChannel(email, testChannelConfig())
+	s.RegisterChannel(webhook, testChannelConfig())
+	ctx := context.Background()
+
+	// quiet hours from an hour ago until an hour from now
+	now := time.Now().UTC()
+	_, err := s.UpdatePreferences(ctx, "sp-1", UpdatePreferencesRequest{
+		MinRating: 4,
+		Channels:  map[string]bool{ChannelEmail: false},
+		QuietHours: &QuietHours{
+			Start:    now.Add(-time.Hour).Format("15:04"),
+			End:      now.Add(time.Hour).Format("15:04"),
+			Timezone: "UTC",
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 3})
+	require.NoError(t, err)
+	assert.True(t, resp.Suppressed)
+	assert.Empty(t, resp.ID)
+	count, err := s.CountUnread(ctx, "sp-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count.Unread, "suppressed notifications are not stored")
+
+	resp, err = s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 5})
+	require.NoError(t, err)
+	require.False(t, resp.Suppressed)
+	deliveries, err := s.GetDeliveries(ctx, "sp-1", resp.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	assert.Equal(t, DeliverySkipped, deliveries[0].State, "the email channel is disabled")
+	assert.Equal(t, "skipped: the channel is disabled by the preferences", deliveries[0].Error)
+	for _, delivery := range deliveries[1:] {
+		assert.Equal(t, DeliveryHeld, delivery.State, "deliveries are held during quiet hours")
+		require.NotNil(t, delivery.ReleaseAt)
+		assert.WithinDuration(t, now.Add(time.Hour), *delivery.ReleaseAt, time.Minute)
+	}
+
+	// the held deliveries are sent once the quiet hours end
+	s.(*service).dispatcher.release(ctx, now)
+	assert.Empty(t, webhook.sent())
+	s.(*service).dispatcher.release(ctx, now.Add(time.Hour))
+	require.NoError(t, s.Close(ctx))
+	assert.Equal(t, []string{resp.ID}, webhook.sent())
+	assert.Empty(t, email.sent())
+	deliveries, err = s.GetDeliveries(ctx, "sp-1", resp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, DeliverySkipped, deliveries[0].State)
+	assert.Equal(t, DeliverySucceeded, deliveries[1].State)
+	assert.Nil(t, deliveries[1].ReleaseAt)
+	assert.Equal(t, DeliverySucceeded, deliveries[2].State)
+}
@@ -0,0 +1,238 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+)
+
+// builtinMessagesFS holds the built-in English message templates, which the templates of the configured directory
+// extend and override. Templates are named "<locale>/<event type>.tmpl".
+//
+//go:embed messages/*/*.tmpl
+var builtinMessagesFS embed.FS
+
+// builtinLocale is the locale of the built-in message templates.
+const builtinLocale = "en"
+
+// localePattern is the format of locales, a language code optionally followed by a region, e.g. "tr" or "pt-BR".
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+
+// defaultMessages renders the built-in message templates. It is used by NewNotification.
+var defaultMessages = mustLoadBuiltinMessages()
+
+// MessageData is the data the message templates are executed with. Count is the number of ratings a notification
+// is about: 1 for the notification of a single rating, more for a coalesced notification or a digest, which carry
+// the AverageRating instead of a single Rating. Digest is only set for digests.
+type MessageData struct {
+	Rating        int
+	CustomerName  string
+	Comment       string
+	Count         int
+	AverageRating float64
+	Digest        *Digest
+}
+
+// messageSamples are the data every template of an event type is executed with when the templates are loaded, so
+// that templates which fail to render are found at startup.
+var messageSamples = map[string][]MessageData{
+	EventRatingCreated: {
+		{Rating: 5, CustomerName: "Jane", Comment: strings.Repeat("Great work. ", 30), Count: 1},
+		{Rating: 0, Count: 1},
+		{Count: 5, AverageRating: 4.2},
+	},
+	EventRatingDigest: {
+		{Count: 12, AverageRating: 4.3, Digest: &Digest{Frequency: DigestDaily, Count: 12, AverageRating: 4.3}},
+		{Count: 1, AverageRating: 5, Digest: &Digest{Frequency: DigestWeekly, Count: 1, AverageRating: 5}},
+	},
+}
+
+// messageFuncs are the functions available in the message templates.
+var messageFuncs = template.FuncMap{
+	// plural returns the singular form for a count of 1 and the plural form otherwise, e.g.
+	// {{plural .Count "rating" "ratings"}}
+	"plural": func(count int, singular, plural string) string {
+		if count == 1 {
+			return singular
+		}
+		return plural
+	},
+	// truncate shortens a text to at most the given number of characters, e.g. {{truncate 200 .Comment}}
+	"truncate": truncate,
+}
+
+// Messages renders the messages of notifications from text/template templates keyed by event type and locale.
+type Messages struct {
+	// map[locale]map[eventType]template
+	templates     map[string]map[string]*template.Template
+	defaultLocale string
+}
+
+// LoadMessages loads the built-in message templates and those of the configured directory, and checks that every
+// template renders and that the default locale has a template for every event type.
+func LoadMessages(cfg config.MessagesConfig) (*Messages, error) {
+	m := &Messages{
+		templates:     make(map[string]map[string]*template.Template),
+		defaultLocale: strings.ToLower(cfg.DefaultLocale),
+	}
+	if m.defaultLocale == "" {
+		m.defaultLocale = builtinLocale
+	}
+	if err := m.load(builtinMessagesFS, "messages"); err != nil {
+		return nil, err
+	}
+	if cfg.Dir != "" {
+		if err := m.load(os.DirFS(cfg.Dir), "."); err != nil {
+			return nil, fmt.Errorf("failed to load message templates from %s: %w", cfg.Dir, err)
+		}
+	}
+
+	for eventType := range messageSamples {
+		if _, ok := m.templates[m.defaultLocale][eventType]; !ok {
+			return nil, fmt.Errorf("the default locale %q has no %s message template", m.defaultLocale, eventType)
+		}
+	}
+	return m, nil
+}
+
+// mustLoadBuiltinMessages loads the built-in message templates and panics if they are invalid.
+func mustLoadBuiltinMessages() *Messages {
+	m, err := LoadMessages(config.MessagesConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// load parses the templates named "<locale>/<event type>.tmpl" in the given directory of a file system, replacing
+// the templates loaded before.
+func (m *Messages) load(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*", "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		locale := strings.ToLower(path.Base(path.Dir(file)))
+		eventType := strings.TrimSuffix(path.Base(file), ".tmpl")
+		if !localePattern.MatchString(locale) {
+			return fmt.Errorf("%s: %q is not a locale", file, locale)
+		}
+		samples, ok := messageSamples[eventType]
+		if !ok {
+			return fmt.Errorf("%s: unknown event type %q", file, eventType)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(file).Funcs(messageFuncs).Parse(string(content))
+		if err != nil {
+			return err
+		}
+		for _, sample := range samples {
+			message, err := execute(tmpl, sample)
+			if err != nil {
+				return err
+			}
+			if message == "" {
+				return fmt.Errorf("%s: the message is empty", file)
+			}
+		}
+
+		if m.templates[locale] == nil {
+			m.templates[locale] = make(map[string]*template.Template)
+		}
+		m.templates[locale][eventType] = tmpl
+	}
+	return nil
+}
+
+// Render renders the message of an event type in a locale. Locales without a template fall back to their language,
+// e.g. "pt-BR" to "pt", and then to the default locale.
+func (m *Messages) Render(eventType, locale string, data MessageData) (string, error) {
+	tmpl := m.lookup(eventType, locale)
+	if tmpl == nil {
+		return "", fmt.Errorf("no message template for %s", eventType)
+	}
+	return execute(tmpl, data)
+}
+
+// render renders the message of an event type in a locale, and falls back to a generic message when the message
+// cannot be rendered. The templates were executed when they were loaded, so this does not happen for valid data.
+func (m *Messages) render(eventType, locale string, data MessageData) string {
+	message, err := m.Render(eventType, locale, data)
+	if err != nil || message == "" {
+		return "New notification"
+	}
+	return message
+}
+
+// lookup returns the template of an event type for a locale, or nil when no fallback locale has one.
+func (m *Messages) lookup(eventType, locale string) *template.Template {
+	locale = strings.ToLower(locale)
+	language, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{locale, language, m.defaultLocale} {
+		if tmpl, ok := m.templates[candidate][eventType]; ok {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+// execute executes a message template. The message is a single line without surrounding whitespace.
+func execute(tmpl *template.Template, data MessageData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(buf.String()), " "), nil
+}
+
+// truncate shortens a text to at most maxLength characters. A shortened text ends with an ellipsis, and a word cut
+// in half is dropped when there is a space in the second half of the text, so that words are not cut off.
+func truncate(maxLength int, text string) string {
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	if maxLength <= 1 {
+		return "…"
+	}
+	runes := []rune(text)
+	cut := string(runes[:maxLength-1])
+	if runes[maxLength-1] != ' ' {
+		// the cut is within a word
+		if i := strings.LastIndex(cut, " "); i >= len(cut)/2 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRight(cut, " .,;:") + "…"
+}
+
+// ratingMessageData returns the message data of the notification of a single rating.
+func ratingMessageData(req RatingNotificationRequest) MessageData {
+	return MessageData{
+		Rating:       req.Rating,
+		CustomerName: req.CustomerName,
+		Comment:      req.Comment,
+		Count:        1,
+	}
+}
+
+// digestMessageData returns the message data of a digest.
+func digestMessageData(digest *Digest) MessageData {
+	return MessageData{
+		Count:         digest.Count,
+		AverageRating: digest.AverageRating,
+		Digest:        digest,
+	}
+}
@@ -0,0 +1,156 @@
+package notification
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messagesDir is the directory of the message templates shipped with the service.
+const messagesDir = "../../config/messages"
+
+func TestMessages_Render(t *testing.T) {
+	messages, err := LoadMessages(config.MessagesConfig{Dir: messagesDir, DefaultLocale: "en"})
+	require.NoError(t, err)
+
+	rating := MessageData{Rating: 4, CustomerName: "Jane", Comment: "Quick and tidy", Count: 1}
+	coalesced := MessageData{Count: 5, AverageRating: 4.2}
+	daily := digestMessageData(&Digest{Frequency: DigestDaily, Count: 12, AverageRating: 4.25})
+	weekly := digestMessageData(&Digest{Frequency: DigestWeekly, Count: 1, AverageRating: 5})
+	tests := []struct {
+		name      string
+		eventType string
+		locale    string
+		data      MessageData
+		want      string
+	}{
+		{"rating", EventRatingCreated, "en", rating, `New 4-star rating received from Jane: "Quick and tidy"`},
+		{"rating in Turkish", EventRatingCreated, "tr", rating, `4 yıldızlı yeni bir değerlendirme aldınız (Jane): "Quick and tidy"`},
+		{"region falls back to the language", EventRatingCreated, "tr-TR", rating, `4 yıldızlı yeni bir değerlendirme aldınız (Jane): "Quick and tidy"`},
+		{"unknown locale falls back to the default locale", EventRatingCreated, "de", rating, `New 4-star rating received from Jane: "Quick and tidy"`},
+		{"no locale", EventRatingCreated, "", MessageData{Count: 1}, "New rating received"},
+		{"coalesced", EventRatingCreated, "en", coalesced, "5 new ratings, average 4.2"},
+		{"coalesced in Turkish", EventRatingCreated, "TR", coalesced, "5 yeni değerlendirme, ortalama 4.2"},
+		{"daily digest", EventRatingDigest, "en", daily, "Daily digest: 12 new ratings, 4.2 stars on average"},
+		{"weekly digest of a single rating", EventRatingDigest, "en", weekly, "Weekly digest: 1 new rating, 5.0 stars on average"},
+		{"digest in Turkish", EventRatingDigest, "tr", daily, "Günlük özet: 12 yeni değerlendirme, ortalama 4.2 yıldız"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := messages.Render(tt.eventType, tt.locale, tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, message)
+		})
+	}
+
+	_, err = messages.Render("rating.deleted", "en", rating)
+	assert.Error(t, err)
+	assert.Equal(t, "New notification", messages.render("rating.deleted", "en", rating))
+}
+
+func TestMessages_RenderTruncatesComments(t *testing.T) {
+	message, err := defaultMessages.Render(EventRatingCreated, "", MessageData{Rating: 1, Comment: strings.Repeat("Late again. ", 50), Count: 1})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(message, `Late again. Late…"`), message)
+	assert.Less(t, len([]rune(message)), 240)
+}
+
+func TestLoadMessages(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		defaultLocale string
+		wantErr       string
+	}{
+		{"override", map[string]string{"en/rating.created.tmpl": "{{.Count}} rating(s)"}, "", ""},
+		{"default locale from the directory", map[string]string{
+			"de/rating.created.tmpl": "Neue Bewertung",
+			"de/rating.digest.tmpl":  "Zusammenfassung",
+		}, "de", ""},
+		{"default locale without templates", map[string]string{"de/rating.created.tmpl": "Neue Bewertung"}, "de", `the default locale "de" has no rating.digest message template`},
+		{"syntax error", map[string]string{"de/rating.created.tmpl": "{{if .Count}}"}, "", "de/rating.created.tmpl"},
+		{"execution error", map[string]string{"de/rating.created.tmpl": "{{.Stars}}"}, "", "can't evaluate field Stars"},
+		{"unknown function", map[string]string{"de/rating.created.tmpl": "{{upper .Comment}}"}, "", `function "upper" not defined`},
+		{"empty message", map[string]string{"de/rating.created.tmpl": "{{/* nothing */}}"}, "", "the message is empty"},
+		{"unknown event type", map[string]string{"de/rating.deleted.tmpl": "Deleted"}, "", `unknown event type "rating.deleted"`},
+		{"invalid locale", map[string]string{"german/rating.created.tmpl": "Neue Bewertung"}, "", `"german" is not a locale`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+			}
+
+			messages, err := LoadMessages(config.MessagesConfig{Dir: dir, DefaultLocale: tt.defaultLocale})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			_, err = messages.Render(EventRatingCreated, "", MessageData{Count: 1})
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err := LoadMessages(config.MessagesConfig{Dir: messagesDir, DefaultLocale: "tr"})
+	assert.NoError(t, err, "the shipped templates are valid")
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int
+		text      string
+		want      string
+	}{
+		{"short", 10, "Great", "Great"},
+		{"exact", 5, "Great", "Great"},
+		{"cut at a space", 12, "Great work, thanks", "Great work…"},
+		{"cut within a word", 14, "Great work, thanks", "Great work…"},
+		{"long word", 6, "Wonderful", "Wonde…"},
+		{"multibyte characters", 5, "Çok güzel iş", "Çok…"},
+		{"single character", 1, "Great", "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, truncate(tt.maxLength, tt.text))
+		})
+	}
+}
+
+func TestService_Locale(t *testing.T) {
+	messages, err := LoadMessages(config.MessagesConfig{Dir: messagesDir, DefaultLocale: "en"})
+	require.NoError(t, err)
+	logger, _ := log.NewForTest()
+	s := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, config.Config{Retry: retry.DefaultRetryConfig()}, messages)
+	ctx := context.Background()
+
+	_, err = s.UpdatePreferences(ctx, "sp-1", UpdatePreferencesRequest{Locale: "tr-TR"})
+	require.NoError(t, err)
+	_, err = s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 5})
+	require.NoError(t, err)
+	_, err = s.CreateNotification(ctx, RatingNotificationRequest{ServiceProviderID: "sp-2", RatingID: "r-2", Rating: 5})
+	require.NoError(t, err)
+	require.NoError(t, s.Close(ctx))
+
+	result, err := s.GetNotifications(ctx, Query{ServiceProviderID: "sp-1"})
+	require.NoError(t, err)
+	require.Len(t, result.Notifications, 1)
+	assert.Equal(t, "5 yıldızlı yeni bir değerlendirme aldınız", result.Notifications[0].Message)
+	result, err = s.GetNotifications(ctx, Query{ServiceProviderID: "sp-2"})
+	require.NoError(t, err)
+	require.Len(t, result.Notifications, 1)
+	assert.Equal(t, "New 5-star rating received", result.Notifications[0].Message, "without a preference the default locale is used")
+}
@@ -6,75 +6,327 @@ import (
 	"github.com/google/uuid"
 )
 
-// Notification represents a notification in the system
+// Event types
+const (
+	// EventRatingCreated is the event type of a notification about a new rating
+	EventRatingCreated = "rating.created"
+	// EventRatingDigest is the event type of a notification summarizing the ratings of a period
+	EventRatingDigest = "rating.digest"
+)
+
+// Digest frequencies
+const (
+	// DigestDaily summarizes the ratings of every day, from midnight to midnight.
+	DigestDaily = "daily"
+	// DigestWeekly summarizes the ratings of every week, from Monday to Monday.
+	DigestWeekly = "weekly"
+)
+
+// Notification states. A notification is unread until the service provider fetched or acknowledged it,
+// and it can be archived once it is no longer of interest.
+const (
+	StateUnread   = "unread"
+	StateRead     = "read"
+	StateArchived = "archived"
+)
+
+// stateOrder orders the states; a notification never moves back to an earlier state.
+var stateOrder = map[string]int{StateUnread: 0, StateRead: 1, StateArchived: 2}
+
+// canTransition reports whether a notification can move from one state to another
+func canTransition(from, to string) bool {
+	return stateOrder[to] > stateOrder[from]
+}
+
+// Notification represents a notification in the system. Sequence numbers the notifications of a service provider
+// in the order they were stored, starting at 1. ServiceProviderEmail is the address email notifications are sent to
+// unless the service provider chose another one; it is never part of a response. Digest is only set for digest notifications, which have no rating ID.
+// RatingIDs is only set for digests and notifications coalescing a burst of ratings, which have no rating ID either.
+//
+// Message is the rendered text of the notification, while Rating, CustomerName and Comment hold the details of the
+// rating it is about, so that clients can render them on their own. Data holds further details: the data sent by the
+// rating service, or the "count" and "averageRating" of a coalesced notification.
 type Notification struct {
-	ID                string    `json:"id"`
-	ServiceProviderID string    `json:"serviceProviderId"`
-	Message           string    `json:"message"`
-	RatingID          string    `json:"ratingId"`
-	CreatedAt         time.Time `json:"createdAt"`
+	ID                   string                 `json:"id"`
+	ServiceProviderID    string                 `json:"serviceProviderId"`
+	ServiceProviderEmail string                 `json:"-"`
+	Type                 string                 `json:"type"`
+	State                string                 `json:"state"`
+	Sequence             uint64                 `json:"sequence"`
+	Message              string                 `json:"message"`
+	RatingID             string                 `json:"ratingId"`
+	RatingIDs            []string               `json:"ratingIds,omitempty"`
+	Rating               int                    `json:"rating,omitempty"`
+	CustomerName         string                 `json:"customerName,omitempty"`
+	Comment              string                 `json:"comment,omitempty"`
+	Data                 map[string]interface{} `json:"data,omitempty"`
+	Digest               *Digest                `json:"digest,omitempty"`
+	CreatedAt            time.Time              `json:"createdAt"`
+}
+
+// API versions. Version 1 returns notifications without their rating details and data, which version 2 added.
+const (
+	APIVersion1 = 1
+	APIVersion2 = 2
+)
+
+// ForVersion returns the notification in the shape of the given API version.
+func (n Notification) ForVersion(version int) Notification {
+	if version < APIVersion2 {
+		n.Rating = 0
+		n.CustomerName = ""
+		n.Comment = ""
+		n.Data = nil
+	}
+	return n
+}
+
+// Digest summarizes the ratings a service provider received in a period.
+type Digest struct {
+	Frequency     string    `json:"frequency"`
+	PeriodStart   time.Time `json:"periodStart"`
+	PeriodEnd     time.Time `json:"periodEnd"`
+	Count         int       `json:"count"`
+	AverageRating float64   `json:"averageRating"`
+	// the lowest ratings of the period, the lowest first
+	LowestRatings []DigestEntry `json:"lowestRatings"`
+}
+
+// DigestEntry represents a rating collected for the next digest or coalesced notification of a service provider.
+type DigestEntry struct {
+	ServiceProviderID    string                 `json:"serviceProviderId,omitempty"`
+	ServiceProviderEmail string                 `json:"serviceProviderEmail,omitempty"`
+	RatingID             string                 `json:"ratingId"`
+	Rating               int                    `json:"rating"`
+	CustomerName         string                 `json:"customerName,omitempty"`
+	Comment              string                 `json:"comment,omitempty"`
+	Data                 map[string]interface{} `json:"data,omitempty"`
+	CreatedAt            time.Time              `json:"createdAt"`
+}
+
+// Delivery states. A delivery is pending until the channel delivered the notification, failed after all attempts
+// or skipped it. A delivery during the quiet hours of the service provider is held until they end.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+	DeliverySkipped   = "skipped"
+	DeliveryHeld      = "held"
+)
+
+// Delivery represents the delivery of a notification through a channel. Error holds the last failure, or the reason
+// a skipped delivery was skipped. ReleaseAt is the time a held delivery is sent.
+type Delivery struct {
+	NotificationID    string     `json:"notificationId"`
+	ServiceProviderID string     `json:"serviceProviderId"`
+	Channel           string     `json:"channel"`
+	State             string     `json:"state"`
+	Attempts          int        `json:"attempts"`
+	Error             string     `json:"error,omitempty"`
+	ReleaseAt         *time.Time `json:"releaseAt,omitempty"`
+	UpdatedAt         time.Time  `json:"updatedAt"`
+}
+
+// Preferences represents the notification settings of a service provider. Notifications of ratings below MinRating
+// and of disabled event types are not created; disabled channels are skipped, and deliveries during the quiet hours
+// are held until they end. Channels and event types which are not listed are enabled. With a Digest, the ratings are
+// collected into a digest notification per period instead of a notification each. Messages are rendered in the
+// Locale, e.g. "tr", or in the default locale when it is empty or has no messages. Emails are sent to the
+// EmailAddress, or to the address given by the rating service when it is empty.
+type Preferences struct {
+	ServiceProviderID string             `json:"serviceProviderId"`
+	MinRating         int                `json:"minRating"`
+	Channels          map[string]bool    `json:"channels"`
+	Events            map[string]bool    `json:"events"`
+	QuietHours        *QuietHours        `json:"quietHours,omitempty"`
+	Digest            *DigestPreferences `json:"digest,omitempty"`
+	Locale            string             `json:"locale,omitempty"`
+	EmailAddress      string             `json:"emailAddress,omitempty"`
+	UpdatedAt         time.Time          `json:"updatedAt,omitempty"`
+}
+
+// DigestPreferences represents how often a service provider receives digests. The periods start at midnight in the
+// IANA Timezone.
+type DigestPreferences struct {
+	Frequency string `json:"frequency"`
+	Timezone  string `json:"timezone"`
+}
+
+// QuietHours represents the daily period in which a service provider does not want to be notified. Start and End
+// are wall clock times in the "15:04" format in the IANA Timezone, e.g. "22:00" to "07:00" in "Europe/Istanbul".
+// Quiet hours hold the pushed deliveries only: notifications are still stored, so clients fetching them see them.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// UpdatePreferencesRequest represents a request replacing the notification settings of a service provider.
+type UpdatePreferencesRequest struct {
+	MinRating    int                `json:"minRating"`
+	Channels     map[string]bool    `json:"channels"`
+	Events       map[string]bool    `json:"events"`
+	QuietHours   *QuietHours        `json:"quietHours"`
+	Digest       *DigestPreferences `json:"digest"`
+	Locale       string             `json:"locale"`
+	EmailAddress string             `json:"emailAddress"`
 }
 
-// RatingNotificationRequest represents an incoming notification from the rating service
+// IdempotencyKey returns the key which identifies the event a notification was created for.
+// Notifications with the same key are duplicates of each other. A coalesced notification is identified by its first
+// rating.
+func (n Notification) IdempotencyKey() string {
+	if n.Digest != nil {
+		return n.ServiceProviderID + "/" + n.Digest.PeriodStart.UTC().Format(time.RFC3339) + "/" + n.Type
+	}
+	if len(n.RatingIDs) > 0 {
+		return n.ServiceProviderID + "/" + n.RatingIDs[0] + "/" + n.Type
+	}
+	return n.ServiceProviderID + "/" + n.RatingID + "/" + n.Type
+}
+
+// IdempotencyKeys returns the idempotency key of a notification followed by the keys of the rating events it covers
+// when it summarizes several ratings, so that a rating sent again after it was summarized is a duplicate of the
+// summary instead of being collected again.
+func (n Notification) IdempotencyKeys() []string {
+	keys := []string{n.IdempotencyKey()}
+	for _, ratingID := range n.RatingIDs {
+		if key := ratingIdempotencyKey(n.ServiceProviderID, ratingID); key != keys[0] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ratingIdempotencyKey returns the idempotency key of the notification of a rating of a service provider.
+func ratingIdempotencyKey(serviceProviderID, ratingID string) string {
+	return serviceProviderID + "/" + ratingID + "/" + EventRatingCreated
+}
+
+// RatingNotificationRequest represents an incoming notification from the rating service. Data holds further
+// details which are passed on to the clients as they are.
 type RatingNotificationRequest struct {
-	ServiceProviderID string `json:"serviceProviderId"`
-	RatingID          string `json:"ratingId"`
-	Rating            int    `json:"rating"`
-	CustomerName      string `json:"customerName"`
-	Comment           string `json:"comment"`
+	ServiceProviderID    string                 `json:"serviceProviderId"`
+	ServiceProviderEmail string                 `json:"serviceProviderEmail"`
+	RatingID             string                 `json:"ratingId"`
+	Type                 string                 `json:"type"`
+	Rating               int                    `json:"rating"`
+	CustomerName         string                 `json:"customerName"`
+	Comment              string                 `json:"comment"`
+	Data                 map[string]interface{} `json:"data"`
 }
 
 // GetNotificationsResponse represents the response for getting notifications
 type GetNotificationsResponse struct {
 	Notifications []Notification `json:"notifications"`
 	HasMore       bool           `json:"hasMore"`
+	// NextCursor is the sequence number to pass as the after parameter to get the next page
+	NextCursor uint64 `json:"nextCursor,omitempty"`
+	// Gap is only set for requests with a client ID, see QueryResult
+	Gap bool `json:"gap,omitempty"`
 }
 
-// CreateNotificationResponse represents the response after creating a notification
+// CreateNotificationResponse represents the response after creating a notification.
+// Duplicate is set when the notification had already been created by an earlier request, Suppressed when the
+// preferences of the service provider filtered it out or its rating was collected for a digest, and Coalesced when
+// its rating was collected for the notification sent when the coalescing window ends; suppressed and coalesced
+// notifications have no ID.
 type CreateNotificationResponse struct {
-	ID      string `json:"id"`
-	Message string `json:"message"`
+	ID         string `json:"id,omitempty"`
+	Message    string `json:"message"`
+	Duplicate  bool   `json:"duplicate,omitempty"`
+	Suppressed bool   `json:"suppressed,omitempty"`
+	Coalesced  bool   `json:"coalesced,omitempty"`
 }
 
-// NewNotification creates a new notification from a rating notification request
-func NewNotification(req RatingNotificationRequest) Notification {
-	message := formatNotificationMessage(req.Rating, req.CustomerName, req.Comment)
+// AcknowledgeRequest represents a request to move notifications to the read or archived state
+type AcknowledgeRequest struct {
+	IDs   []string `json:"ids"`
+	State string   `json:"state"`
+}
 
-	return Notification{
-		ID:                uuid.New().String(),
-		ServiceProviderID: req.ServiceProviderID,
-		Message:           message,
-		RatingID:          req.RatingID,
-		CreatedAt:         time.Now(),
-	}
+// AcknowledgeResponse represents the response after acknowledging notifications
+type AcknowledgeResponse struct {
+	Acknowledged int `json:"acknowledged"`
 }
 
-// formatNotificationMessage formats a notification message based on rating details
-func formatNotificationMessage(rating int, customerName, comment string) string {
-	baseMessage := ""
-
-	switch rating {
-	case 1:
-		baseMessage = "New 1-star rating received"
-	case 2:
-		baseMessage = "New 2-star rating received"
-	case 3:
-		baseMessage = "New 3-star rating received"
-	case 4:
-		baseMessage = "New 4-star rating received"
-	case 5:
-		baseMessage = "New 5-star rating received"
-	default:
-		baseMessage = "New rating received"
-	}
+// UnreadCountResponse represents the response for counting unread notifications
+type UnreadCountResponse struct {
+	Unread int `json:"unread"`
+}
 
-	if customerName != "" {
-		baseMessage += " from " + customerName
-	}
+// BatchNotificationRequest represents a batch of incoming notifications from the rating service
+type BatchNotificationRequest struct {
+	Notifications []RatingNotificationRequest `json:"notifications"`
+}
+
+// BatchItemResult represents the outcome of a single notification of a batch request
+type BatchItemResult struct {
+	Index   int         `json:"index"`
+	Status  int         `json:"status"`
+	ID      string      `json:"id,omitempty"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// BatchNotificationResponse represents the response after processing a batch request
+type BatchNotificationResponse struct {
+	Results    []BatchItemResult `json:"results"`
+	Created    int               `json:"created"`
+	Duplicates int               `json:"duplicates"`
+	Suppressed int               `json:"suppressed"`
+	Coalesced  int               `json:"coalesced"`
+	Failed     int               `json:"failed"`
+}
+
+// WebSocket message types
+const (
+	// SocketNotification pushes a notification to the client
+	SocketNotification = "notification"
+	// SocketAck acknowledges notifications, and replies with the number of acknowledged notifications
+	SocketAck = "ack"
+	// SocketError replies to a message which could not be processed
+	SocketError = "error"
+)
 
-	if comment != "" {
-		baseMessage += ": \"" + comment + "\""
+// SocketMessage represents a message exchanged over a WebSocket connection. Replies carry the ID of the
+// client message they answer.
+type SocketMessage struct {
+	Type         string        `json:"type"`
+	ID           string        `json:"id,omitempty"`
+	Notification *Notification `json:"notification,omitempty"`
+	IDs          []string      `json:"ids,omitempty"`
+	State        string        `json:"state,omitempty"`
+	Acknowledged *int          `json:"acknowledged,omitempty"`
+	Message      string        `json:"message,omitempty"`
+}
+
+// NewNotification creates a new notification from a rating notification request with the built-in English message.
+// Requests without an event type are treated as rating.created events.
+func NewNotification(req RatingNotificationRequest) Notification {
+	return newNotification(defaultMessages, "", req)
+}
+
+// newNotification creates a new notification from a rating notification request with the message in the given
+// locale.
+func newNotification(messages *Messages, locale string, req RatingNotificationRequest) Notification {
+	eventType := req.Type
+	if eventType == "" {
+		eventType = EventRatingCreated
 	}
 
-	return baseMessage
+	return Notification{
+		ID:                   uuid.New().String(),
+		ServiceProviderID:    req.ServiceProviderID,
+		ServiceProviderEmail: req.ServiceProviderEmail,
+		Type:                 eventType,
+		State:                StateUnread,
+		Message:              messages.render(eventType, locale, ratingMessageData(req)),
+		RatingID:             req.RatingID,
+		Rating:               req.Rating,
+		CustomerName:         req.CustomerName,
+		Comment:              req.Comment,
+		Data:                 req.Data,
+		CreatedAt:            time.Now(),
+	}
 }
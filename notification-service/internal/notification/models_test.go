@@ -1,6 +1,7 @@
 package notification
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,6 +14,7 @@ func TestNewNotification(t *testing.T) {
 		Rating:            5,
 		CustomerName:      "John Doe",
 		Comment:           "Excellent service!",
+		Data:              map[string]interface{}{"bookingId": "booking-789"},
 	}
 
 	notification := NewNotification(req)
@@ -24,10 +26,49 @@ func TestNewNotification(t *testing.T) {
 	assert.Contains(t, notification.Message, "New 5-star rating received")
 	assert.Contains(t, notification.Message, "John Doe")
 	assert.Contains(t, notification.Message, "Excellent service!")
+	assert.Equal(t, req.Rating, notification.Rating)
+	assert.Equal(t, req.CustomerName, notification.CustomerName)
+	assert.Equal(t, req.Comment, notification.Comment)
+	assert.Equal(t, req.Data, notification.Data)
 	assert.False(t, notification.CreatedAt.IsZero())
 }
 
-func TestFormatNotificationMessage(t *testing.T) {
+func TestNotification_JSONLeavesOutEmail(t *testing.T) {
+	notification := NewNotification(RatingNotificationRequest{
+		ServiceProviderID:    "provider-123",
+		ServiceProviderEmail: "provider@example.com",
+		RatingID:             "rating-456",
+		Rating:               5,
+	})
+	assert.Equal(t, "provider@example.com", notification.ServiceProviderEmail)
+
+	payload, err := json.Marshal(notification)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(payload), "provider@example.com", "the email address is never part of a response")
+}
+
+func TestNotification_ForVersion(t *testing.T) {
+	notification := NewNotification(RatingNotificationRequest{
+		ServiceProviderID: "provider-123",
+		RatingID:          "rating-456",
+		Rating:            5,
+		CustomerName:      "John Doe",
+		Comment:           "Excellent service!",
+		Data:              map[string]interface{}{"bookingId": "booking-789"},
+	})
+
+	v1 := notification.ForVersion(APIVersion1)
+	assert.Equal(t, notification.ID, v1.ID)
+	assert.Equal(t, notification.Message, v1.Message)
+	assert.Zero(t, v1.Rating)
+	assert.Empty(t, v1.CustomerName)
+	assert.Empty(t, v1.Comment)
+	assert.Nil(t, v1.Data)
+
+	assert.Equal(t, notification, notification.ForVersion(APIVersion2))
+}
+
+func TestNewNotification_Message(t *testing.T) {
 	tests := []struct {
 		name         string
 		rating       int
@@ -74,8 +115,8 @@ func TestFormatNotificationMessage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := formatNotificationMessage(tt.rating, tt.customerName, tt.comment)
-			assert.Equal(t, tt.expected, result)
+			notification := NewNotification(RatingNotificationRequest{Rating: tt.rating, CustomerName: tt.customerName, Comment: tt.comment})
+			assert.Equal(t, tt.expected, notification.Message)
 		})
 	}
 }
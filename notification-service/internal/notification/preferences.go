@@ -0,0 +1,146 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// clockPattern is the format of the start and end of quiet hours.
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// defaultPreferences returns the preferences of a service provider which has not stored any: every notification
+// is created and sent right away through every channel.
+func defaultPreferences(serviceProviderID string) Preferences {
+	return Preferences{
+		ServiceProviderID: serviceProviderID,
+		Channels:          map[string]bool{},
+		Events:            map[string]bool{},
+	}
+}
+
+// suppresses returns why the preferences filter out the notification of a rating event, or an empty string when
+// they do not.
+func (p Preferences) suppresses(eventType string, rating int) string {
+	if enabled, ok := p.Events[eventType]; ok && !enabled {
+		return fmt.Sprintf("%s notifications are disabled", eventType)
+	}
+	if rating > 0 && rating < p.MinRating {
+		return fmt.Sprintf("ratings below %d stars are not notified", p.MinRating)
+	}
+	return ""
+}
+
+// ChannelEnabled reports whether notifications are sent through a channel.
+func (p Preferences) ChannelEnabled(channel string) bool {
+	enabled, ok := p.Channels[channel]
+	return !ok || enabled
+}
+
+// releaseAt returns when the quiet hours in progress at the given time end, and false when they are not in
+// progress.
+func (q *QuietHours) releaseAt(now time.Time) (time.Time, bool) {
+	if q == nil {
+		return time.Time{}, false
+	}
+	location, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		// the time zone was validated when the preferences were saved
+		return time.Time{}, false
+	}
+	start, startErr := time.Parse("15:04", q.Start)
+	end, endErr := time.Parse("15:04", q.End)
+	if startErr != nil || endErr != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	quiet := false
+	if startMinute < endMinute {
+		quiet = minute >= startMinute && minute < endMinute
+	} else {
+		// the quiet hours span midnight
+		quiet = minute >= startMinute || minute < endMinute
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	release := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, location)
+	if !release.After(local) {
+		release = time.Date(local.Year(), local.Month(), local.Day()+1, end.Hour(), end.Minute(), 0, 0, location)
+	}
+	return release, true
+}
+
+// periodStart returns the start of the digest period in progress at the given time, which is the end of the
+// previous period.
+func (d DigestPreferences) periodStart(now time.Time) time.Time {
+	location, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		// the time zone was validated when the preferences were saved
+		location = time.UTC
+	}
+	local := now.In(location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	if d.Frequency == DigestWeekly {
+		// weeks start on Monday
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	}
+	return start
+}
+
+// previousPeriodStart returns the start of the digest period which ends at the given period start.
+func (d DigestPreferences) previousPeriodStart(start time.Time) time.Time {
+	if d.Frequency == DigestWeekly {
+		return start.AddDate(0, 0, -7)
+	}
+	return start.AddDate(0, 0, -1)
+}
+
+// Validate validates the digest preferences
+func (d DigestPreferences) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.Frequency, validation.Required, validation.In(DigestDaily, DigestWeekly)),
+		validation.Field(&d.Timezone, validation.Required, validation.By(validateTimezone)),
+	)
+}
+
+// Validate validates the quiet hours
+func (q QuietHours) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Start, validation.Required, validation.Match(clockPattern).Error("must be a time in the 15:04 format")),
+		validation.Field(&q.End, validation.Required, validation.Match(clockPattern).Error("must be a time in the 15:04 format"),
+			validation.NotIn(q.Start).Error("must differ from the start")),
+		validation.Field(&q.Timezone, validation.Required, validation.By(validateTimezone)),
+	)
+}
+
+// validateTimezone checks that a value is the name of an IANA time zone.
+func validateTimezone(value interface{}) error {
+	name, _ := value.(string)
+	if _, err := time.LoadLocation(name); err != nil {
+		return errors.New("must be an IANA time zone such as Europe/Istanbul")
+	}
+	return nil
+}
+
+// keysIn returns a rule which checks that the keys of a map[string]bool are among the given values.
+func keysIn(values ...string) validation.Rule {
+	return validation.By(func(value interface{}) error {
+		m, _ := value.(map[string]bool)
+		for key := range m {
+			if !slices.Contains(values, key) {
+				return fmt.Errorf("%q is unknown", key)
+			}
+		}
+		return nil
+	})
+}
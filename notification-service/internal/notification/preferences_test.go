@@ -0,0 +1,97 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietHours_ReleaseAt(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	overnight := &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Istanbul"}
+
+	tests := []struct {
+		name        string
+		quietHours  *QuietHours
+		now         time.Time
+		wantQuiet   bool
+		wantRelease time.Time
+	}{
+		{"no quiet hours", nil, time.Date(2026, 10, 18, 3, 0, 0, 0, istanbul), false, time.Time{}},
+		{"before midnight", overnight, time.Date(2026, 10, 18, 23, 30, 0, 0, istanbul), true, time.Date(2026, 10, 19, 7, 0, 0, 0, istanbul)},
+		{"after midnight", overnight, time.Date(2026, 10, 18, 3, 0, 0, 0, istanbul), true, time.Date(2026, 10, 18, 7, 0, 0, 0, istanbul)},
+		{"at the start", overnight, time.Date(2026, 10, 18, 22, 0, 0, 0, istanbul), true, time.Date(2026, 10, 19, 7, 0, 0, 0, istanbul)},
+		{"at the end", overnight, time.Date(2026, 10, 18, 7, 0, 0, 0, istanbul), false, time.Time{}},
+		{"during the day", overnight, time.Date(2026, 10, 18, 12, 0, 0, 0, istanbul), false, time.Time{}},
+		{"within a day", &QuietHours{Start: "13:00", End: "14:00", Timezone: "UTC"}, time.Date(2026, 10, 18, 13, 30, 0, 0, time.UTC), true, time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC)},
+		{"in the time zone of the service provider", &QuietHours{Start: "22:00", End: "06:00", Timezone: "America/New_York"}, time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC), true, time.Date(2026, 10, 19, 6, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release, quiet := tt.quietHours.releaseAt(tt.now)
+			assert.Equal(t, tt.wantQuiet, quiet)
+			assert.True(t, tt.wantRelease.Equal(release), "want %s, got %s", tt.wantRelease, release)
+		})
+	}
+}
+
+func TestDigestPreferences_PeriodStart(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	require.NoError(t, err)
+	daily := DigestPreferences{Frequency: DigestDaily, Timezone: "Europe/Istanbul"}
+	weekly := DigestPreferences{Frequency: DigestWeekly, Timezone: "Europe/Istanbul"}
+
+	tests := []struct {
+		name         string
+		preferences  DigestPreferences
+		now          time.Time
+		wantStart    time.Time
+		wantPrevious time.Time
+	}{
+		{"daily", daily, time.Date(2026, 10, 18, 15, 0, 0, 0, istanbul), time.Date(2026, 10, 18, 0, 0, 0, 0, istanbul), time.Date(2026, 10, 17, 0, 0, 0, 0, istanbul)},
+		{"daily at midnight", daily, time.Date(2026, 10, 18, 0, 0, 0, 0, istanbul), time.Date(2026, 10, 18, 0, 0, 0, 0, istanbul), time.Date(2026, 10, 17, 0, 0, 0, 0, istanbul)},
+		{"daily in the time zone of the service provider", daily, time.Date(2026, 10, 18, 22, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, istanbul), time.Date(2026, 10, 18, 0, 0, 0, 0, istanbul)},
+		{"weekly on Sunday", weekly, time.Date(2026, 10, 18, 15, 0, 0, 0, istanbul), time.Date(2026, 10, 12, 0, 0, 0, 0, istanbul), time.Date(2026, 10, 5, 0, 0, 0, 0, istanbul)},
+		{"weekly on Monday", weekly, time.Date(2026, 10, 19, 9, 0, 0, 0, istanbul), time.Date(2026, 10, 19, 0, 0, 0, 0, istanbul), time.Date(2026, 10, 12, 0, 0, 0, 0, istanbul)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.preferences.periodStart(tt.now)
+			assert.True(t, tt.wantStart.Equal(start), "want %s, got %s", tt.wantStart, start)
+			previous := tt.preferences.previousPeriodStart(start)
+			assert.True(t, tt.wantPrevious.Equal(previous), "want %s, got %s", tt.wantPrevious, previous)
+		})
+	}
+}
+
+func TestPreferences_Suppresses(t *testing.T) {
+	tests := []struct {
+		name        string
+		preferences Preferences
+		rating      int
+		want        string
+	}{
+		{"defaults", defaultPreferences("sp-1"), 1, ""},
+		{"at the minimum rating", Preferences{MinRating: 4}, 4, ""},
+		{"below the minimum rating", Preferences{MinRating: 4}, 3, "ratings below 4 stars are not notified"},
+		{"enabled event type", Preferences{Events: map[string]bool{EventRatingCreated: true}}, 5, ""},
+		{"disabled event type", Preferences{Events: map[string]bool{EventRatingCreated: false}}, 5, "rating.created notifications are disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.preferences.suppresses(EventRatingCreated, tt.rating))
+		})
+	}
+}
+
+func TestPreferences_ChannelEnabled(t *testing.T) {
+	preferences := Preferences{Channels: map[string]bool{ChannelEmail: false, ChannelWebhook: true}}
+	assert.False(t, preferences.ChannelEnabled(ChannelEmail))
+	assert.True(t, preferences.ChannelEnabled(ChannelWebhook))
+	assert.True(t, preferences.ChannelEnabled(ChannelInApp), "channels which are not listed are enabled")
+}
@@ -0,0 +1,100 @@
+package notification
+
+// QueryResult holds the notifications selected by a query
+type QueryResult struct {
+	Notifications []Notification
+	// HasMore is set when more notifications match the query than its limit allows
+	HasMore bool
+	// Cursor is the sequence number up to which the notifications of the service provider were considered.
+	// For a query with a client ID, it is the cursor of the client after the query.
+	Cursor uint64
+	// Gap is set when notifications after the client's cursor were removed before the client received them
+	Gap bool
+}
+
+// selection selects the notifications of a query. The notifications of the service provider must be offered
+// in the order of their sequence numbers.
+type selection struct {
+	query  Query
+	after  uint64
+	result QueryResult
+}
+
+// newSelection starts a selection of the unread notifications after query.After.
+func newSelection(query Query) *selection {
+	var after uint64
+	if query.After != nil {
+		after = *query.After
+	}
+	return &selection{
+		query:  query,
+		after:  after,
+		result: QueryResult{Notifications: []Notification{}, Cursor: after},
+	}
+}
+
+// newClientSelection starts a selection for the client of the query. stored is the client's saved cursor, if
+// known is set, and oldest is the sequence number of the oldest stored notification of the service provider, or
+// the next sequence number when there is none. A client without a cursor starts from the oldest notification.
+func newClientSelection(query Query, stored uint64, known bool, oldest uint64) *selection {
+	if query.After != nil {
+		stored, known = *query.After, true
+	}
+	return &selection{
+		query: query,
+		after: stored,
+		result: QueryResult{
+			Notifications: []Notification{},
+			Cursor:        stored,
+			Gap:           known && oldest > stored+1,
+		},
+	}
+}
+
+// add offers the next notification to the selection. It reports whether the notification was selected
+// and whether further notifications are needed.
+func (s *selection) add(notification Notification) (selected, more bool) {
+	if notification.Sequence <= s.after {
+		return false, true
+	}
+	if !s.matches(notification) {
+		// the cursor moves past notifications which are skipped, unless the page is complete
+		if !s.full() {
+			s.result.Cursor = notification.Sequence
+		}
+		return false, true
+	}
+	if s.full() {
+		s.result.HasMore = true
+		return false, false
+	}
+	s.result.Notifications = append(s.result.Notifications, notification)
+	s.result.Cursor = notification.Sequence
+	return true, true
+}
+
+// matches reports whether a notification after the cursor is selected by the query.
+func (s *selection) matches(notification Notification) bool {
+	if !notification.CreatedAt.After(s.query.LastChecked) {
+		return false
+	}
+	if s.query.ClientID != "" || s.query.IncludeRead {
+		return notification.State != StateArchived
+	}
+	return notification.State == StateUnread
+}
+
+// full reports whether the selection holds as many notifications as the query's limit allows.
+func (s *selection) full() bool {
+	return s.query.Limit > 0 && len(s.result.Notifications) >= s.query.Limit
+}
+
+// consumes reports whether the selected notifications are marked as read.
+func (s *selection) consumes() bool {
+	return s.query.ClientID == "" && !s.query.Peek
+}
+
+// moved reports whether the client's cursor has to be saved.
+func (s *selection) moved() bool {
+	return s.query.ClientID != "" && !s.query.Peek && s.result.Cursor != s.after
+}
@@ -2,6 +2,7 @@ package notification
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -14,48 +15,163 @@ import (
 // Service represents the notification service
 type Service interface {
 	CreateNotification(ctx context.Context, req RatingNotificationRequest) (*CreateNotificationResponse, error)
-	GetNotifications(ctx context.Context, serviceProviderID string, lastChecked time.Time) (*GetNotificationsResponse, error)
+	GetNotifications(ctx context.Context, query Query) (*GetNotificationsResponse, error)
+	AcknowledgeNotifications(ctx context.Context, serviceProviderID string, req AcknowledgeRequest) (*AcknowledgeResponse, error)
+	CountUnread(ctx context.Context, serviceProviderID string) (*UnreadCountResponse, error)
+	// Subscribe subscribes to the notifications created for a service provider from now on.
+	Subscribe(serviceProviderID string) (*Subscription, error)
+	// CloseSubscriptions closes all subscriptions, e.g. when the server shuts down.
+	CloseSubscriptions()
+	// RegisterChannel adds a channel the created notifications are delivered through with the given settings.
+	// The in-app channel is registered by NewService. Channels must be registered before the service handles requests.
+	RegisterChannel(channel Channel, cfg config.ChannelConfig)
+	// GetDeliveries returns the deliveries of a notification of a service provider through every channel.
+	GetDeliveries(ctx context.Context, serviceProviderID, notificationID string) ([]Delivery, error)
+	// GetPreferences returns the notification preferences of a service provider.
+	GetPreferences(ctx context.Context, serviceProviderID string) (*Preferences, error)
+	UpdatePreferences(ctx context.Context, serviceProviderID string, req UpdatePreferencesRequest) (*Preferences, error)
+	// SavePreferences stores the given preferences of a service provider, e.g. after changing the settings of a channel.
+	SavePreferences(ctx context.Context, preferences Preferences) (*Preferences, error)
 	StartCleanupWorker(ctx context.Context)
+	// StartReleaseWorker starts sending the deliveries held during quiet hours once they end.
+	StartReleaseWorker(ctx context.Context)
+	// StartDigestWorker starts creating the digest notifications of the service providers who opted into digests, and
+	// the coalesced notifications of the bursts of ratings.
+	StartDigestWorker(ctx context.Context)
+	// Close stops delivering notifications and waits until the queued deliveries are done or the context is done.
+	Close(ctx context.Context) error
 }
 
+// ErrNotFound is returned for notifications which do not exist.
+var ErrNotFound = errors.New("notification not found")
+
 // service implements the Service interface
 type service struct {
 	storage        Storage
 	logger         log.Logger
 	circuitBreaker *circuitbreaker.CircuitBreaker
 	retryConfig    retry.RetryConfig
+	retryBudget    *retry.Budget
 	cleanupConfig  config.CleanupConfig
+	// the ratings of a service provider within the window after a notified rating are coalesced into one
+	// notification; 0 disables it
+	coalescingWindow time.Duration
+	bursts           *bursts
+	messages         *Messages
+	broker           *Broker
+	waiters          *waiters
+	dispatcher       *dispatcher
 }
 
-// NewService creates a new notification service
-func NewService(storage Storage, logger log.Logger, cfg config.Config) Service {
-	return &service{
-		storage:        storage,
-		logger:         logger,
-		circuitBreaker: circuitbreaker.New(cfg.CircuitBreaker, logger),
-		retryConfig:    cfg.Retry,
-		cleanupConfig:  cfg.Cleanup,
+const (
+	// releaseInterval is how often the held deliveries are checked; quiet hours end on a full minute.
+	releaseInterval = time.Minute
+	// digestInterval is how often the digest periods are checked for their end. Coalescing windows shorter than two
+	// intervals are checked more often.
+	digestInterval = time.Minute
+)
+
+// CircuitBreakerName is the name under which the service registers the circuit breaker guarding storage access.
+const CircuitBreakerName = "storage"
+
+// NewService creates a new notification service and registers its circuit breakers with the given registry.
+// Created notifications are delivered through the in-app channel and the channels registered with RegisterChannel,
+// and their messages are rendered with the given message templates.
+func NewService(storage Storage, breakers *circuitbreaker.Registry, logger log.Logger, cfg config.Config, messages *Messages) Service {
+	s := &service{
+		storage:          storage,
+		logger:           logger,
+		circuitBreaker:   breakers.New(CircuitBreakerName, cfg.CircuitBreaker, logger),
+		retryConfig:      cfg.Retry,
+		retryBudget:      newRetryBudget(cfg.Retry.Budget),
+		cleanupConfig:    cfg.Cleanup,
+		coalescingWindow: cfg.Coalescing.Window,
+		bursts:           newBursts(cfg.Coalescing.Window),
+		messages:         messages,
+		broker:           newBroker(cfg.Stream),
+		waiters:          newWaiters(),
+		dispatcher:       newDispatcher(storage, breakers, logger),
 	}
+	s.dispatcher.register(inAppChannel{}, cfg.Channels.InApp)
+	return s
 }
 
-// CreateNotification creates a new notification with circuit breaker and retry logic
-func (s *service) CreateNotification(ctx context.Context, req RatingNotificationRequest) (*CreateNotificationResponse, error) {
-	notification := NewNotification(req)
+// newBroker creates the broker which publishes created notifications to the streams.
+func newBroker(cfg config.StreamConfig) *Broker {
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 64
+	}
+	return NewBroker(cfg.MaxConnections, bufferSize)
+}
 
-	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
-		return retry.WithRetry(ctx, s.retryConfig, func(ctx context.Context) error {
-			return s.storage.StoreNotification(ctx, notification)
-		}, s.isRetryableError, s.logger)
-	})
+// newRetryBudget creates the retry budget shared by all storage calls, or nil when no budget is configured.
+func newRetryBudget(config retry.BudgetConfig) *retry.Budget {
+	if config.Percent == 0 && config.MinRetriesPerSecond == 0 {
+		return nil
+	}
+	return retry.NewBudget(config)
+}
+
+// retryOptions returns the options applied to every retried storage call.
+func (s *service) retryOptions() []retry.Option {
+	if s.retryBudget == nil {
+		return nil
+	}
+	return []retry.Option{retry.WithBudget(s.retryBudget)}
+}
 
+// CreateNotification creates a new notification with circuit breaker and retry logic.
+// Creating a notification for an event which already has one returns the existing notification, and notifications
+// filtered out by the preferences of the service provider are not created. The ratings of service providers who
+// opted into digests are collected for their next digest instead, and with a coalescing window, the ratings following
+// the first rating of a burst are collected for the notification sent when the window ends.
+func (s *service) CreateNotification(ctx context.Context, req RatingNotificationRequest) (*CreateNotificationResponse, error) {
+	preferences, err := s.GetPreferences(ctx, req.ServiceProviderID)
 	if err != nil {
-		s.logger.With(ctx, "error", err, "service_provider_id", req.ServiceProviderID).
-			Error("Failed to create notification")
 		return nil, fmt.Errorf("failed to create notification: %w", err)
 	}
+	notification := newNotification(s.messages, preferences.Locale, req)
+	if reason := preferences.suppresses(notification.Type, req.Rating); reason != "" {
+		s.logger.With(ctx, "service_provider_id", req.ServiceProviderID, "rating_id", req.RatingID, "reason", reason).
+			Info("Suppressed notification")
+		return &CreateNotificationResponse{
+			Message:    "Notification suppressed: " + reason,
+			Suppressed: true,
+		}, nil
+	}
+	if preferences.Digest != nil && notification.Type == EventRatingCreated {
+		return s.collect(ctx, req, notification, CreateNotificationResponse{
+			Message:    "Notification collected for the " + preferences.Digest.Frequency + " digest",
+			Suppressed: true,
+		})
+	}
+	if s.coalescingWindow > 0 && notification.Type == EventRatingCreated && !s.bursts.lead(req.ServiceProviderID, notification.CreatedAt) {
+		return s.collect(ctx, req, notification, CreateNotificationResponse{
+			Message:   "Notification coalesced with the ratings within " + s.coalescingWindow.String(),
+			Coalesced: true,
+		})
+	}
+
+	notification, created, err := s.storeNotification(ctx, notification)
+	if err != nil {
+		return nil, err
+	}
+
+	if !created {
+		s.logger.With(ctx, "notification_id", notification.ID, "service_provider_id", req.ServiceProviderID).
+			Info("Notification already exists")
+		return &CreateNotificationResponse{
+			ID:        notification.ID,
+			Message:   "Notification already exists",
+			Duplicate: true,
+		}, nil
+	}
 
 	s.logger.With(ctx, "notification_id", notification.ID, "service_provider_id", req.ServiceProviderID).
 		Info("Successfully created notification")
+	s.publish(notification)
+	s.dispatcher.dispatch(ctx, notification, *preferences, time.Now())
 
 	return &CreateNotificationResponse{
 		ID:      notification.ID,
@@ -63,35 +179,304 @@ func (s *service) CreateNotification(ctx context.Context, req RatingNotification
 	}, nil
 }
 
-// GetNotifications retrieves notifications with circuit breaker protection
-func (s *service) GetNotifications(ctx context.Context, serviceProviderID string, lastChecked time.Time) (*GetNotificationsResponse, error) {
-	var notifications []Notification
+// publish pushes a stored notification to the streams of its service provider and wakes its long polls.
+func (s *service) publish(notification Notification) {
+	s.broker.Publish(notification)
+	s.waiters.broadcast(notification.ServiceProviderID)
+}
 
-	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
-		return retry.WithRetry(ctx, s.retryConfig, func(ctx context.Context) error {
-			var retryErr error
-			notifications, retryErr = s.storage.GetNotifications(ctx, serviceProviderID, lastChecked)
-			return retryErr
-		}, s.isRetryableError, s.logger)
+// storeResult is the result of Storage.StoreNotification and Storage.AddDigestEntry.
+type storeResult struct {
+	notification Notification
+	created      bool
+}
+
+// storeNotification stores a notification unless it is a duplicate with circuit breaker and retry logic, and
+// returns the stored notification and whether it was created.
+func (s *service) storeNotification(ctx context.Context, notification Notification) (Notification, bool, error) {
+	var result storeResult
+
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		result, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) (storeResult, error) {
+			stored, created, err := s.storage.StoreNotification(ctx, notification)
+			return storeResult{notification: stored, created: created}, err
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
 	})
 
 	if err != nil {
-		s.logger.With(ctx, "error", err, "service_provider_id", serviceProviderID).
+		s.logger.With(ctx, "error", err, "service_provider_id", notification.ServiceProviderID).
+			Error("Failed to create notification")
+		return Notification{}, false, fmt.Errorf("failed to create notification: %w", err)
+	}
+	return result.notification, result.created, nil
+}
+
+// collect adds the rating of a notification to the digest entries of its service provider, and responds with the
+// given pending response. A rating sent again is a duplicate: of the notification summarizing it when there is one,
+// and otherwise of its digest entry, which is kept as is.
+func (s *service) collect(ctx context.Context, req RatingNotificationRequest, notification Notification, pending CreateNotificationResponse) (*CreateNotificationResponse, error) {
+	entry := DigestEntry{
+		ServiceProviderID:    req.ServiceProviderID,
+		ServiceProviderEmail: req.ServiceProviderEmail,
+		RatingID:             req.RatingID,
+		Rating:               req.Rating,
+		CustomerName:         req.CustomerName,
+		Comment:              req.Comment,
+		Data:                 req.Data,
+		CreatedAt:            notification.CreatedAt,
+	}
+	var result storeResult
+
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		result, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) (storeResult, error) {
+			existing, added, err := s.storage.AddDigestEntry(ctx, entry)
+			return storeResult{notification: existing, created: added}, err
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
+	})
+	if err != nil {
+		s.logger.With(ctx, "error", err, "service_provider_id", req.ServiceProviderID).
+			Error("Failed to collect rating")
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	logger := s.logger.With(ctx, "service_provider_id", req.ServiceProviderID, "rating_id", req.RatingID)
+	switch {
+	case result.notification.ID != "":
+		logger.With(ctx, "notification_id", result.notification.ID).Info("Rating already notified")
+		return &CreateNotificationResponse{
+			ID:        result.notification.ID,
+			Message:   "Notification already exists",
+			Duplicate: true,
+		}, nil
+	case !result.created:
+		logger.Info("Rating already collected")
+		pending.Duplicate = true
+		return &pending, nil
+	}
+
+	logger.Info("Collected rating")
+	return &pending, nil
+}
+
+// GetNotifications retrieves the notifications selected by the query with circuit breaker protection.
+// When no notification is selected and query.Wait is set, it waits up to query.Wait for a new notification
+// of the service provider and selects again.
+func (s *service) GetNotifications(ctx context.Context, query Query) (*GetNotificationsResponse, error) {
+	if query.Wait <= 0 {
+		return s.getNotifications(ctx, query)
+	}
+
+	timeout := time.NewTimer(query.Wait)
+	defer timeout.Stop()
+	for {
+		// register before selecting, so that a notification created in between wakes the request
+		wake, leave := s.waiters.wait(query.ServiceProviderID)
+		resp, err := s.getNotifications(ctx, query)
+		if err != nil || len(resp.Notifications) > 0 {
+			leave()
+			return resp, err
+		}
+
+		select {
+		case <-wake:
+		case <-timeout.C:
+			leave()
+			return resp, nil
+		case <-ctx.Done():
+			leave()
+			return nil, fmt.Errorf("stopped waiting for notifications: %w", ctx.Err())
+		}
+	}
+}
+
+// getNotifications selects the notifications of a query once.
+func (s *service) getNotifications(ctx context.Context, query Query) (*GetNotificationsResponse, error) {
+	var result QueryResult
+
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		result, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) (QueryResult, error) {
+			return s.storage.GetNotifications(ctx, query)
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
+	})
+
+	if err != nil {
+		s.logger.With(ctx, "error", err, "service_provider_id", query.ServiceProviderID).
 			Error("Failed to get notifications")
 		return nil, fmt.Errorf("failed to get notifications: %w", err)
 	}
 
-	s.logger.With(ctx, "service_provider_id", serviceProviderID, "count", len(notifications)).
+	s.logger.With(ctx, "service_provider_id", query.ServiceProviderID, "client_id", query.ClientID, "count", len(result.Notifications)).
 		Debug("Successfully retrieved notifications")
-	if notifications == nil {
-		notifications = []Notification{}
+	if result.Gap {
+		s.logger.With(ctx, "service_provider_id", query.ServiceProviderID, "client_id", query.ClientID).
+			Info("Notifications were removed before the client received them")
+	}
+	if result.Notifications == nil {
+		result.Notifications = []Notification{}
 	}
 	return &GetNotificationsResponse{
-		Notifications: notifications,
-		HasMore:       false,
+		Notifications: result.Notifications,
+		HasMore:       result.HasMore,
+		NextCursor:    result.Cursor,
+		Gap:           result.Gap,
 	}, nil
 }
 
+// AcknowledgeNotifications moves notifications of a service provider to the read state, or to the archived
+// state when requested, with circuit breaker protection
+func (s *service) AcknowledgeNotifications(ctx context.Context, serviceProviderID string, req AcknowledgeRequest) (*AcknowledgeResponse, error) {
+	state := req.State
+	if state == "" {
+		state = StateRead
+	}
+
+	var updated int
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		updated, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) (int, error) {
+			return s.storage.UpdateState(ctx, serviceProviderID, req.IDs, state)
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
+	})
+
+	if err != nil {
+		s.logger.With(ctx, "error", err, "service_provider_id", serviceProviderID).
+			Error("Failed to acknowledge notifications")
+		return nil, fmt.Errorf("failed to acknowledge notifications: %w", err)
+	}
+
+	s.logger.With(ctx, "service_provider_id", serviceProviderID, "state", state, "requested", len(req.IDs), "acknowledged", updated).
+		Info("Acknowledged notifications")
+
+	return &AcknowledgeResponse{Acknowledged: updated}, nil
+}
+
+// CountUnread counts the unread notifications of a service provider with circuit breaker protection
+func (s *service) CountUnread(ctx context.Context, serviceProviderID string) (*UnreadCountResponse, error) {
+	var count int
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		count, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) (int, error) {
+			return s.storage.CountNotifications(ctx, serviceProviderID, StateUnread)
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
+	})
+
+	if err != nil {
+		s.logger.With(ctx, "error", err, "service_provider_id", serviceProviderID).
+			Error("Failed to count unread notifications")
+		return nil, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return &UnreadCountResponse{Unread: count}, nil
+}
+
+// Subscribe subscribes to the notifications created for a service provider
+func (s *service) Subscribe(serviceProviderID string) (*Subscription, error) {
+	return s.broker.Subscribe(serviceProviderID)
+}
+
+// CloseSubscriptions closes all subscriptions
+func (s *service) CloseSubscriptions() {
+	s.broker.Close()
+}
+
+// RegisterChannel adds a channel to the dispatcher
+func (s *service) RegisterChannel(channel Channel, cfg config.ChannelConfig) {
+	s.dispatcher.register(channel, cfg)
+}
+
+// GetDeliveries returns the deliveries of a notification
+func (s *service) GetDeliveries(ctx context.Context, serviceProviderID, notificationID string) ([]Delivery, error) {
+	var deliveries []Delivery
+
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		deliveries, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) ([]Delivery, error) {
+			return s.storage.GetDeliveries(ctx, notificationID)
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+
+	// every created notification has deliveries; the notifications of other service providers do not exist for the caller
+	if len(deliveries) == 0 || deliveries[0].ServiceProviderID != serviceProviderID {
+		return nil, ErrNotFound
+	}
+	return deliveries, nil
+}
+
+// GetPreferences returns the stored preferences of a service provider, or the defaults
+func (s *service) GetPreferences(ctx context.Context, serviceProviderID string) (*Preferences, error) {
+	var preferences *Preferences
+
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) (err error) {
+		preferences, err = retry.WithRetryValue(ctx, s.retryConfig, func(ctx context.Context) (*Preferences, error) {
+			stored, found, err := s.storage.GetPreferences(ctx, serviceProviderID)
+			if err != nil || !found {
+				return nil, err
+			}
+			return &stored, nil
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+		return err
+	})
+	if err != nil {
+		s.logger.With(ctx, "error", err, "service_provider_id", serviceProviderID).
+			Error("Failed to get preferences")
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	if preferences == nil {
+		defaults := defaultPreferences(serviceProviderID)
+		preferences = &defaults
+	}
+	return preferences, nil
+}
+
+// UpdatePreferences replaces the preferences of a service provider
+func (s *service) UpdatePreferences(ctx context.Context, serviceProviderID string, req UpdatePreferencesRequest) (*Preferences, error) {
+	preferences := defaultPreferences(serviceProviderID)
+	preferences.MinRating = req.MinRating
+	preferences.QuietHours = req.QuietHours
+	preferences.Digest = req.Digest
+	preferences.Locale = req.Locale
+	preferences.EmailAddress = req.EmailAddress
+	for channel, enabled := range req.Channels {
+		preferences.Channels[channel] = enabled
+	}
+	for eventType, enabled := range req.Events {
+		preferences.Events[eventType] = enabled
+	}
+	return s.SavePreferences(ctx, preferences)
+}
+
+// SavePreferences stores the preferences of a service provider
+func (s *service) SavePreferences(ctx context.Context, preferences Preferences) (*Preferences, error) {
+	serviceProviderID := preferences.ServiceProviderID
+	preferences.UpdatedAt = time.Now()
+
+	err := s.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
+		return retry.WithRetry(ctx, s.retryConfig, func(ctx context.Context) error {
+			return s.storage.SavePreferences(ctx, preferences)
+		}, s.isRetryableError, s.logger, s.retryOptions()...)
+	})
+	if err != nil {
+		s.logger.With(ctx, "error", err, "service_provider_id", serviceProviderID).
+			Error("Failed to save preferences")
+		return nil, fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	s.logger.With(ctx, "service_provider_id", serviceProviderID).Info("Updated preferences")
+	return &preferences, nil
+}
+
+// Close stops the dispatcher
+func (s *service) Close(ctx context.Context) error {
+	return s.dispatcher.close(ctx)
+}
+
 // StartCleanupWorker starts a background worker to clean up old notifications
 func (s *service) StartCleanupWorker(ctx context.Context) {
 	s.logger.With(ctx, "interval", s.cleanupConfig.Interval, "max_age", s.cleanupConfig.MaxAge).
@@ -113,6 +498,47 @@ func (s *service) StartCleanupWorker(ctx context.Context) {
 	}
 }
 
+// StartReleaseWorker starts a background worker which sends the held deliveries when the quiet hours end
+func (s *service) StartReleaseWorker(ctx context.Context) {
+	s.logger.With(ctx, "interval", releaseInterval).Info("Starting held notification release worker")
+
+	ticker := time.NewTicker(releaseInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Stopping held notification release worker")
+			return
+		case now := <-ticker.C:
+			s.dispatcher.release(ctx, now)
+		}
+	}
+}
+
+// StartDigestWorker starts a background worker which sends the digests when their periods end, and the coalesced
+// notifications when their windows end
+func (s *service) StartDigestWorker(ctx context.Context) {
+	interval := digestInterval
+	if s.coalescingWindow > 0 {
+		interval = min(interval, max(s.coalescingWindow/2, time.Second))
+	}
+	s.logger.With(ctx, "interval", interval).Info("Starting digest worker")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Stopping digest worker")
+			return
+		case now := <-ticker.C:
+			s.sendDigests(ctx, now)
+		}
+	}
+}
+
 // isRetryableError determines if an error should trigger a retry
 func (s *service) isRetryableError(err error) bool {
 	// For simplicity, considered most errors as retryable
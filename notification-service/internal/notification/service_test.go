@@ -11,6 +11,7 @@ import (
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var errStorage = errors.New("storage error")
@@ -20,29 +21,119 @@ type mockStorage struct {
 	notifications []Notification
 	storeError    error
 	getError      error
+	updateError   error
 	cleanupError  error
 }
 
-func (m *mockStorage) StoreNotification(ctx context.Context, notification Notification) error {
+func (m *mockStorage) StoreNotification(ctx context.Context, notification Notification) (Notification, bool, error) {
 	if m.storeError != nil {
-		return m.storeError
+		return Notification{}, false, m.storeError
+	}
+	for _, n := range m.notifications {
+		if n.IdempotencyKey() == notification.IdempotencyKey() {
+			return n, false, nil
+		}
 	}
 	m.notifications = append(m.notifications, notification)
-	return nil
+	return notification, true, nil
 }
 
-func (m *mockStorage) GetNotifications(ctx context.Context, serviceProviderID string, lastChecked time.Time) ([]Notification, error) {
+func (m *mockStorage) GetNotifications(ctx context.Context, query Query) (QueryResult, error) {
 	if m.getError != nil {
-		return nil, m.getError
+		return QueryResult{}, m.getError
 	}
 
 	var result []Notification
 	for _, n := range m.notifications {
-		if n.ServiceProviderID == serviceProviderID && n.CreatedAt.After(lastChecked) {
+		if n.ServiceProviderID == query.ServiceProviderID && n.CreatedAt.After(query.LastChecked) {
 			result = append(result, n)
 		}
 	}
-	return result, nil
+	return QueryResult{Notifications: result}, nil
+}
+
+func (m *mockStorage) UpdateState(ctx context.Context, serviceProviderID string, ids []string, state string) (int, error) {
+	if m.updateError != nil {
+		return 0, m.updateError
+	}
+
+	updated := 0
+	for i, n := range m.notifications {
+		for _, id := range ids {
+			if n.ServiceProviderID == serviceProviderID && n.ID == id && canTransition(n.State, state) {
+				m.notifications[i].State = state
+				updated++
+			}
+		}
+	}
+	return updated, nil
+}
+
+func (m *mockStorage) CountNotifications(ctx context.Context, serviceProviderID string, state string) (int, error) {
+	if m.getError != nil {
+		return 0, m.getError
+	}
+
+	count := 0
+	for _, n := range m.notifications {
+		if n.ServiceProviderID == serviceProviderID && n.State == state {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockStorage) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	return nil
+}
+
+func (m *mockStorage) GetDeliveries(ctx context.Context, notificationID string) ([]Delivery, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) GetNotification(ctx context.Context, serviceProviderID, id string) (Notification, error) {
+	for _, n := range m.notifications {
+		if n.ServiceProviderID == serviceProviderID && n.ID == id {
+			return n, nil
+		}
+	}
+	return Notification{}, ErrNotFound
+}
+
+func (m *mockStorage) ListHeldDeliveries(ctx context.Context, until time.Time) ([]Delivery, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) GetPreferences(ctx context.Context, serviceProviderID string) (Preferences, bool, error) {
+	return Preferences{}, false, nil
+}
+
+func (m *mockStorage) SavePreferences(ctx context.Context, preferences Preferences) error {
+	return nil
+}
+
+func (m *mockStorage) AddDigestEntry(ctx context.Context, entry DigestEntry) (Notification, bool, error) {
+	return Notification{}, true, nil
+}
+
+func (m *mockStorage) ListDigestServiceProviders(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) GetDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) ([]DigestEntry, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) DeleteDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) error {
+	return nil
+}
+
+func (m *mockStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockStorage) Close() error {
+	return nil
 }
 
 func (m *mockStorage) Cleanup(ctx context.Context, maxAge time.Duration) error {
@@ -100,7 +191,7 @@ func TestService_CreateNotification(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := NewService(tt.storage, logger, cfg)
+			service := NewService(tt.storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
 			ctx := context.Background()
 
 			response, err := service.CreateNotification(ctx, tt.request)
@@ -118,6 +209,47 @@ func TestService_CreateNotification(t *testing.T) {
 	}
 }
 
+func TestService_CreateNotification_Idempotent(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+	storage := &mockStorage{}
+	service := NewService(storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+	channel := &recordingChannel{name: ChannelEmail}
+	service.RegisterChannel(channel, config.ChannelConfig{})
+	ctx := context.Background()
+	request := RatingNotificationRequest{
+		ServiceProviderID: "123e4567-e89b-12d3-a456-426614174000",
+		RatingID:          "456e7890-e89b-12d3-a456-426614174001",
+		Rating:            5,
+	}
+
+	first, err := service.CreateNotification(ctx, request)
+	assert.NoError(t, err)
+	assert.False(t, first.Duplicate)
+
+	// a replay of the same event, with or without an explicit type, returns the original notification
+	request.Type = EventRatingCreated
+	replay, err := service.CreateNotification(ctx, request)
+	assert.NoError(t, err)
+	assert.True(t, replay.Duplicate)
+	assert.Equal(t, first.ID, replay.ID)
+	assert.Len(t, storage.notifications, 1)
+
+	// a different rating of the same service provider is a new notification
+	request.RatingID = "456e7890-e89b-12d3-a456-426614174002"
+	other, err := service.CreateNotification(ctx, request)
+	assert.NoError(t, err)
+	assert.False(t, other.Duplicate)
+	assert.NotEqual(t, first.ID, other.ID)
+
+	// only created notifications are dispatched
+	assert.NoError(t, service.Close(ctx))
+	assert.Equal(t, []string{first.ID, other.ID}, channel.sent())
+}
+
 func TestService_GetNotifications(t *testing.T) {
 	logger, _ := log.NewForTest()
 	cfg := config.Config{
@@ -202,10 +334,10 @@ func TestService_GetNotifications(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := NewService(tt.storage, logger, cfg)
+			service := NewService(tt.storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
 			ctx := context.Background()
 
-			response, err := service.GetNotifications(ctx, tt.serviceProviderID, tt.lastChecked)
+			response, err := service.GetNotifications(ctx, Query{ServiceProviderID: tt.serviceProviderID, LastChecked: tt.lastChecked})
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -220,6 +352,92 @@ func TestService_GetNotifications(t *testing.T) {
 	}
 }
 
+func TestService_GetNotifications_Wait(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+	serviceProviderID := "123e4567-e89b-12d3-a456-426614174000"
+	newService := func() Service {
+		return NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+	}
+
+	t.Run("wakes up on a new notification", func(t *testing.T) {
+		service := newService()
+		other := "223e4567-e89b-12d3-a456-426614174000"
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			_, _ = service.CreateNotification(context.Background(), RatingNotificationRequest{ServiceProviderID: other, RatingID: "rating0", Rating: 3})
+			_, _ = service.CreateNotification(context.Background(), RatingNotificationRequest{ServiceProviderID: serviceProviderID, RatingID: "rating1", Rating: 5})
+		}()
+
+		start := time.Now()
+		response, err := service.GetNotifications(context.Background(), Query{ServiceProviderID: serviceProviderID, Wait: 10 * time.Second})
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		if assert.Len(t, response.Notifications, 1) {
+			assert.Equal(t, "rating1", response.Notifications[0].RatingID)
+		}
+	})
+
+	t.Run("wakes up during quiet hours and with the in_app channel disabled", func(t *testing.T) {
+		service := newService()
+		now := time.Now().UTC()
+		_, err := service.SavePreferences(context.Background(), Preferences{
+			ServiceProviderID: serviceProviderID,
+			Channels:          map[string]bool{ChannelInApp: false},
+			QuietHours: &QuietHours{
+				Start:    now.Add(-time.Hour).Format("15:04"),
+				End:      now.Add(time.Hour).Format("15:04"),
+				Timezone: "UTC",
+			},
+		})
+		require.NoError(t, err)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			_, _ = service.CreateNotification(context.Background(), RatingNotificationRequest{ServiceProviderID: serviceProviderID, RatingID: "rating1", Rating: 5})
+		}()
+
+		start := time.Now()
+		response, err := service.GetNotifications(context.Background(), Query{ServiceProviderID: serviceProviderID, Wait: 10 * time.Second})
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second, "long polls agree with fetching")
+		assert.Len(t, response.Notifications, 1)
+	})
+
+	t.Run("returns existing notifications immediately", func(t *testing.T) {
+		service := newService()
+		_, err := service.CreateNotification(context.Background(), RatingNotificationRequest{ServiceProviderID: serviceProviderID, RatingID: "rating1", Rating: 5})
+		assert.NoError(t, err)
+
+		start := time.Now()
+		response, err := service.GetNotifications(context.Background(), Query{ServiceProviderID: serviceProviderID, Wait: 10 * time.Second})
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.Len(t, response.Notifications, 1)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		svc := newService()
+		response, err := svc.GetNotifications(context.Background(), Query{ServiceProviderID: serviceProviderID, Wait: 20 * time.Millisecond})
+		assert.NoError(t, err)
+		assert.Empty(t, response.Notifications)
+		assert.Empty(t, svc.(*service).waiters.signals, "requests which time out stop waiting")
+	})
+
+	t.Run("stops when the context is cancelled", func(t *testing.T) {
+		svc := newService()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		response, err := svc.GetNotifications(ctx, Query{ServiceProviderID: serviceProviderID, Wait: 10 * time.Second})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Nil(t, response)
+		assert.Empty(t, svc.(*service).waiters.signals, "cancelled requests stop waiting")
+	})
+}
+
 func TestService_StartCleanupWorker(t *testing.T) {
 	logger, _ := log.NewForTest()
 	cfg := config.Config{
@@ -232,7 +450,7 @@ func TestService_StartCleanupWorker(t *testing.T) {
 	}
 
 	storage := &mockStorage{}
-	service := NewService(storage, logger, cfg)
+	service := NewService(storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cancel()
@@ -255,9 +473,38 @@ func TestService_isRetryableError(t *testing.T) {
 		},
 	}
 
-	service := NewService(&mockStorage{}, logger, cfg).(*service)
+	service := NewService(&mockStorage{}, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages).(*service)
 
 	// Test that all errors are considered retryable (current implementation)
 	assert.True(t, service.isRetryableError(errors.New("some error")))
 	assert.True(t, service.isRetryableError(errStorage))
 }
+
+func TestService_AcknowledgeNotifications(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.RetryConfig{MaxAttempts: 1, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1},
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+	}
+	storage := &mockStorage{notifications: []Notification{
+		{ID: "1", ServiceProviderID: "sp", State: StateUnread},
+		{ID: "2", ServiceProviderID: "sp", State: StateUnread},
+	}}
+	service := NewService(storage, circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+	ctx := context.Background()
+
+	// the state defaults to read
+	response, err := service.AcknowledgeNotifications(ctx, "sp", AcknowledgeRequest{IDs: []string{"1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, response.Acknowledged)
+	assert.Equal(t, StateRead, storage.notifications[0].State)
+
+	count, err := service.CountUnread(ctx, "sp")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count.Unread)
+
+	storage.updateError = errStorage
+	response, err = service.AcknowledgeNotifications(ctx, "sp", AcknowledgeRequest{IDs: []string{"2"}, State: StateArchived})
+	assert.Error(t, err)
+	assert.Nil(t, response)
+}
@@ -2,111 +2,432 @@ package notification
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
 )
 
-// Storage represents the notification storage interface
+var tracer = tracing.Tracer("github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification")
+
+// Query selects the notifications of a service provider in the order of their sequence numbers.
+//
+// Without a ClientID, the unread notifications after the sequence number After are selected and, unless Peek is
+// set, marked as read. IncludeRead selects the read notifications as well; it requires Peek.
+//
+// With a ClientID, the notifications which are not archived and have a sequence number after the client's cursor
+// are selected and, unless Peek is set, the cursor moves past them. The state of the notifications is left as is,
+// so that every client of a service provider receives every notification exactly once.
+type Query struct {
+	ServiceProviderID string
+	// only notifications created after LastChecked are returned
+	LastChecked time.Time
+	Peek        bool
+	IncludeRead bool
+	ClientID    string
+	// After replaces the saved cursor of the client when set
+	After *uint64
+	// the maximum number of notifications returned; 0 means no limit
+	Limit int
+	// how long the service waits for a new notification when none is selected; the storage ignores it
+	Wait time.Duration
+}
+
+// Storage represents the notification storage interface. Notifications stored without a state are unread.
+// The storage assigns the sequence numbers of the notifications; they are never reused, not even after cleanup.
 type Storage interface {
-	StoreNotification(ctx context.Context, notification Notification) error
-	GetNotifications(ctx context.Context, serviceProviderID string, lastChecked time.Time) ([]Notification, error)
+	// StoreNotification stores the notification unless a notification with the same idempotency key exists.
+	// It returns the stored notification, which is the existing one for a duplicate, and whether it was created.
+	// The idempotency keys of the ratings a notification summarizes are recorded as well, see IdempotencyKeys.
+	StoreNotification(ctx context.Context, notification Notification) (Notification, bool, error)
+	// GetNotification returns a notification of a service provider, or ErrNotFound.
+	GetNotification(ctx context.Context, serviceProviderID, id string) (Notification, error)
+	// GetNotifications returns the notifications selected by the query.
+	GetNotifications(ctx context.Context, query Query) (QueryResult, error)
+	// UpdateState moves the given notifications of a service provider to the given state. Notifications which
+	// do not exist or cannot move to the state are skipped. It returns the number of updated notifications.
+	UpdateState(ctx context.Context, serviceProviderID string, ids []string, state string) (int, error)
+	// CountNotifications returns the number of notifications of a service provider in the given state.
+	CountNotifications(ctx context.Context, serviceProviderID string, state string) (int, error)
+	// SaveDelivery creates or replaces the delivery of a notification through a channel.
+	SaveDelivery(ctx context.Context, delivery Delivery) error
+	// GetDeliveries returns the deliveries of a notification ordered by channel name.
+	GetDeliveries(ctx context.Context, notificationID string) ([]Delivery, error)
+	// ListHeldDeliveries returns the held deliveries which are released at or before the given time.
+	ListHeldDeliveries(ctx context.Context, until time.Time) ([]Delivery, error)
+	// GetPreferences returns the preferences of a service provider and whether any are stored.
+	GetPreferences(ctx context.Context, serviceProviderID string) (Preferences, bool, error)
+	// SavePreferences creates or replaces the preferences of a service provider.
+	SavePreferences(ctx context.Context, preferences Preferences) error
+	// AddDigestEntry collects a rating for the next digest of its service provider and returns whether it was added.
+	// A rating which was collected before is kept as is, and a rating which a stored notification covers already is
+	// not collected again; that notification is returned instead.
+	AddDigestEntry(ctx context.Context, entry DigestEntry) (Notification, bool, error)
+	// ListDigestServiceProviders returns the IDs of the service providers with collected digest entries.
+	ListDigestServiceProviders(ctx context.Context) ([]string, error)
+	// GetDigestEntries returns the digest entries of a service provider created before the given time, the oldest
+	// first.
+	GetDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) ([]DigestEntry, error)
+	// DeleteDigestEntries removes the digest entries of a service provider created before the given time.
+	DeleteDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) error
+	// Cleanup removes the notifications older than maxAge together with their deliveries. Notifications with held
+	// deliveries are kept until they are released.
 	Cleanup(ctx context.Context, maxAge time.Duration) error
+	// Ping checks that the storage can be read, for the readiness checks.
+	Ping(ctx context.Context) error
+	// Close releases the resources held by the storage.
+	Close() error
+}
+
+// NewStorage creates the storage backend selected by the configuration.
+func NewStorage(cfg config.StorageConfig, logger log.Logger) (Storage, error) {
+	switch cfg.Backend {
+	case "", config.StorageMemory:
+		return NewInMemoryStorage(logger), nil
+	case config.StorageBolt:
+		return NewBoltStorage(cfg.Path, logger)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// clientKey identifies a client of a service provider
+type clientKey struct {
+	serviceProviderID string
+	clientID          string
 }
 
 // inMemoryStorage implements Storage using in-memory data structures
 type inMemoryStorage struct {
-	mu                     sync.RWMutex
-	notifications          map[string][]Notification  // map[serviceProviderID][]Notification
-	deliveredNotifications map[string]map[string]bool // map[serviceProviderID]map[notificationID]bool
-	logger                 log.Logger
+	mu              sync.RWMutex
+	notifications   map[string][]*Notification // map[serviceProviderID][]*Notification
+	idempotencyKeys map[string]*Notification   // map[idempotencyKey]*Notification
+	sequences       map[string]uint64          // map[serviceProviderID]last sequence number
+	cursors         map[clientKey]uint64
+	deliveries      map[string]map[string]Delivery    // map[notificationID]map[channel]Delivery
+	preferences     map[string]Preferences            // map[serviceProviderID]Preferences
+	digests         map[string]map[string]DigestEntry // map[serviceProviderID]map[ratingID]DigestEntry
+	logger          log.Logger
 }
 
 // NewInMemoryStorage creates a new in-memory storage instance
 func NewInMemoryStorage(logger log.Logger) Storage {
 	return &inMemoryStorage{
-		notifications:          make(map[string][]Notification),
-		deliveredNotifications: make(map[string]map[string]bool),
-		logger:                 logger,
+		notifications:   make(map[string][]*Notification),
+		idempotencyKeys: make(map[string]*Notification),
+		sequences:       make(map[string]uint64),
+		cursors:         make(map[clientKey]uint64),
+		deliveries:      make(map[string]map[string]Delivery),
+		preferences:     make(map[string]Preferences),
+		digests:         make(map[string]map[string]DigestEntry),
+		logger:          logger,
 	}
 }
 
-// StoreNotification stores a notification in memory
-func (s *inMemoryStorage) StoreNotification(ctx context.Context, notification Notification) error {
+// StoreNotification stores a notification in memory unless it is a duplicate of a stored one
+func (s *inMemoryStorage) StoreNotification(ctx context.Context, notification Notification) (Notification, bool, error) {
+	_, span := tracer.Start(ctx, "notification.Storage.StoreNotification")
+	defer span.End()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if notification.State == "" {
+		notification.State = StateUnread
+	}
+
+	key := notification.IdempotencyKey()
+	if existing, exists := s.idempotencyKeys[key]; exists {
+		s.logger.With(ctx, "service_provider_id", notification.ServiceProviderID, "notification_id", existing.ID).
+			Info("Notification already stored")
+		return *existing, false, nil
+	}
+
 	s.logger.With(ctx, "service_provider_id", notification.ServiceProviderID, "notification_id", notification.ID).
 		Info("Storing notification")
 
+	s.sequences[notification.ServiceProviderID]++
+	notification.Sequence = s.sequences[notification.ServiceProviderID]
+
+	stored := notification
 	s.notifications[notification.ServiceProviderID] = append(
 		s.notifications[notification.ServiceProviderID],
-		notification,
+		&stored,
 	)
+	for _, key := range notification.IdempotencyKeys() {
+		if _, exists := s.idempotencyKeys[key]; !exists {
+			s.idempotencyKeys[key] = &stored
+		}
+	}
 
-	return nil
+	return notification, true, nil
 }
 
-// GetNotifications retrieves notifications for a service provider created after the given timestamp
-// and marks them as delivered so they won't be returned again
-func (s *inMemoryStorage) GetNotifications(ctx context.Context, serviceProviderID string, lastChecked time.Time) ([]Notification, error) {
+// GetNotifications retrieves the notifications selected by the query
+func (s *inMemoryStorage) GetNotifications(ctx context.Context, query Query) (QueryResult, error) {
+	_, span := tracer.Start(ctx, "notification.Storage.GetNotifications")
+	defer span.End()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.logger.With(ctx, "service_provider_id", serviceProviderID, "last_checked", lastChecked).
+	s.logger.With(ctx, "service_provider_id", query.ServiceProviderID, "last_checked", query.LastChecked, "peek", query.Peek).
 		Debug("Retrieving notifications")
 
-	allNotifications, exists := s.notifications[serviceProviderID]
-	if !exists {
-		return []Notification{}, nil
-	}
+	allNotifications := s.notifications[query.ServiceProviderID]
+	key := clientKey{query.ServiceProviderID, query.ClientID}
 
-	// Initialize delivered map for this service provider if it doesn't exist
-	if s.deliveredNotifications[serviceProviderID] == nil {
-		s.deliveredNotifications[serviceProviderID] = make(map[string]bool)
+	selection := newSelection(query)
+	if query.ClientID != "" {
+		oldest := s.sequences[query.ServiceProviderID] + 1
+		if len(allNotifications) > 0 {
+			oldest = allNotifications[0].Sequence
+		}
+		cursor, known := s.cursors[key]
+		selection = newClientSelection(query, cursor, known, oldest)
 	}
 
-	// Filter notifications created after lastChecked AND not yet delivered
-	var newNotifications []Notification
 	for _, notification := range allNotifications {
-		if notification.CreatedAt.After(lastChecked) && !s.deliveredNotifications[serviceProviderID][notification.ID] {
-			newNotifications = append(newNotifications, notification)
-			s.deliveredNotifications[serviceProviderID][notification.ID] = true
+		selected, more := selection.add(*notification)
+		if selected && selection.consumes() {
+			notification.State = StateRead
+			selection.result.Notifications[len(selection.result.Notifications)-1].State = StateRead
+		}
+		if !more {
+			break
+		}
+	}
+	if selection.moved() {
+		s.cursors[key] = selection.result.Cursor
+	}
+
+	s.logger.With(ctx, "service_provider_id", query.ServiceProviderID, "total_count", len(allNotifications), "new_count", len(selection.result.Notifications)).
+		Debug("Retrieved notifications")
+
+	return selection.result, nil
+}
+
+// UpdateState moves the given notifications of a service provider to the given state
+func (s *inMemoryStorage) UpdateState(ctx context.Context, serviceProviderID string, ids []string, state string) (int, error) {
+	_, span := tracer.Start(ctx, "notification.Storage.UpdateState")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	updated := 0
+	for _, notification := range s.notifications[serviceProviderID] {
+		if selected[notification.ID] && canTransition(notification.State, state) {
+			notification.State = state
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// CountNotifications returns the number of notifications of a service provider in the given state
+func (s *inMemoryStorage) CountNotifications(ctx context.Context, serviceProviderID string, state string) (int, error) {
+	_, span := tracer.Start(ctx, "notification.Storage.CountNotifications")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, notification := range s.notifications[serviceProviderID] {
+		if notification.State == state {
+			count++
 		}
 	}
+	return count, nil
+}
+
+// SaveDelivery stores the delivery of a notification through a channel
+func (s *inMemoryStorage) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries, ok := s.deliveries[delivery.NotificationID]
+	if !ok {
+		deliveries = make(map[string]Delivery)
+		s.deliveries[delivery.NotificationID] = deliveries
+	}
+	deliveries[delivery.Channel] = delivery
+	return nil
+}
+
+// GetDeliveries returns the deliveries of a notification
+func (s *inMemoryStorage) GetDeliveries(ctx context.Context, notificationID string) ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]Delivery, 0, len(s.deliveries[notificationID]))
+	for _, delivery := range s.deliveries[notificationID] {
+		deliveries = append(deliveries, delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Channel < deliveries[j].Channel
+	})
+	return deliveries, nil
+}
 
-	s.logger.With(ctx, "service_provider_id", serviceProviderID, "total_count", len(allNotifications), "new_count", len(newNotifications)).
-		Debug("Retrieved and marked notifications as delivered")
+// GetNotification returns a notification of a service provider
+func (s *inMemoryStorage) GetNotification(ctx context.Context, serviceProviderID, id string) (Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return newNotifications, nil
+	for _, notification := range s.notifications[serviceProviderID] {
+		if notification.ID == id {
+			return *notification, nil
+		}
+	}
+	return Notification{}, ErrNotFound
+}
+
+// ListHeldDeliveries returns the held deliveries which are due
+func (s *inMemoryStorage) ListHeldDeliveries(ctx context.Context, until time.Time) ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var held []Delivery
+	for _, deliveries := range s.deliveries {
+		for _, delivery := range deliveries {
+			if delivery.State == DeliveryHeld && !delivery.ReleaseAt.After(until) {
+				held = append(held, delivery)
+			}
+		}
+	}
+	return held, nil
+}
+
+// GetPreferences returns the preferences of a service provider
+func (s *inMemoryStorage) GetPreferences(ctx context.Context, serviceProviderID string) (Preferences, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	preferences, ok := s.preferences[serviceProviderID]
+	return preferences, ok, nil
+}
+
+// SavePreferences stores the preferences of a service provider
+func (s *inMemoryStorage) SavePreferences(ctx context.Context, preferences Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preferences[preferences.ServiceProviderID] = preferences
+	return nil
+}
+
+// AddDigestEntry stores a digest entry unless the rating was collected or notified before
+func (s *inMemoryStorage) AddDigestEntry(ctx context.Context, entry DigestEntry) (Notification, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.idempotencyKeys[ratingIdempotencyKey(entry.ServiceProviderID, entry.RatingID)]; exists {
+		return *existing, false, nil
+	}
+	entries, ok := s.digests[entry.ServiceProviderID]
+	if !ok {
+		entries = make(map[string]DigestEntry)
+		s.digests[entry.ServiceProviderID] = entries
+	}
+	if _, collected := entries[entry.RatingID]; collected {
+		return Notification{}, false, nil
+	}
+	entries[entry.RatingID] = entry
+	return Notification{}, true, nil
+}
+
+// ListDigestServiceProviders returns the service providers with digest entries
+func (s *inMemoryStorage) ListDigestServiceProviders(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	serviceProviderIDs := make([]string, 0, len(s.digests))
+	for serviceProviderID := range s.digests {
+		serviceProviderIDs = append(serviceProviderIDs, serviceProviderID)
+	}
+	sort.Strings(serviceProviderIDs)
+	return serviceProviderIDs, nil
+}
+
+// GetDigestEntries returns the digest entries of a service provider created before the given time
+func (s *inMemoryStorage) GetDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) ([]DigestEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []DigestEntry{}
+	for _, entry := range s.digests[serviceProviderID] {
+		if entry.CreatedAt.Before(before) {
+			entries = append(entries, entry)
+		}
+	}
+	sortDigestEntries(entries)
+	return entries, nil
+}
+
+// DeleteDigestEntries removes the digest entries of a service provider created before the given time
+func (s *inMemoryStorage) DeleteDigestEntries(ctx context.Context, serviceProviderID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.digests[serviceProviderID]
+	for ratingID, entry := range entries {
+		if entry.CreatedAt.Before(before) {
+			delete(entries, ratingID)
+		}
+	}
+	if len(entries) == 0 {
+		delete(s.digests, serviceProviderID)
+	}
+	return nil
+}
+
+// sortDigestEntries sorts digest entries by creation time, and by rating ID for entries created at the same time.
+func sortDigestEntries(entries []DigestEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].RatingID < entries[j].RatingID
+	})
 }
 
 // Cleanup removes old notifications to prevent memory leaks
 func (s *inMemoryStorage) Cleanup(ctx context.Context, maxAge time.Duration) error {
+	_, span := tracer.Start(ctx, "notification.Storage.Cleanup")
+	defer span.End()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	cutoff := time.Now().Add(-maxAge)
 	totalRemoved := 0
-	totalDeliveredRemoved := 0
 
 	for serviceProviderID, notifications := range s.notifications {
-		var keepNotifications []Notification
+		var keepNotifications []*Notification
 		removedCount := 0
 
 		for _, notification := range notifications {
-			if notification.CreatedAt.After(cutoff) {
+			if notification.CreatedAt.After(cutoff) || isHeld(s.deliveries[notification.ID]) {
 				keepNotifications = append(keepNotifications, notification)
 			} else {
 				removedCount++
-				// Also remove from delivered tracking when we remove the notification
-				if s.deliveredNotifications[serviceProviderID] != nil {
-					if s.deliveredNotifications[serviceProviderID][notification.ID] {
-						delete(s.deliveredNotifications[serviceProviderID], notification.ID)
-						totalDeliveredRemoved++
+				for _, key := range notification.IdempotencyKeys() {
+					if s.idempotencyKeys[key] == notification {
+						delete(s.idempotencyKeys, key)
 					}
 				}
+				delete(s.deliveries, notification.ID)
 			}
 		}
 
@@ -119,17 +440,32 @@ func (s *inMemoryStorage) Cleanup(ctx context.Context, maxAge time.Duration) err
 		if len(keepNotifications) == 0 {
 			delete(s.notifications, serviceProviderID)
 		}
-
-		// Remove empty delivered tracking maps to save memory
-		if s.deliveredNotifications[serviceProviderID] != nil && len(s.deliveredNotifications[serviceProviderID]) == 0 {
-			delete(s.deliveredNotifications, serviceProviderID)
-		}
 	}
 
 	if totalRemoved > 0 {
-		s.logger.With(ctx, "removed_notifications", totalRemoved, "removed_delivered_tracking", totalDeliveredRemoved, "cutoff", cutoff).
-			Info("Cleaned up old notifications and delivery tracking")
+		s.logger.With(ctx, "removed_notifications", totalRemoved, "cutoff", cutoff).
+			Info("Cleaned up old notifications")
 	}
 
 	return nil
 }
+
+// isHeld reports whether any of the deliveries of a notification is held.
+func isHeld(deliveries map[string]Delivery) bool {
+	for _, delivery := range deliveries {
+		if delivery.State == DeliveryHeld {
+			return true
+		}
+	}
+	return false
+}
+
+// Ping always succeeds as the in-memory storage cannot fail.
+func (s *inMemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing as the in-memory storage holds no resources.
+func (s *inMemoryStorage) Close() error {
+	return nil
+}
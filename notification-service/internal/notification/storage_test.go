@@ -2,26 +2,71 @@ package notification
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestInMemoryStorage_StoreAndGetNotifications(t *testing.T) {
-	logger, _ := log.NewForTest()
-	storage := NewInMemoryStorage(logger)
+// storageBackends creates an instance of every Storage implementation.
+var storageBackends = map[string]func(t *testing.T) Storage{
+	"memory": func(t *testing.T) Storage {
+		logger, _ := log.NewForTest()
+		return NewInMemoryStorage(logger)
+	},
+	"bolt": func(t *testing.T) Storage {
+		logger, _ := log.NewForTest()
+		storage, err := NewBoltStorage(filepath.Join(t.TempDir(), "notifications.db"), logger)
+		require.NoError(t, err)
+		return storage
+	},
+}
+
+// TestStorage runs the same contract tests against every Storage implementation.
+func TestStorage(t *testing.T) {
+	tests := map[string]func(t *testing.T, storage Storage){
+		"StoreAndGetNotifications": testStorageStoreAndGetNotifications,
+		"Cleanup":                  testStorageCleanup,
+		"StoreDuplicate":           testStorageStoreDuplicate,
+		"States":                   testStorageStates,
+		"ClientCursors":            testStorageClientCursors,
+		"ClientCursorGap":          testStorageClientCursorGap,
+		"Pagination":               testStoragePagination,
+		"ClientPagination":         testStorageClientPagination,
+		"Deliveries":               testStorageDeliveries,
+		"HeldDeliveries":           testStorageHeldDeliveries,
+		"Preferences":              testStoragePreferences,
+		"DigestEntries":            testStorageDigestEntries,
+		"SummarizedRatings":        testStorageSummarizedRatings,
+		"Ping":                     testStoragePing,
+	}
+	for backend, newStorage := range storageBackends {
+		for name, test := range tests {
+			t.Run(backend+"/"+name, func(t *testing.T) {
+				storage := newStorage(t)
+				defer func() { assert.NoError(t, storage.Close()) }()
+				test(t, storage)
+			})
+		}
+	}
+}
+
+func testStorageStoreAndGetNotifications(t *testing.T, storage Storage) {
 	ctx := context.Background()
 
 	// Test data
 	serviceProviderID := "test-provider-id"
 	notification1 := Notification{
-		ID:                "notif-1",
-		ServiceProviderID: serviceProviderID,
-		Message:           "New 5-star rating received",
-		RatingID:          "rating-1",
-		CreatedAt:         time.Now(),
+		ID:                   "notif-1",
+		ServiceProviderID:    serviceProviderID,
+		ServiceProviderEmail: "provider@example.com",
+		Message:              "New 5-star rating received",
+		RatingID:             "rating-1",
+		CreatedAt:            time.Now(),
 	}
 	notification2 := Notification{
 		ID:                "notif-2",
@@ -32,19 +77,20 @@ func TestInMemoryStorage_StoreAndGetNotifications(t *testing.T) {
 	}
 
 	// Store notifications
-	err := storage.StoreNotification(ctx, notification1)
+	_, _, err := storage.StoreNotification(ctx, notification1)
 	assert.NoError(t, err)
 
-	err = storage.StoreNotification(ctx, notification2)
+	_, _, err = storage.StoreNotification(ctx, notification2)
 	assert.NoError(t, err)
 
 	// Get all notifications (first call)
-	notifications, err := storage.GetNotifications(ctx, serviceProviderID, time.Time{})
+	notifications, err := notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: serviceProviderID}))
 	assert.NoError(t, err)
-	assert.Len(t, notifications, 2)
+	require.Len(t, notifications, 2)
+	assert.Equal(t, "provider@example.com", notifications[0].ServiceProviderEmail, "the email address is stored")
 
 	// Get all notifications again (second call) - should return empty since they were already delivered
-	notifications, err = storage.GetNotifications(ctx, serviceProviderID, time.Time{})
+	notifications, err = notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: serviceProviderID}))
 	assert.NoError(t, err)
 	assert.Len(t, notifications, 0, "Second call should return no notifications as they were already delivered")
 
@@ -56,24 +102,22 @@ func TestInMemoryStorage_StoreAndGetNotifications(t *testing.T) {
 		RatingID:          "rating-3",
 		CreatedAt:         time.Now().Add(2 * time.Minute),
 	}
-	err = storage.StoreNotification(ctx, notification3)
+	_, _, err = storage.StoreNotification(ctx, notification3)
 	assert.NoError(t, err)
 
 	// Get notifications after storing new one - should return only the new notification
-	notifications, err = storage.GetNotifications(ctx, serviceProviderID, time.Time{})
+	notifications, err = notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: serviceProviderID}))
 	assert.NoError(t, err)
 	assert.Len(t, notifications, 1)
 	assert.Equal(t, notification3.ID, notifications[0].ID)
 
 	// Get notifications for non-existent provider
-	notifications, err = storage.GetNotifications(ctx, "non-existent", time.Time{})
+	notifications, err = notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: "non-existent"}))
 	assert.NoError(t, err)
 	assert.Len(t, notifications, 0)
 }
 
-func TestInMemoryStorage_Cleanup(t *testing.T) {
-	logger, _ := log.NewForTest()
-	storage := NewInMemoryStorage(logger)
+func testStorageCleanup(t *testing.T, storage Storage) {
 	ctx := context.Background()
 
 	// Test data
@@ -94,10 +138,10 @@ func TestInMemoryStorage_Cleanup(t *testing.T) {
 	}
 
 	// Store notifications
-	err := storage.StoreNotification(ctx, oldNotification)
+	_, _, err := storage.StoreNotification(ctx, oldNotification)
 	assert.NoError(t, err)
 
-	err = storage.StoreNotification(ctx, newNotification)
+	_, _, err = storage.StoreNotification(ctx, newNotification)
 	assert.NoError(t, err)
 
 	// Cleanup old notifications (older than 1 hour)
@@ -105,8 +149,485 @@ func TestInMemoryStorage_Cleanup(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify only new notification remains by getting notifications
-	notifications, err := storage.GetNotifications(ctx, serviceProviderID, time.Time{})
+	notifications, err := notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: serviceProviderID}))
 	assert.NoError(t, err)
 	assert.Len(t, notifications, 1, "After cleanup, only new notification should remain")
 	assert.Equal(t, newNotification.ID, notifications[0].ID)
 }
+
+func testStorageDeliveries(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	old := Notification{ID: "old", ServiceProviderID: "sp-1", RatingID: "r-1", CreatedAt: time.Now().Add(-2 * time.Hour)}
+	_, _, err := storage.StoreNotification(ctx, old)
+	require.NoError(t, err)
+	for _, channel := range []string{ChannelWebhook, ChannelEmail, ChannelInApp} {
+		require.NoError(t, storage.SaveDelivery(ctx, Delivery{NotificationID: "old", ServiceProviderID: "sp-1", Channel: channel, State: DeliveryPending}))
+	}
+	require.NoError(t, storage.SaveDelivery(ctx, Delivery{NotificationID: "old", ServiceProviderID: "sp-1", Channel: ChannelEmail, State: DeliverySucceeded, Attempts: 2}))
+
+	deliveries, err := storage.GetDeliveries(ctx, "old")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	assert.Equal(t, []string{ChannelEmail, ChannelInApp, ChannelWebhook}, []string{deliveries[0].Channel, deliveries[1].Channel, deliveries[2].Channel})
+	assert.Equal(t, DeliverySucceeded, deliveries[0].State)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+
+	deliveries, err = storage.GetDeliveries(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	// the deliveries are removed together with their notification
+	require.NoError(t, storage.Cleanup(ctx, time.Hour))
+	deliveries, err = storage.GetDeliveries(ctx, "old")
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func testStorageHeldDeliveries(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	old := Notification{ID: "old", ServiceProviderID: "sp-1", RatingID: "r-1", CreatedAt: time.Now().Add(-2 * time.Hour)}
+	_, _, err := storage.StoreNotification(ctx, old)
+	require.NoError(t, err)
+	releaseAt := time.Now().Add(time.Hour).Truncate(time.Minute)
+	require.NoError(t, storage.SaveDelivery(ctx, Delivery{NotificationID: "old", ServiceProviderID: "sp-1", Channel: ChannelInApp, State: DeliverySucceeded}))
+	require.NoError(t, storage.SaveDelivery(ctx, Delivery{NotificationID: "old", ServiceProviderID: "sp-1", Channel: ChannelEmail, State: DeliveryHeld, ReleaseAt: &releaseAt}))
+
+	stored, err := storage.GetNotification(ctx, "sp-1", "old")
+	require.NoError(t, err)
+	assert.Equal(t, "r-1", stored.RatingID)
+	_, err = storage.GetNotification(ctx, "sp-2", "old")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = storage.GetNotification(ctx, "sp-1", "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	held, err := storage.ListHeldDeliveries(ctx, releaseAt.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, held)
+	held, err = storage.ListHeldDeliveries(ctx, releaseAt)
+	require.NoError(t, err)
+	require.Len(t, held, 1)
+	assert.Equal(t, ChannelEmail, held[0].Channel)
+	assert.True(t, releaseAt.Equal(*held[0].ReleaseAt))
+
+	// notifications with held deliveries are kept until they are released
+	require.NoError(t, storage.Cleanup(ctx, time.Hour))
+	_, err = storage.GetNotification(ctx, "sp-1", "old")
+	require.NoError(t, err)
+	require.NoError(t, storage.SaveDelivery(ctx, Delivery{NotificationID: "old", ServiceProviderID: "sp-1", Channel: ChannelEmail, State: DeliverySucceeded}))
+	require.NoError(t, storage.Cleanup(ctx, time.Hour))
+	_, err = storage.GetNotification(ctx, "sp-1", "old")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testStoragePreferences(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	_, found, err := storage.GetPreferences(ctx, "sp-1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	preferences := Preferences{
+		ServiceProviderID: "sp-1",
+		MinRating:         4,
+		Channels:          map[string]bool{ChannelEmail: false},
+		Events:            map[string]bool{EventRatingCreated: true},
+		QuietHours:        &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Istanbul"},
+		EmailAddress:      "office@example.com",
+	}
+	require.NoError(t, storage.SavePreferences(ctx, preferences))
+	stored, found, err := storage.GetPreferences(ctx, "sp-1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, preferences, stored)
+
+	_, found, err = storage.GetPreferences(ctx, "sp-2")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func testStorageDigestEntries(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	periodEnd := time.Now().Truncate(time.Hour)
+	entries := []DigestEntry{
+		{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 2, CreatedAt: periodEnd.Add(-time.Minute)},
+		{ServiceProviderID: "sp-1", RatingID: "r-1", Rating: 5, CreatedAt: periodEnd.Add(-time.Hour)},
+		{ServiceProviderID: "sp-1", RatingID: "r-3", Rating: 4, CreatedAt: periodEnd},
+		{ServiceProviderID: "sp-2", RatingID: "r-4", Rating: 3, CreatedAt: periodEnd.Add(-time.Hour)},
+	}
+	for _, entry := range entries {
+		_, added, err := storage.AddDigestEntry(ctx, entry)
+		require.NoError(t, err)
+		assert.True(t, added)
+	}
+	// the collected entry of a rating is kept
+	replay := entries[1]
+	replay.Comment = "Great work"
+	_, added, err := storage.AddDigestEntry(ctx, replay)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	serviceProviderIDs, err := storage.ListDigestServiceProviders(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sp-1", "sp-2"}, serviceProviderIDs)
+
+	stored, err := storage.GetDigestEntries(ctx, "sp-1", periodEnd)
+	require.NoError(t, err)
+	require.Len(t, stored, 2, "entries of the next period are not returned")
+	assert.Equal(t, "r-1", stored[0].RatingID, "the oldest entry comes first")
+	assert.Empty(t, stored[0].Comment)
+	assert.Equal(t, "r-2", stored[1].RatingID)
+
+	require.NoError(t, storage.DeleteDigestEntries(ctx, "sp-1", periodEnd))
+	stored, err = storage.GetDigestEntries(ctx, "sp-1", periodEnd.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "r-3", stored[0].RatingID)
+
+	require.NoError(t, storage.DeleteDigestEntries(ctx, "sp-2", periodEnd))
+	serviceProviderIDs, err = storage.ListDigestServiceProviders(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sp-1"}, serviceProviderIDs, "service providers without entries are not listed")
+	require.NoError(t, storage.DeleteDigestEntries(ctx, "unknown", periodEnd))
+}
+
+func testStorageSummarizedRatings(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	summary := Notification{
+		ID:                "n-1",
+		ServiceProviderID: "sp-1",
+		Type:              EventRatingCreated,
+		RatingIDs:         []string{"r-1", "r-2"},
+		CreatedAt:         time.Now().Add(-2 * time.Hour),
+	}
+	_, created, err := storage.StoreNotification(ctx, summary)
+	require.NoError(t, err)
+	require.True(t, created)
+
+	// a summarized rating is neither collected nor notified again
+	existing, added, err := storage.AddDigestEntry(ctx, DigestEntry{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 4, CreatedAt: time.Now()})
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, "n-1", existing.ID)
+	stored, created, err := storage.StoreNotification(ctx, Notification{ID: "n-2", ServiceProviderID: "sp-1", Type: EventRatingCreated, RatingID: "r-2", CreatedAt: time.Now()})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "n-1", stored.ID)
+	entries, err := storage.GetDigestEntries(ctx, "sp-1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// the keys of the summarized ratings are removed with the summary
+	require.NoError(t, storage.Cleanup(ctx, time.Hour))
+	_, added, err = storage.AddDigestEntry(ctx, DigestEntry{ServiceProviderID: "sp-1", RatingID: "r-2", Rating: 4, CreatedAt: time.Now()})
+	require.NoError(t, err)
+	assert.True(t, added)
+}
+
+func testStorageStoreDuplicate(t *testing.T, storage Storage) {
+	ctx := context.Background()
+
+	original := Notification{
+		ID:                "notif-1",
+		ServiceProviderID: "test-provider-id",
+		Type:              EventRatingCreated,
+		State:             StateUnread,
+		Sequence:          1,
+		RatingID:          "rating-1",
+		CreatedAt:         time.Now().Add(-2 * time.Hour),
+	}
+	stored, created, err := storage.StoreNotification(ctx, original)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, original, stored)
+
+	replay := original
+	replay.ID = "notif-2"
+	stored, created, err = storage.StoreNotification(ctx, replay)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, original.ID, stored.ID)
+
+	notifications, err := notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: original.ServiceProviderID}))
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 1)
+
+	// once the original is cleaned up, the event can be stored again
+	assert.NoError(t, storage.Cleanup(ctx, time.Hour))
+	_, created, err = storage.StoreNotification(ctx, replay)
+	assert.NoError(t, err)
+	assert.True(t, created)
+}
+
+func testStorageStates(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	for _, id := range []string{"notif-1", "notif-2", "notif-3"} {
+		_, _, err := storage.StoreNotification(ctx, Notification{ID: id, ServiceProviderID: "sp", Type: EventRatingCreated, RatingID: id, CreatedAt: time.Now()})
+		require.NoError(t, err)
+	}
+	_, _, err := storage.StoreNotification(ctx, Notification{ID: "other", ServiceProviderID: "other-sp", Type: EventRatingCreated, RatingID: "other", CreatedAt: time.Now()})
+	require.NoError(t, err)
+
+	count, err := storage.CountNotifications(ctx, "sp", StateUnread)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// peeking does not consume the notifications
+	notifications, err := notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", Peek: true}))
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 3)
+	for _, n := range notifications {
+		assert.Equal(t, StateUnread, n.State)
+	}
+
+	// notifications of another service provider and unknown IDs are not acknowledged
+	updated, err := storage.UpdateState(ctx, "sp", []string{"notif-1", "other", "unknown"}, StateRead)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	updated, err = storage.UpdateState(ctx, "sp", []string{"notif-1", "notif-2"}, StateArchived)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated)
+
+	// an archived notification cannot become read again
+	updated, err = storage.UpdateState(ctx, "sp", []string{"notif-1"}, StateRead)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updated)
+
+	count, err = storage.CountNotifications(ctx, "sp", StateUnread)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = storage.CountNotifications(ctx, "sp", StateArchived)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = storage.CountNotifications(ctx, "other-sp", StateUnread)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// fetching without peek consumes the remaining unread notification
+	notifications, err = notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: "sp"}))
+	assert.NoError(t, err)
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, "notif-3", notifications[0].ID)
+		assert.Equal(t, StateRead, notifications[0].State)
+	}
+	count, err = storage.CountNotifications(ctx, "sp", StateUnread)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func testStorageClientCursors(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	store := func(id string) {
+		_, _, err := storage.StoreNotification(ctx, Notification{ID: id, ServiceProviderID: "sp", Type: EventRatingCreated, RatingID: id, CreatedAt: time.Now()})
+		require.NoError(t, err)
+	}
+	ids := func(notifications []Notification) []string {
+		ids := []string{}
+		for _, n := range notifications {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+	store("notif-1")
+	store("notif-2")
+
+	// every client receives every notification once, independently of the other clients
+	result, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"notif-1", "notif-2"}, ids(result.Notifications))
+	assert.Equal(t, uint64(2), result.Cursor)
+	assert.False(t, result.Gap)
+	assert.Equal(t, []uint64{1, 2}, []uint64{result.Notifications[0].Sequence, result.Notifications[1].Sequence})
+
+	store("notif-3")
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"notif-3"}, ids(result.Notifications))
+	assert.Equal(t, uint64(3), result.Cursor)
+
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "web", Peek: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"notif-1", "notif-2", "notif-3"}, ids(result.Notifications))
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "web"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"notif-1", "notif-2", "notif-3"}, ids(result.Notifications))
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "web"})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Notifications)
+	assert.Equal(t, uint64(3), result.Cursor)
+
+	// client deliveries do not change the state, and archived notifications are skipped
+	count, err := storage.CountNotifications(ctx, "sp", StateUnread)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	_, err = storage.UpdateState(ctx, "sp", []string{"notif-2"}, StateArchived)
+	require.NoError(t, err)
+
+	// a client can move its cursor back to receive notifications again
+	after := uint64(1)
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone", After: &after})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"notif-3"}, ids(result.Notifications))
+	assert.Equal(t, uint64(3), result.Cursor)
+
+	// a client of a service provider without notifications gets nothing
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "other-sp", ClientID: "phone"})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Notifications)
+	assert.False(t, result.Gap)
+}
+
+func testStorageClientCursorGap(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	store := func(id string, createdAt time.Time) {
+		_, _, err := storage.StoreNotification(ctx, Notification{ID: id, ServiceProviderID: "sp", Type: EventRatingCreated, RatingID: id, CreatedAt: createdAt})
+		require.NoError(t, err)
+	}
+	store("notif-1", time.Now().Add(-2*time.Hour))
+	_, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone"})
+	require.NoError(t, err)
+
+	// notif-2 is removed by the cleanup before the phone received it
+	store("notif-2", time.Now().Add(-2*time.Hour))
+	store("notif-3", time.Now())
+	require.NoError(t, storage.Cleanup(ctx, time.Hour))
+
+	result, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone"})
+	assert.NoError(t, err)
+	assert.True(t, result.Gap)
+	if assert.Len(t, result.Notifications, 1) {
+		assert.Equal(t, uint64(3), result.Notifications[0].Sequence)
+	}
+
+	// a new client has no gap, and sequence numbers are not reused after a cleanup removed everything
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "web"})
+	assert.NoError(t, err)
+	assert.False(t, result.Gap)
+	require.NoError(t, storage.Cleanup(ctx, -time.Hour))
+	store("notif-4", time.Now())
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "web"})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Notifications, 1) {
+		assert.Equal(t, uint64(4), result.Notifications[0].Sequence)
+	}
+	assert.False(t, result.Gap)
+}
+
+// storeSequence stores notifications notif-1 to notif-n for the service provider "sp".
+func storeSequence(t *testing.T, storage Storage, n int) {
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("notif-%d", i)
+		_, _, err := storage.StoreNotification(context.Background(), Notification{ID: id, ServiceProviderID: "sp", Type: EventRatingCreated, RatingID: id, CreatedAt: time.Now()})
+		require.NoError(t, err)
+	}
+}
+
+func testStoragePagination(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	storeSequence(t, storage, 5)
+	_, err := storage.UpdateState(ctx, "sp", []string{"notif-2"}, StateRead)
+	require.NoError(t, err)
+
+	// peeking pages through the unread notifications with the cursor
+	result, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", Peek: true, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 3}, sequencesOf(result.Notifications))
+	assert.True(t, result.HasMore)
+	assert.Equal(t, uint64(3), result.Cursor)
+
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", Peek: true, Limit: 2, After: &result.Cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{4, 5}, sequencesOf(result.Notifications))
+	assert.False(t, result.HasMore)
+
+	// consuming marks only the returned page as read
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 3, 4}, sequencesOf(result.Notifications))
+	assert.True(t, result.HasMore)
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{5}, sequencesOf(result.Notifications))
+	assert.False(t, result.HasMore)
+}
+
+func testStorageClientPagination(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	storeSequence(t, storage, 3)
+	_, err := storage.UpdateState(ctx, "sp", []string{"notif-3"}, StateArchived)
+	require.NoError(t, err)
+
+	result, err := storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone", Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1}, sequencesOf(result.Notifications))
+	assert.True(t, result.HasMore)
+	assert.Equal(t, uint64(1), result.Cursor)
+
+	// the archived notification does not count as more, and the next request moves the cursor past it
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone", Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2}, sequencesOf(result.Notifications))
+	assert.False(t, result.HasMore)
+	assert.Equal(t, uint64(2), result.Cursor)
+
+	result, err = storage.GetNotifications(ctx, Query{ServiceProviderID: "sp", ClientID: "phone", Limit: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Notifications)
+	assert.Equal(t, uint64(3), result.Cursor)
+}
+
+// sequencesOf returns the sequence numbers of the notifications.
+func sequencesOf(notifications []Notification) []uint64 {
+	sequences := []uint64{}
+	for _, n := range notifications {
+		sequences = append(sequences, n.Sequence)
+	}
+	return sequences
+}
+
+func TestBoltStorage_PersistsAcrossRestarts(t *testing.T) {
+	logger, _ := log.NewForTest()
+	path := filepath.Join(t.TempDir(), "notifications.db")
+	ctx := context.Background()
+
+	storage, err := NewBoltStorage(path, logger)
+	require.NoError(t, err)
+	delivered := Notification{ID: "notif-1", ServiceProviderID: "sp", Type: EventRatingCreated, RatingID: "rating-1", CreatedAt: time.Now()}
+	pending := Notification{ID: "notif-2", ServiceProviderID: "sp", Type: EventRatingCreated, RatingID: "rating-2", CreatedAt: time.Now()}
+	_, _, err = storage.StoreNotification(ctx, delivered)
+	require.NoError(t, err)
+	_, err = notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: "sp"}))
+	require.NoError(t, err)
+	_, _, err = storage.StoreNotification(ctx, pending)
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+
+	storage, err = NewBoltStorage(path, logger)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, storage.Close()) }()
+
+	// the delivered tracking and the idempotency keys survive the restart
+	notifications, err := notificationsOf(storage.GetNotifications(ctx, Query{ServiceProviderID: "sp"}))
+	assert.NoError(t, err)
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, pending.ID, notifications[0].ID)
+		assert.True(t, pending.CreatedAt.Equal(notifications[0].CreatedAt))
+	}
+	stored, created, err := storage.StoreNotification(ctx, Notification{ID: "notif-3", ServiceProviderID: "sp", Type: EventRatingCreated, RatingID: "rating-1", CreatedAt: time.Now()})
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, delivered.ID, stored.ID)
+}
+
+// notificationsOf returns the notifications of a query result.
+func notificationsOf(result QueryResult, err error) ([]Notification, error) {
+	return result.Notifications, err
+}
+
+func testStoragePing(t *testing.T, storage Storage) {
+	assert.NoError(t, storage.Ping(context.Background()))
+}
+
+func TestBoltStorage_PingClosed(t *testing.T) {
+	storage := storageBackends["bolt"](t)
+	require.NoError(t, storage.Close())
+	assert.Error(t, storage.Ping(context.Background()))
+}
@@ -0,0 +1,170 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+)
+
+// streamNotifications handles GET /api/notifications/{serviceProviderId}/stream.
+// It streams the notifications created for the service provider as Server-Sent Events whose IDs are the sequence
+// numbers of the notifications. A client reconnecting with a Last-Event-ID header first receives the notifications
+// it missed. The stream is closed when the client falls too far behind, so that it reconnects and catches up. The
+// shape of the notifications depends on the API version, see apiVersion.
+func (r resource) streamNotifications(c *routing.Context) error {
+	serviceProviderID := c.Param("serviceProviderId")
+	if serviceProviderID == "" {
+		return errors.BadRequest("Service provider ID is required")
+	}
+	version, err := apiVersion(c)
+	if err != nil {
+		return err
+	}
+
+	var lastEventID *uint64
+	if id := c.Request.Header.Get("Last-Event-ID"); id != "" {
+		parsed, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return errors.BadRequest("Invalid Last-Event-ID. Use the ID of the last received event")
+		}
+		lastEventID = &parsed
+	}
+
+	flusher, ok := findWriter[http.Flusher](c.Response)
+	if !ok {
+		return errors.InternalServerError("Streaming is not supported")
+	}
+
+	// subscribe before replaying the missed notifications, so that none is lost in between
+	subscription, err := r.subscribe(serviceProviderID)
+	if err != nil {
+		return err
+	}
+	defer subscription.Close()
+
+	ctx := c.Request.Context()
+	logger := r.logger.With(ctx, "service_provider_id", serviceProviderID)
+	logger.Info("Notification stream opened")
+	defer logger.Info("Notification stream closed")
+
+	header := c.Response.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// from here on the response is committed, so errors end the stream instead of being returned
+	var last uint64
+	if lastEventID != nil {
+		last, err = r.replay(ctx, serviceProviderID, *lastEventID, func(notification Notification) error {
+			return writeEvent(c.Response, notification.ForVersion(version))
+		})
+		if err != nil {
+			logger.With(ctx, "error", err).Error("Failed to replay notifications")
+			return nil
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(r.stream.HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification, ok := <-subscription.C:
+			if !ok {
+				return nil
+			}
+			// notifications created while the missed ones were replayed may have been sent already
+			if notification.Sequence <= last {
+				continue
+			}
+			last = notification.Sequence
+			if err := writeEvent(c.Response, notification.ForVersion(version)); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Response, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// subscribe subscribes to the notifications of a service provider for a stream or WebSocket connection.
+func (r resource) subscribe(serviceProviderID string) (*Subscription, error) {
+	subscription, err := r.service.Subscribe(serviceProviderID)
+	switch {
+	case stderrors.Is(err, ErrTooManySubscribers):
+		return nil, errors.TooManyRequests(fmt.Sprintf("At most %d streams per service provider are allowed", r.stream.MaxConnections))
+	case stderrors.Is(err, ErrBrokerClosed):
+		return nil, errors.ServiceUnavailable("The server is shutting down")
+	}
+	return subscription, err
+}
+
+// replay writes the notifications of a service provider after the given sequence number, read or not, and returns
+// the sequence number of the last written one. A write error stops the replay and is returned.
+func (r resource) replay(ctx context.Context, serviceProviderID string, after uint64, write func(Notification) error) (uint64, error) {
+	last := after
+	for {
+		resp, err := r.service.GetNotifications(ctx, Query{
+			ServiceProviderID: serviceProviderID,
+			After:             &last,
+			Peek:              true,
+			IncludeRead:       true,
+			Limit:             maxPageSize,
+		})
+		if err != nil {
+			return last, err
+		}
+		for _, notification := range resp.Notifications {
+			if err := write(notification); err != nil {
+				return last, err
+			}
+			last = notification.Sequence
+		}
+		if !resp.HasMore {
+			return last, nil
+		}
+	}
+}
+
+// writeEvent writes a notification as a Server-Sent Event.
+func writeEvent(w io.Writer, notification Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", notification.Sequence, data)
+	return err
+}
+
+// findWriter returns the response writer implementing T, e.g. http.Flusher. The access log and tracing middlewares
+// wrap the response writer in an access.LogResponseWriter, which implements neither http.Flusher nor http.Hijacker.
+func findWriter[T any](w http.ResponseWriter) (T, bool) {
+	for {
+		if t, ok := w.(T); ok {
+			return t, true
+		}
+		lw, ok := w.(*access.LogResponseWriter)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		w = lw.ResponseWriter
+	}
+}
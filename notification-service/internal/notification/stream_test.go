@@ -0,0 +1,177 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/accesslog"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/retry"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const streamServiceProviderID = "123e4567-e89b-12d3-a456-426614174000"
+
+// event is a Server-Sent Event read by readEvent.
+type event struct {
+	id      string
+	name    string
+	data    string
+	comment string
+}
+
+// newStreamServer starts a server with the notification routes behind the access log middleware,
+// which wraps the response writer like in production.
+func newStreamServer(t *testing.T, stream config.StreamConfig, tokenSecret string) (*httptest.Server, Service) {
+	logger, _ := log.NewForTest()
+	cfg := config.Config{
+		Retry:          retry.DefaultRetryConfig(),
+		CircuitBreaker: circuitbreaker.DefaultConfig(),
+		Stream:         stream,
+	}
+	service := NewService(NewInMemoryStorage(logger), circuitbreaker.NewRegistry(), logger, cfg, defaultMessages)
+
+	router := routing.New()
+	router.Use(
+		accesslog.Handler(logger),
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+	)
+	RegisterHandlers(router, service, stream, tokenSecret, logger)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		service.CloseSubscriptions()
+		server.Close()
+	})
+	return server, service
+}
+
+// openStream opens the notification stream of the test service provider.
+func openStream(t *testing.T, server *httptest.Server, lastEventID string) (*http.Response, *bufio.Reader) {
+	req, err := http.NewRequest("GET", server.URL+"/api/notifications/"+streamServiceProviderID+"/stream", nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readEvent reads the next event or comment of a stream.
+func readEvent(t *testing.T, r *bufio.Reader) event {
+	var e event
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return e
+		case strings.HasPrefix(line, ": "):
+			e.comment = strings.TrimPrefix(line, ": ")
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// createNotification creates a notification for the test service provider.
+func createNotification(t *testing.T, service Service, ratingID string) {
+	_, err := service.CreateNotification(context.Background(), RatingNotificationRequest{
+		ServiceProviderID: streamServiceProviderID,
+		RatingID:          ratingID,
+		Rating:            5,
+	})
+	require.NoError(t, err)
+}
+
+// waitForSubscribers waits until the test service provider has the given number of streams.
+func waitForSubscribers(t *testing.T, s Service, n int) {
+	require.Eventually(t, func() bool {
+		return s.(*service).broker.Subscribers(streamServiceProviderID) == n
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestNotificationAPI_Stream(t *testing.T) {
+	server, service := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour}, "")
+
+	resp, events := openStream(t, server, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	waitForSubscribers(t, service, 1)
+
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174001")
+	e := readEvent(t, events)
+	assert.Equal(t, "1", e.id)
+	assert.Equal(t, "notification", e.name)
+	var notification Notification
+	require.NoError(t, json.Unmarshal([]byte(e.data), &notification))
+	assert.Equal(t, "456e7890-e89b-12d3-a456-426614174001", notification.RatingID)
+	assert.Equal(t, uint64(1), notification.Sequence)
+
+	// a replayed request does not create a second event
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174001")
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174002")
+	assert.Equal(t, "2", readEvent(t, events).id)
+}
+
+func TestNotificationAPI_StreamResumesFromLastEventID(t *testing.T) {
+	server, service := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour}, "")
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174001")
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174002")
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174003")
+
+	_, events := openStream(t, server, "1")
+	assert.Equal(t, "2", readEvent(t, events).id)
+	assert.Equal(t, "3", readEvent(t, events).id)
+
+	waitForSubscribers(t, service, 1)
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174004")
+	assert.Equal(t, "4", readEvent(t, events).id)
+}
+
+func TestNotificationAPI_StreamHeartbeat(t *testing.T) {
+	server, _ := newStreamServer(t, config.StreamConfig{HeartbeatInterval: 10 * time.Millisecond}, "")
+
+	_, events := openStream(t, server, "")
+	assert.Equal(t, "heartbeat", readEvent(t, events).comment)
+}
+
+func TestNotificationAPI_StreamLimits(t *testing.T) {
+	server, service := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour, MaxConnections: 1}, "")
+
+	resp, events := openStream(t, server, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	waitForSubscribers(t, service, 1)
+	resp, _ = openStream(t, server, "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	resp, _ = openStream(t, server, "not-a-number")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// closing the subscriptions ends the open streams and rejects new ones
+	service.CloseSubscriptions()
+	_, err := events.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+	resp, _ = openStream(t, server, "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
@@ -0,0 +1,45 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for provider tokens which are malformed, expired or issued for another service provider.
+var ErrInvalidToken = errors.New("invalid provider token")
+
+// SignProviderToken returns a token which authenticates a service provider until expiresAt.
+// A token is "<expiry in Unix seconds>.<signature>", where the signature is the base64url encoded HMAC-SHA256 of the
+// service provider ID and the expiry keyed with the secret, so any service sharing the secret can issue tokens.
+func SignProviderToken(secret, serviceProviderID string, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + providerTokenSignature(secret, serviceProviderID, expiry)
+}
+
+// VerifyProviderToken checks that a token was signed with the secret for the service provider and has not expired.
+func VerifyProviderToken(secret, token, serviceProviderID string, now time.Time) error {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= expiresAt {
+		return ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(providerTokenSignature(secret, serviceProviderID, expiry))) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// providerTokenSignature signs the service provider ID and the expiry of a token.
+func providerTokenSignature(secret, serviceProviderID, expiry string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(serviceProviderID + "\n" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,42 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderToken(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	now := time.Now()
+	token := SignProviderToken(secret, "sp-1", now.Add(time.Minute))
+
+	tests := []struct {
+		name              string
+		secret            string
+		token             string
+		serviceProviderID string
+		now               time.Time
+		valid             bool
+	}{
+		{"valid", secret, token, "sp-1", now, true},
+		{"other service provider", secret, token, "sp-2", now, false},
+		{"other secret", "fedcba9876543210fedcba9876543210", token, "sp-1", now, false},
+		{"expired", secret, token, "sp-1", now.Add(time.Minute), false},
+		{"extended expiry", secret, "9999999999" + token[strings.Index(token, "."):], "sp-1", now, false},
+		{"malformed", secret, "token", "sp-1", now, false},
+		{"empty", secret, "", "sp-1", now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyProviderToken(tt.secret, tt.token, tt.serviceProviderID, tt.now)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package notification
+
+import "sync"
+
+// waiters wakes the requests which wait for new notifications of a service provider. A service provider has a
+// signal while requests wait for it; creating a notification closes the channel of the signal, which wakes all of
+// them. The signal is removed when the last request waiting for it leaves, so that requests which time out or are
+// cancelled do not leave it behind.
+type waiters struct {
+	mu      sync.Mutex
+	signals map[string]*signal // map[serviceProviderID]signal
+}
+
+// signal is closed by the next broadcast for a service provider.
+type signal struct {
+	c       chan struct{}
+	waiting int
+}
+
+// newWaiters creates an empty set of waiters.
+func newWaiters() *waiters {
+	return &waiters{signals: make(map[string]*signal)}
+}
+
+// wait returns a channel which is closed by the next broadcast for the service provider, and a function which must
+// be called once when the request stops waiting without being woken.
+func (w *waiters) wait(serviceProviderID string) (<-chan struct{}, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.signals[serviceProviderID]
+	if !ok {
+		s = &signal{c: make(chan struct{})}
+		w.signals[serviceProviderID] = s
+	}
+	s.waiting++
+	return s.c, func() { w.leave(serviceProviderID, s) }
+}
+
+// leave removes a request from the requests waiting for a signal, and the signal once no request waits for it.
+func (w *waiters) leave(serviceProviderID string, s *signal) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.signals[serviceProviderID] != s {
+		// the signal was broadcast already
+		return
+	}
+	s.waiting--
+	if s.waiting == 0 {
+		delete(w.signals, serviceProviderID)
+	}
+}
+
+// broadcast wakes all requests waiting for the service provider.
+func (w *waiters) broadcast(serviceProviderID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if s, ok := w.signals[serviceProviderID]; ok {
+		close(s.c)
+		delete(w.signals, serviceProviderID)
+	}
+}
@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaiters(t *testing.T) {
+	w := newWaiters()
+	first, leaveFirst := w.wait("sp-1")
+	second, _ := w.wait("sp-1")
+	other, leaveOther := w.wait("sp-2")
+
+	w.broadcast("sp-1")
+	assert.True(t, isClosed(first))
+	assert.True(t, isClosed(second))
+	assert.False(t, isClosed(other))
+
+	// a broadcast wakes only the requests waiting before it
+	next, leaveNext := w.wait("sp-1")
+	assert.False(t, isClosed(next))
+	w.broadcast("sp-3")
+	assert.Len(t, w.signals, 2)
+
+	// leaving after a broadcast does not affect the requests waiting for the next one
+	leaveFirst()
+	assert.Len(t, w.signals, 2)
+
+	// the signal is removed when the last request waiting for it leaves
+	_, leaveLast := w.wait("sp-1")
+	leaveNext()
+	assert.Len(t, w.signals, 2)
+	leaveLast()
+	leaveOther()
+	assert.Empty(t, w.signals)
+}
+
+// isClosed tells whether a signal channel is closed.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,217 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// socketWriteTimeout is the time allowed to write a message to a WebSocket client.
+	socketWriteTimeout = 10 * time.Second
+	// maxSocketMessageSize is the maximum size of a message read from a WebSocket client.
+	maxSocketMessageSize = 64 * 1024
+	// socketReplyBuffer is the number of replies queued per WebSocket connection.
+	socketReplyBuffer = 16
+)
+
+// upgrader upgrades requests to WebSocket connections. Clients authenticate with provider tokens instead of
+// cookies, so connections are accepted from any origin like the other endpoints.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// hijackWriter is a response writer which can be upgraded to a WebSocket connection.
+type hijackWriter interface {
+	http.ResponseWriter
+	http.Hijacker
+}
+
+// openSocket handles GET /api/notifications/{serviceProviderId}/ws.
+// It authenticates the service provider with a provider token given as token query parameter, which browsers need
+// because they cannot set headers on WebSocket requests, or as bearer token. The connection pushes the notifications
+// created for the service provider and accepts ack messages, see SocketMessage. With after, the notifications after
+// that sequence number are pushed first. A client which falls too far behind is disconnected, so that it reconnects
+// and catches up. The shape of the notifications depends on the API version, see apiVersion.
+func (r resource) openSocket(c *routing.Context) error {
+	serviceProviderID := c.Param("serviceProviderId")
+	if serviceProviderID == "" {
+		return errors.BadRequest("Service provider ID is required")
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		token, _ = strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	}
+	if err := VerifyProviderToken(r.tokenSecret, token, serviceProviderID, time.Now()); err != nil {
+		return errors.Unauthorized("")
+	}
+
+	version, err := apiVersion(c)
+	if err != nil {
+		return err
+	}
+
+	var after *uint64
+	if afterStr := c.Query("after"); afterStr != "" {
+		parsed, err := strconv.ParseUint(afterStr, 10, 64)
+		if err != nil {
+			return errors.BadRequest("Invalid after value. Use a sequence number")
+		}
+		after = &parsed
+	}
+
+	w, ok := findWriter[hijackWriter](c.Response)
+	if !ok {
+		return errors.InternalServerError("WebSocket connections are not supported")
+	}
+
+	// subscribe before replaying the missed notifications, so that none is lost in between
+	subscription, err := r.subscribe(serviceProviderID)
+	if err != nil {
+		return err
+	}
+	defer subscription.Close()
+
+	conn, err := upgrader.Upgrade(w, c.Request, nil)
+	if err != nil {
+		// the upgrader has already responded with an error
+		r.logger.With(c.Request.Context(), "error", err).Info("Failed to upgrade to WebSocket")
+		return nil
+	}
+	defer conn.Close()
+
+	// the request context ends when the handler returns, not when a hijacked connection is closed
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+	defer cancel()
+	logger := r.logger.With(ctx, "service_provider_id", serviceProviderID)
+	logger.Info("WebSocket connection opened")
+	defer logger.Info("WebSocket connection closed")
+
+	replies := make(chan SocketMessage, socketReplyBuffer)
+	go func() {
+		defer cancel()
+		r.readSocket(ctx, conn, serviceProviderID, replies)
+	}()
+
+	write := func(msg SocketMessage) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		return conn.WriteJSON(msg)
+	}
+	var last uint64
+	if after != nil {
+		last, err = r.replay(ctx, serviceProviderID, *after, func(notification Notification) error {
+			notification = notification.ForVersion(version)
+			return write(SocketMessage{Type: SocketNotification, Notification: &notification})
+		})
+		if err != nil {
+			logger.With(ctx, "error", err).Error("Failed to replay notifications")
+			return nil
+		}
+	}
+
+	ping := time.NewTicker(r.stream.HeartbeatInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// the client closed the connection or stopped answering pings
+			return nil
+		case notification, ok := <-subscription.C:
+			if !ok {
+				closeSocket(conn, subscription.Err())
+				return nil
+			}
+			// notifications created while the missed ones were replayed may have been sent already
+			if notification.Sequence <= last {
+				continue
+			}
+			last = notification.Sequence
+			notification = notification.ForVersion(version)
+			if err := write(SocketMessage{Type: SocketNotification, Notification: &notification}); err != nil {
+				return nil
+			}
+		case reply := <-replies:
+			if err := write(reply); err != nil {
+				return nil
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteTimeout)); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// readSocket reads the messages of a WebSocket client and queues the replies until the connection fails. A client
+// which neither sends messages nor answers pings for two heartbeat intervals is considered gone.
+func (r resource) readSocket(ctx context.Context, conn *websocket.Conn, serviceProviderID string, replies chan<- SocketMessage) {
+	timeout := 2 * r.stream.HeartbeatInterval
+	conn.SetReadLimit(maxSocketMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+		var reply SocketMessage
+		var msg SocketMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			reply = SocketMessage{Type: SocketError, Message: "Invalid message format"}
+		} else {
+			reply = r.handleSocketMessage(ctx, serviceProviderID, msg)
+		}
+		select {
+		case replies <- reply:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSocketMessage processes a message of a WebSocket client and returns the reply.
+func (r resource) handleSocketMessage(ctx context.Context, serviceProviderID string, msg SocketMessage) SocketMessage {
+	if msg.Type != SocketAck {
+		return SocketMessage{Type: SocketError, ID: msg.ID, Message: "Unknown message type"}
+	}
+
+	req := AcknowledgeRequest{IDs: msg.IDs, State: msg.State}
+	if err := r.validateAcknowledgeRequest(req); err != nil {
+		return SocketMessage{Type: SocketError, ID: msg.ID, Message: err.Error()}
+	}
+	resp, err := r.service.AcknowledgeNotifications(ctx, serviceProviderID, req)
+	if err != nil {
+		return SocketMessage{Type: SocketError, ID: msg.ID, Message: "Failed to acknowledge notifications"}
+	}
+	return SocketMessage{Type: SocketAck, ID: msg.ID, Acknowledged: &resp.Acknowledged}
+}
+
+// closeSocket tells a WebSocket client why the server closes the connection.
+func closeSocket(conn *websocket.Conn, reason error) {
+	code := websocket.CloseNormalClosure
+	switch {
+	case stderrors.Is(reason, ErrBrokerClosed):
+		code = websocket.CloseGoingAway
+	case stderrors.Is(reason, ErrSubscriberTooSlow):
+		code = websocket.CloseTryAgainLater
+	}
+	text := ""
+	if reason != nil {
+		text = reason.Error()
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(socketWriteTimeout))
+}
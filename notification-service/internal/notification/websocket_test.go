@@ -0,0 +1,159 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTokenSecret = "0123456789abcdef0123456789abcdef"
+
+// dialSocket opens a WebSocket connection of the test service provider with the given token and query.
+func dialSocket(t *testing.T, serverURL, token, query string) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(serverURL, "http") + "/api/notifications/" + streamServiceProviderID + "/ws?token=" + token + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if conn != nil {
+		t.Cleanup(func() { _ = conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// readSocket reads the next message of a WebSocket connection.
+func readSocket(t *testing.T, conn *websocket.Conn) SocketMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg SocketMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestNotificationAPI_Socket(t *testing.T) {
+	server, service := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour}, testTokenSecret)
+	token := SignProviderToken(testTokenSecret, streamServiceProviderID, time.Now().Add(time.Minute))
+
+	conn, _, err := dialSocket(t, server.URL, token, "")
+	require.NoError(t, err)
+	waitForSubscribers(t, service, 1)
+
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174001")
+	msg := readSocket(t, conn)
+	assert.Equal(t, SocketNotification, msg.Type)
+	require.NotNil(t, msg.Notification)
+	assert.Equal(t, "456e7890-e89b-12d3-a456-426614174001", msg.Notification.RatingID)
+	assert.Equal(t, StateUnread, msg.Notification.State)
+
+	require.NoError(t, conn.WriteJSON(SocketMessage{Type: SocketAck, ID: "ack-1", IDs: []string{msg.Notification.ID}}))
+	reply := readSocket(t, conn)
+	assert.Equal(t, SocketAck, reply.Type)
+	assert.Equal(t, "ack-1", reply.ID)
+	require.NotNil(t, reply.Acknowledged)
+	assert.Equal(t, 1, *reply.Acknowledged)
+	unread, err := service.CountUnread(context.Background(), streamServiceProviderID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, unread.Unread)
+
+	require.NoError(t, conn.WriteJSON(SocketMessage{Type: SocketAck, ID: "ack-2", IDs: []string{msg.Notification.ID}, State: StateUnread}))
+	reply = readSocket(t, conn)
+	assert.Equal(t, SocketError, reply.Type)
+	assert.Equal(t, "ack-2", reply.ID)
+
+	require.NoError(t, conn.WriteJSON(SocketMessage{Type: "subscribe", ID: "3"}))
+	assert.Equal(t, SocketError, readSocket(t, conn).Type)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("{")))
+	assert.Equal(t, SocketError, readSocket(t, conn).Type)
+}
+
+func TestNotificationAPI_SocketAuthentication(t *testing.T) {
+	server, _ := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour}, testTokenSecret)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no token", ""},
+		{"token of another service provider", SignProviderToken(testTokenSecret, "other", time.Now().Add(time.Minute))},
+		{"expired token", SignProviderToken(testTokenSecret, streamServiceProviderID, time.Now().Add(-time.Minute))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp, err := dialSocket(t, server.URL, tt.token, "")
+			assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+			require.NotNil(t, resp)
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		})
+	}
+
+	t.Run("disabled without secret", func(t *testing.T) {
+		server, _ := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour}, "")
+		_, resp, err := dialSocket(t, server.URL, SignProviderToken("", streamServiceProviderID, time.Now().Add(time.Minute)), "")
+		assert.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestNotificationAPI_SocketReplay(t *testing.T) {
+	server, service := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour}, testTokenSecret)
+	token := SignProviderToken(testTokenSecret, streamServiceProviderID, time.Now().Add(time.Minute))
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174001")
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174002")
+
+	conn, _, err := dialSocket(t, server.URL, token, "&after=1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), readSocket(t, conn).Notification.Sequence)
+
+	waitForSubscribers(t, service, 1)
+	createNotification(t, service, "456e7890-e89b-12d3-a456-426614174003")
+	assert.Equal(t, uint64(3), readSocket(t, conn).Notification.Sequence)
+}
+
+func TestNotificationAPI_SocketKeepalive(t *testing.T) {
+	server, service := newStreamServer(t, config.StreamConfig{HeartbeatInterval: 20 * time.Millisecond}, testTokenSecret)
+	token := SignProviderToken(testTokenSecret, streamServiceProviderID, time.Now().Add(time.Minute))
+
+	// a client answering pings stays connected
+	conn, _, err := dialSocket(t, server.URL, token, "")
+	require.NoError(t, err)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	waitForSubscribers(t, service, 1)
+
+	// a client ignoring pings is disconnected
+	silent, _, err := dialSocket(t, server.URL, token, "")
+	require.NoError(t, err)
+	silent.SetPingHandler(func(string) error { return nil })
+	waitForSubscribers(t, service, 2)
+	require.NoError(t, silent.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for err == nil {
+		_, _, err = silent.ReadMessage()
+	}
+	assert.NotErrorIs(t, err, os.ErrDeadlineExceeded, "the server closes the connection")
+	waitForSubscribers(t, service, 1)
+}
+
+func TestNotificationAPI_SocketShutdown(t *testing.T) {
+	server, service := newStreamServer(t, config.StreamConfig{HeartbeatInterval: time.Hour}, testTokenSecret)
+	token := SignProviderToken(testTokenSecret, streamServiceProviderID, time.Now().Add(time.Minute))
+
+	conn, _, err := dialSocket(t, server.URL, token, "")
+	require.NoError(t, err)
+	waitForSubscribers(t, service, 1)
+
+	service.CloseSubscriptions()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error %v", err)
+}
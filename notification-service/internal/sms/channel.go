@@ -0,0 +1,33 @@
+// Package sms sends the notifications of service providers by text message.
+package sms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+)
+
+// channel is a stub of the SMS notification.Channel. No SMS gateway is integrated yet, so it skips the text
+// messages it would send.
+type channel struct {
+	logger log.Logger
+}
+
+// NewChannel creates the SMS channel.
+func NewChannel(logger log.Logger) notification.Channel {
+	return channel{logger: logger}
+}
+
+// Name returns the channel name
+func (c channel) Name() string {
+	return notification.ChannelSMS
+}
+
+// Send skips the text message of a notification, since there is no gateway to send it to
+func (c channel) Send(ctx context.Context, n notification.Notification) error {
+	c.logger.With(ctx, "service_provider_id", n.ServiceProviderID, "notification_id", n.ID).
+		Info("Skipped SMS, no gateway is integrated")
+	return fmt.Errorf("%w: no SMS gateway is integrated", notification.ErrChannelSkipped)
+}
@@ -0,0 +1,24 @@
+package sms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannel_Send(t *testing.T) {
+	logger, entries := log.NewForTest()
+	c := NewChannel(logger)
+	assert.Equal(t, notification.ChannelSMS, c.Name())
+
+	n := notification.Notification{ID: "n1", ServiceProviderID: "sp-1", Message: "New 5-star rating received"}
+	assert.ErrorIs(t, c.Send(context.Background(), n), notification.ErrChannelSkipped)
+	logs := entries.FilterMessage("Skipped SMS, no gateway is integrated").All()
+	require.Len(t, logs, 1)
+	assert.Equal(t, "n1", logs[0].ContextMap()["notification_id"])
+	assert.NotContains(t, logs[0].ContextMap(), "text", "the message is not logged")
+}
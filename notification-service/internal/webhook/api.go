@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/errors"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+const (
+	// defaultDeliveryPageSize is the number of deliveries returned when no limit is given.
+	defaultDeliveryPageSize = 20
+)
+
+// urlSchemePattern restricts webhook URLs to HTTP and HTTPS.
+var urlSchemePattern = regexp.MustCompile(`^https?://`)
+
+// RegisterHandlers sets up the routing of the webhook HTTP handlers.
+// All routes require a provider token of the service provider in the path, see notification.SignProviderToken.
+func RegisterHandlers(r *routing.RouteGroup, service Service, tokenSecret string, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(notification.ProviderAuthHandler(tokenSecret))
+
+	r.Post("/<serviceProviderId>", res.create)
+	r.Get("/<serviceProviderId>", res.list)
+	r.Get("/<serviceProviderId>/<id>", res.get)
+	r.Delete("/<serviceProviderId>/<id>", res.delete)
+	r.Get("/<serviceProviderId>/<id>/deliveries", res.listDeliveries)
+	r.Post("/<serviceProviderId>/<id>/deliveries/<deliveryId>/redeliver", res.redeliver)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// create handles POST /api/webhooks/{serviceProviderId}
+func (r resource) create(c *routing.Context) error {
+	var req CreateSubscriptionRequest
+	if err := c.Read(&req); err != nil {
+		r.logger.With(c.Request.Context(), "error", err).Error("Failed to parse webhook subscription request")
+		return errors.BadRequest("Invalid request format")
+	}
+	if err := validation.ValidateStruct(&req,
+		validation.Field(&req.URL, validation.Required, validation.Length(1, 2048), is.RequestURL, validation.Match(urlSchemePattern)),
+		validation.Field(&req.EventTypes, validation.Required, validation.Each(validation.In(notification.EventRatingCreated, notification.EventRatingDigest))),
+	); err != nil {
+		return err
+	}
+
+	resp, err := r.service.CreateSubscription(c.Request.Context(), c.Param("serviceProviderId"), req)
+	if err != nil {
+		return mapError(err)
+	}
+	return c.WriteWithStatus(resp, http.StatusCreated)
+}
+
+// list handles GET /api/webhooks/{serviceProviderId}
+func (r resource) list(c *routing.Context) error {
+	subscriptions, err := r.service.ListSubscriptions(c.Request.Context(), c.Param("serviceProviderId"))
+	if err != nil {
+		return err
+	}
+	return c.Write(subscriptions)
+}
+
+// get handles GET /api/webhooks/{serviceProviderId}/{id}
+func (r resource) get(c *routing.Context) error {
+	subscription, err := r.service.GetSubscription(c.Request.Context(), c.Param("serviceProviderId"), c.Param("id"))
+	if err != nil {
+		return mapError(err)
+	}
+	return c.Write(subscription)
+}
+
+// delete handles DELETE /api/webhooks/{serviceProviderId}/{id}
+func (r resource) delete(c *routing.Context) error {
+	if err := r.service.DeleteSubscription(c.Request.Context(), c.Param("serviceProviderId"), c.Param("id")); err != nil {
+		return mapError(err)
+	}
+	c.Response.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// listDeliveries handles GET /api/webhooks/{serviceProviderId}/{id}/deliveries, the latest first
+func (r resource) listDeliveries(c *routing.Context) error {
+	limit := defaultDeliveryPageSize
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxDeliveries {
+			return errors.BadRequest(fmt.Sprintf("Invalid limit. Use a number between 1 and %d", maxDeliveries))
+		}
+		limit = parsed
+	}
+
+	deliveries, err := r.service.ListDeliveries(c.Request.Context(), c.Param("serviceProviderId"), c.Param("id"), limit)
+	if err != nil {
+		return mapError(err)
+	}
+	return c.Write(deliveries)
+}
+
+// redeliver handles POST /api/webhooks/{serviceProviderId}/{id}/deliveries/{deliveryId}/redeliver
+func (r resource) redeliver(c *routing.Context) error {
+	delivery, err := r.service.Redeliver(c.Request.Context(), c.Param("serviceProviderId"), c.Param("id"), c.Param("deliveryId"))
+	if err != nil {
+		return mapError(err)
+	}
+	return c.Write(delivery)
+}
+
+// mapError converts the errors of the service into error responses.
+func mapError(err error) error {
+	switch {
+	case stderrors.Is(err, ErrNotFound):
+		return errors.NotFound("")
+	case stderrors.Is(err, ErrTooManySubscriptions):
+		return errors.BadRequest(fmt.Sprintf("At most %d webhook subscriptions per service provider are allowed", maxSubscriptions))
+	case stderrors.Is(err, ErrForbiddenAddress):
+		return errors.BadRequest("Webhook URLs must not point to loopback, private, link-local or metadata addresses")
+	case stderrors.Is(err, ErrUnknownHost):
+		return errors.BadRequest("The host of the webhook URL cannot be resolved")
+	case stderrors.Is(err, ErrDeliveryPending):
+		return errors.BadRequest("The delivery is still pending")
+	}
+	return err
+}
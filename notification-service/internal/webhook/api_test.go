@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/test"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPI(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	service, _ := newTestService(t, testConfig())
+	RegisterHandlers(router.Group("/api/webhooks"), service, secret, logger)
+
+	endpoint := newReceiver(t, http.StatusInternalServerError)
+	subscription := subscribe(t, service, endpoint.URL)
+	other, err := service.CreateSubscription(context.Background(), "other", CreateSubscriptionRequest{URL: endpoint.URL, EventTypes: []string{notification.EventRatingCreated}})
+	require.NoError(t, err)
+	require.Error(t, service.Send(context.Background(), newNotification("n1")))
+	delivery := latestDelivery(t, service, subscription.ID)
+
+	header := func(serviceProviderID string) http.Header {
+		h := http.Header{}
+		h.Set("Authorization", "Bearer "+notification.SignProviderToken(secret, serviceProviderID, time.Now().Add(time.Minute)))
+		return h
+	}
+	url := "/api/webhooks/" + serviceProviderID
+
+	tests := []test.APITestCase{
+		{Name: "missing token", Method: "GET", URL: url, WantStatus: http.StatusUnauthorized},
+		{Name: "token of another service provider", Method: "GET", URL: url, Header: header("other"), WantStatus: http.StatusUnauthorized},
+		{Name: "create", Method: "POST", URL: url, Body: `{"url":"https://example.com/hook","eventTypes":["rating.created"]}`, Header: header(serviceProviderID), WantStatus: http.StatusCreated, WantResponse: `*"secret":"whsec_*`},
+		{Name: "create without scheme", Method: "POST", URL: url, Body: `{"url":"example.com/hook","eventTypes":["rating.created"]}`, Header: header(serviceProviderID), WantStatus: http.StatusBadRequest},
+		{Name: "create with unknown event type", Method: "POST", URL: url, Body: `{"url":"https://example.com/hook","eventTypes":["rating.deleted"]}`, Header: header(serviceProviderID), WantStatus: http.StatusBadRequest},
+		{Name: "create without event types", Method: "POST", URL: url, Body: `{"url":"https://example.com/hook"}`, Header: header(serviceProviderID), WantStatus: http.StatusBadRequest},
+		{Name: "list", Method: "GET", URL: url, Header: header(serviceProviderID), WantStatus: http.StatusOK, WantResponse: `*"id":"` + subscription.ID + `"*`},
+		{Name: "get", Method: "GET", URL: url + "/" + subscription.ID, Header: header(serviceProviderID), WantStatus: http.StatusOK, WantResponse: `*"url":"` + endpoint.URL + `"*`},
+		{Name: "get subscription of another service provider", Method: "GET", URL: url + "/" + other.ID, Header: header(serviceProviderID), WantStatus: http.StatusNotFound},
+		{Name: "list deliveries", Method: "GET", URL: url + "/" + subscription.ID + "/deliveries", Header: header(serviceProviderID), WantStatus: http.StatusOK, WantResponse: `*"state":"failed"*`},
+		{Name: "invalid limit", Method: "GET", URL: url + "/" + subscription.ID + "/deliveries?limit=0", Header: header(serviceProviderID), WantStatus: http.StatusBadRequest},
+		{Name: "redeliver", Method: "POST", URL: url + "/" + subscription.ID + "/deliveries/" + delivery.ID + "/redeliver", Header: header(serviceProviderID), WantStatus: http.StatusOK, WantResponse: `*"state":"failed"*`},
+		{Name: "redeliver unknown delivery", Method: "POST", URL: url + "/" + subscription.ID + "/deliveries/unknown/redeliver", Header: header(serviceProviderID), WantStatus: http.StatusNotFound},
+		{Name: "delete", Method: "DELETE", URL: url + "/" + subscription.ID, Header: header(serviceProviderID), WantStatus: http.StatusNoContent},
+		{Name: "delete again", Method: "DELETE", URL: url + "/" + subscription.ID, Header: header(serviceProviderID), WantStatus: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
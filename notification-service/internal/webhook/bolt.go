@@ -0,0 +1,324 @@
+package webhook
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// subscriptionsBucket maps a subscription ID to a subscription
+	subscriptionsBucket = []byte("subscriptions")
+	// providersBucket holds a bucket per service provider which maps a sequence number to the ID of a subscription,
+	// so that the subscriptions of a service provider are iterated in the order they were created
+	providersBucket = []byte("provider_subscriptions")
+	// deliveryLogsBucket holds a bucket per subscription which maps a sequence number to a delivery, the oldest first
+	deliveryLogsBucket = []byte("delivery_logs")
+	// deliveryIDsBucket maps the ID of a delivery to its sequence number followed by its subscription ID
+	deliveryIDsBucket = []byte("delivery_ids")
+)
+
+// boltStorage implements Storage using an embedded bbolt database file
+type boltStorage struct {
+	db *bolt.DB
+}
+
+// storedSubscription is the encoding of a stored subscription, which includes its secret.
+type storedSubscription struct {
+	Subscription
+	Secret string `json:"secret"`
+}
+
+// storedDelivery is the encoding of a stored delivery, which includes its payload.
+type storedDelivery struct {
+	Delivery
+	Payload []byte `json:"payload"`
+}
+
+// NewBoltStorage opens or creates the bbolt database file at the given path and returns a storage backed by it.
+func NewBoltStorage(path string) (Storage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhook database %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{subscriptionsBucket, providersBucket, deliveryLogsBucket, deliveryIDsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize webhook database %s: %w", path, err)
+	}
+	return &boltStorage{db: db}, nil
+}
+
+// CreateSubscription stores a subscription unless its service provider has limit subscriptions
+func (s *boltStorage) CreateSubscription(ctx context.Context, subscription Subscription, limit int) error {
+	value, err := json.Marshal(storedSubscription{Subscription: subscription, Secret: subscription.Secret})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		provider, err := tx.Bucket(providersBucket).CreateBucketIfNotExists([]byte(subscription.ServiceProviderID))
+		if err != nil {
+			return err
+		}
+		if countKeys(provider) >= limit {
+			return ErrTooManySubscriptions
+		}
+		seq, err := provider.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := provider.Put(encodeSequence(seq), []byte(subscription.ID)); err != nil {
+			return err
+		}
+		return tx.Bucket(subscriptionsBucket).Put([]byte(subscription.ID), value)
+	})
+}
+
+// GetSubscription returns a subscription by its ID
+func (s *boltStorage) GetSubscription(ctx context.Context, id string) (subscription Subscription, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		subscription, err = getSubscription(tx, id)
+		return err
+	})
+	return subscription, err
+}
+
+// ListSubscriptions returns the subscriptions of a service provider in the order they were created
+func (s *boltStorage) ListSubscriptions(ctx context.Context, serviceProviderID string) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := s.db.View(func(tx *bolt.Tx) error {
+		provider := tx.Bucket(providersBucket).Bucket([]byte(serviceProviderID))
+		if provider == nil {
+			return nil
+		}
+		return provider.ForEach(func(_, id []byte) error {
+			subscription, err := getSubscription(tx, string(id))
+			if err != nil {
+				return err
+			}
+			subscriptions = append(subscriptions, subscription)
+			return nil
+		})
+	})
+	return subscriptions, err
+}
+
+// DeleteSubscription deletes a subscription and its delivery log
+func (s *boltStorage) DeleteSubscription(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		subscription, err := getSubscription(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(subscriptionsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		if provider := tx.Bucket(providersBucket).Bucket([]byte(subscription.ServiceProviderID)); provider != nil {
+			var key []byte
+			err := provider.ForEach(func(k, v []byte) error {
+				if string(v) == id {
+					key = k
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if key != nil {
+				if err := provider.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		logs := tx.Bucket(deliveryLogsBucket)
+		deliveryLog := logs.Bucket([]byte(id))
+		if deliveryLog == nil {
+			return nil
+		}
+		ids := tx.Bucket(deliveryIDsBucket)
+		err = deliveryLog.ForEach(func(_, v []byte) error {
+			delivery, err := decodeDelivery(v)
+			if err != nil {
+				return err
+			}
+			return ids.Delete([]byte(delivery.ID))
+		})
+		if err != nil {
+			return err
+		}
+		return logs.DeleteBucket([]byte(id))
+	})
+}
+
+// SaveDelivery creates or updates a delivery and removes the oldest deliveries of its subscription beyond
+// maxDeliveries
+func (s *boltStorage) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	value, err := json.Marshal(storedDelivery{Delivery: delivery, Payload: delivery.Payload})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(subscriptionsBucket).Get([]byte(delivery.SubscriptionID)) == nil {
+			return ErrNotFound
+		}
+		deliveryLog, err := tx.Bucket(deliveryLogsBucket).CreateBucketIfNotExists([]byte(delivery.SubscriptionID))
+		if err != nil {
+			return err
+		}
+		ids := tx.Bucket(deliveryIDsBucket)
+		if ref := ids.Get([]byte(delivery.ID)); ref != nil {
+			return deliveryLog.Put(append([]byte(nil), ref[:8]...), value)
+		}
+
+		seq, err := deliveryLog.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := encodeSequence(seq)
+		if err := deliveryLog.Put(key, value); err != nil {
+			return err
+		}
+		if err := ids.Put([]byte(delivery.ID), append(key, delivery.SubscriptionID...)); err != nil {
+			return err
+		}
+
+		for excess := countKeys(deliveryLog) - maxDeliveries; excess > 0; excess-- {
+			k, v := deliveryLog.Cursor().First()
+			oldest, err := decodeDelivery(v)
+			if err != nil {
+				return err
+			}
+			if err := ids.Delete([]byte(oldest.ID)); err != nil {
+				return err
+			}
+			if err := deliveryLog.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetDelivery returns a delivery by its ID
+func (s *boltStorage) GetDelivery(ctx context.Context, id string) (delivery Delivery, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		ref := tx.Bucket(deliveryIDsBucket).Get([]byte(id))
+		if ref == nil {
+			return ErrNotFound
+		}
+		deliveryLog := tx.Bucket(deliveryLogsBucket).Bucket(ref[8:])
+		if deliveryLog == nil {
+			return ErrNotFound
+		}
+		value := deliveryLog.Get(ref[:8])
+		if value == nil {
+			return ErrNotFound
+		}
+		delivery, err = decodeDelivery(value)
+		return err
+	})
+	return delivery, err
+}
+
+// FindDelivery returns the latest delivery of a notification to a subscription
+func (s *boltStorage) FindDelivery(ctx context.Context, subscriptionID, notificationID string) (delivery Delivery, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		deliveryLog := tx.Bucket(deliveryLogsBucket).Bucket([]byte(subscriptionID))
+		if deliveryLog == nil {
+			return ErrNotFound
+		}
+		c := deliveryLog.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			found, err := decodeDelivery(v)
+			if err != nil {
+				return err
+			}
+			if found.NotificationID == notificationID {
+				delivery = found
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return delivery, err
+}
+
+// ListDeliveries returns up to limit deliveries of a subscription, the latest first
+func (s *boltStorage) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		deliveryLog := tx.Bucket(deliveryLogsBucket).Bucket([]byte(subscriptionID))
+		if deliveryLog == nil {
+			return nil
+		}
+		c := deliveryLog.Cursor()
+		for k, v := c.Last(); k != nil && len(deliveries) < limit; k, v = c.Prev() {
+			delivery, err := decodeDelivery(v)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+// Close closes the database
+func (s *boltStorage) Close() error {
+	return s.db.Close()
+}
+
+// getSubscription decodes a stored subscription with its secret.
+func getSubscription(tx *bolt.Tx, id string) (Subscription, error) {
+	value := tx.Bucket(subscriptionsBucket).Get([]byte(id))
+	if value == nil {
+		return Subscription{}, ErrNotFound
+	}
+	var stored storedSubscription
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return Subscription{}, fmt.Errorf("failed to decode stored webhook subscription: %w", err)
+	}
+	stored.Subscription.Secret = stored.Secret
+	return stored.Subscription, nil
+}
+
+// decodeDelivery decodes a stored delivery with its payload.
+func decodeDelivery(value []byte) (Delivery, error) {
+	var stored storedDelivery
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return Delivery{}, fmt.Errorf("failed to decode stored webhook delivery: %w", err)
+	}
+	stored.Delivery.Payload = stored.Payload
+	return stored.Delivery, nil
+}
+
+// countKeys returns the number of keys of a bucket, including the ones written by the current transaction.
+func countKeys(bucket *bolt.Bucket) int {
+	n := 0
+	c := bucket.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+	return n
+}
+
+// encodeSequence encodes a sequence number as a big-endian key so that keys sort in sequence order.
+func encodeSequence(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+var (
+	// ErrForbiddenAddress is returned when a webhook URL points to an address of the internal network.
+	ErrForbiddenAddress = errors.New("webhook URLs must not point to loopback, private, link-local or metadata addresses")
+	// ErrUnknownHost is returned when the host of a webhook URL cannot be resolved.
+	ErrUnknownHost = errors.New("the host of the webhook URL cannot be resolved")
+)
+
+// forbiddenPrefixes are the internal networks which are not covered by the other checks.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // this network
+	netip.MustParsePrefix("100.64.0.0/10"), // shared address space, which includes the Alibaba Cloud metadata service
+}
+
+// resolver looks up the addresses of a host, see net.Resolver.
+type resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// addressGuard keeps webhooks from reaching the services of the internal network. URLs are checked when a
+// subscription is created, and every connection is checked again when it is dialed, since DNS answers may change.
+type addressGuard struct {
+	resolver  resolver
+	forbidden func(addr netip.Addr) bool
+}
+
+// newAddressGuard creates a guard which resolves hosts with the default resolver and forbids internal addresses.
+func newAddressGuard() addressGuard {
+	return addressGuard{resolver: net.DefaultResolver, forbidden: forbiddenAddr}
+}
+
+// checkURL returns ErrForbiddenAddress when the host of a webhook URL is or resolves to a forbidden address.
+func (g addressGuard) checkURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.check(addr)
+	}
+
+	addrs, err := g.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrUnknownHost, host, err)
+	}
+	for _, addr := range addrs {
+		if err := g.check(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// control checks the address of a connection before it is dialed, see net.Dialer.Control.
+func (g addressGuard) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	return g.check(addrPort.Addr())
+}
+
+// check returns ErrForbiddenAddress when an address is forbidden.
+func (g addressGuard) check(addr netip.Addr) error {
+	if g.forbidden(addr.Unmap()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
+
+// forbiddenAddr reports whether an address belongs to the internal network: loopback, private, link-local (which
+// includes the 169.254.169.254 metadata service), unspecified, multicast, "this network" and shared addresses.
+func forbiddenAddr(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsUnspecified() || addr.IsMulticast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// staticResolver resolves every host to the given addresses, or to a public address.
+type staticResolver map[string][]netip.Addr
+
+func (r staticResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if addrs, ok := r[host]; ok {
+		return addrs, nil
+	}
+	return []netip.Addr{netip.MustParseAddr("93.184.215.14")}, nil
+}
+
+func TestForbiddenAddr(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.215.14":        false,
+		"2606:2800:21f::1":     false,
+		"127.0.0.1":            true,
+		"::1":                  true,
+		"10.1.2.3":             true,
+		"172.16.0.1":           true,
+		"192.168.1.1":          true,
+		"169.254.169.254":      true,
+		"fe80::1":              true,
+		"fd00:ec2::254":        true,
+		"100.100.100.200":      true,
+		"0.0.0.0":              true,
+		"0.1.2.3":              true,
+		"100.64.0.1":           true,
+		"100.127.255.254":      true,
+		"100.128.0.1":          false,
+		"224.0.0.1":            true,
+		"::ffff:127.0.0.1":     true,
+		"::ffff:93.184.215.14": false,
+	}
+	guard := newAddressGuard()
+	for addr, want := range tests {
+		t.Run(addr, func(t *testing.T) {
+			err := guard.check(netip.MustParseAddr(addr))
+			if want {
+				assert.ErrorIs(t, err, ErrForbiddenAddress)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAddressGuard_CheckURL(t *testing.T) {
+	guard := addressGuard{
+		resolver: staticResolver{
+			"internal.example.com": {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("10.0.0.5")},
+		},
+		forbidden: forbiddenAddr,
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, guard.checkURL(ctx, "https://example.com/hook"))
+	assert.ErrorIs(t, guard.checkURL(ctx, "http://127.0.0.1:8080/hook"), ErrForbiddenAddress)
+	assert.ErrorIs(t, guard.checkURL(ctx, "http://[::1]/hook"), ErrForbiddenAddress)
+	assert.ErrorIs(t, guard.checkURL(ctx, "http://169.254.169.254/latest/meta-data"), ErrForbiddenAddress)
+	assert.ErrorIs(t, guard.checkURL(ctx, "https://internal.example.com/hook"), ErrForbiddenAddress,
+		"a host is forbidden when any of its addresses is")
+}
+
+func TestService_ForbiddenAddresses(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(NewInMemoryStorage(), circuitbreaker.NewRegistry(), logger, testConfig()).(*service)
+	ctx := context.Background()
+
+	endpoint := newReceiver(t, http.StatusOK)
+	_, err := s.CreateSubscription(ctx, serviceProviderID, CreateSubscriptionRequest{URL: endpoint.URL, EventTypes: []string{notification.EventRatingCreated}})
+	assert.ErrorIs(t, err, ErrForbiddenAddress, "loopback endpoints cannot be registered")
+
+	// connections are checked when they are dialed, since a host may resolve to another address by then
+	_, err = s.send(ctx, Subscription{ID: "s1", URL: endpoint.URL}, Delivery{ID: "d1", Payload: []byte("{}")})
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.False(t, isRetryableError(err))
+	assert.Zero(t, endpoint.received())
+}
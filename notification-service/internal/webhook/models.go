@@ -0,0 +1,74 @@
+// Package webhook delivers the notifications of service providers to webhook endpoints they registered.
+package webhook
+
+import (
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+)
+
+// Delivery states. A delivery is pending until it succeeded or all its attempts failed.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Subscription represents a webhook endpoint of a service provider which receives the events of the given types.
+// The secret signs the deliveries; it is only returned when the subscription is created.
+type Subscription struct {
+	ID                string    `json:"id"`
+	ServiceProviderID string    `json:"serviceProviderId"`
+	URL               string    `json:"url"`
+	EventTypes        []string  `json:"eventTypes"`
+	Secret            string    `json:"-"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// Matches reports whether the subscription receives the events of the given type.
+func (s Subscription) Matches(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the payload delivered to a webhook endpoint. Its ID is the notification ID, which stays the same
+// when the event is redelivered, so that receivers can detect duplicates.
+type Event struct {
+	ID        string                    `json:"id"`
+	Type      string                    `json:"type"`
+	CreatedAt time.Time                 `json:"createdAt"`
+	Data      notification.Notification `json:"data"`
+}
+
+// Delivery records the delivery of an event to a webhook subscription.
+type Delivery struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscriptionId"`
+	NotificationID string    `json:"notificationId"`
+	EventType      string    `json:"eventType"`
+	State          string    `json:"state"`
+	Attempts       int       `json:"attempts"`
+	StatusCode     int       `json:"statusCode,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	// the JSON encoded event, sent again unchanged on redelivery
+	Payload []byte `json:"-"`
+}
+
+// CreateSubscriptionRequest represents a request to register a webhook endpoint
+type CreateSubscriptionRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+// CreateSubscriptionResponse represents the response after registering a webhook endpoint. It is the only
+// response which contains the secret.
+type CreateSubscriptionResponse struct {
+	Subscription
+	Secret string `json:"secret"`
+}
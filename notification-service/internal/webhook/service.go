@@ -0,0 +1,418 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("github.com/berkaykrc/homerun-ratings-system/notification-service/internal/webhook")
+
+// maxSubscriptions is the maximum number of webhook subscriptions of a service provider.
+const maxSubscriptions = 10
+
+var (
+	// ErrTooManySubscriptions is returned when a service provider already has the maximum number of subscriptions.
+	ErrTooManySubscriptions = fmt.Errorf("at most %d webhook subscriptions per service provider are allowed", maxSubscriptions)
+	// ErrDeliveryPending is returned when redelivering a delivery which has not finished yet.
+	ErrDeliveryPending = errors.New("the delivery is still pending")
+)
+
+// Service manages the webhook subscriptions of the service providers and delivers their notifications.
+// It is the webhook notification.Channel.
+type Service interface {
+	CreateSubscription(ctx context.Context, serviceProviderID string, req CreateSubscriptionRequest) (*CreateSubscriptionResponse, error)
+	ListSubscriptions(ctx context.Context, serviceProviderID string) ([]Subscription, error)
+	GetSubscription(ctx context.Context, serviceProviderID, id string) (*Subscription, error)
+	DeleteSubscription(ctx context.Context, serviceProviderID, id string) error
+	// ListDeliveries returns up to limit deliveries of a subscription, the latest first.
+	ListDeliveries(ctx context.Context, serviceProviderID, subscriptionID string, limit int) ([]Delivery, error)
+	// Redeliver sends a finished delivery again with the same payload and returns its outcome.
+	Redeliver(ctx context.Context, serviceProviderID, subscriptionID, deliveryID string) (*Delivery, error)
+	Name() string
+	// Send delivers a notification to the matching subscriptions of its service provider. Subscriptions which
+	// already received the notification are skipped, so that the dispatcher can retry a partially failed delivery.
+	Send(ctx context.Context, notification notification.Notification) error
+	// GuardsRecipients reports that every subscription has its own circuit breaker.
+	GuardsRecipients() bool
+}
+
+// service implements the Service interface
+type service struct {
+	storage  Storage
+	client   *http.Client
+	guard    addressGuard
+	config   config.ChannelConfig
+	breakers *circuitbreaker.Registry
+	logger   log.Logger
+
+	breakerMu sync.Mutex
+}
+
+// NewService creates a webhook service with the settings of the webhook channel. Every subscription gets a circuit
+// breaker with the channel's circuit breaker settings, registered with the given registry, so that a failing
+// endpoint does not affect the others. Webhooks are never sent to the addresses of the internal network.
+func NewService(storage Storage, breakers *circuitbreaker.Registry, logger log.Logger, cfg config.ChannelConfig) Service {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.CircuitBreaker == (circuitbreaker.Config{}) {
+		cfg.CircuitBreaker = circuitbreaker.DefaultConfig()
+	}
+
+	s := &service{
+		storage:  storage,
+		guard:    newAddressGuard(),
+		config:   cfg,
+		breakers: breakers,
+		logger:   logger,
+	}
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return s.guard.control(network, address, c)
+		},
+	}
+	// no proxy, so that the guard checks the addresses of the endpoints themselves
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: cfg.Timeout,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	s.client = &http.Client{Timeout: cfg.Timeout, Transport: transport}
+	return s
+}
+
+// CreateSubscription registers a webhook endpoint with a new secret unless it points to the internal network
+func (s *service) CreateSubscription(ctx context.Context, serviceProviderID string, req CreateSubscriptionRequest) (*CreateSubscriptionResponse, error) {
+	if err := s.guard.checkURL(ctx, req.URL); err != nil {
+		return nil, err
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	subscription := Subscription{
+		ID:                uuid.New().String(),
+		ServiceProviderID: serviceProviderID,
+		URL:               req.URL,
+		EventTypes:        req.EventTypes,
+		Secret:            secret,
+		CreatedAt:         time.Now(),
+	}
+	if err := s.storage.CreateSubscription(ctx, subscription, maxSubscriptions); err != nil {
+		if errors.Is(err, ErrTooManySubscriptions) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	s.logger.With(ctx, "service_provider_id", serviceProviderID, "subscription_id", subscription.ID).
+		Info("Created webhook subscription")
+	return &CreateSubscriptionResponse{Subscription: subscription, Secret: secret}, nil
+}
+
+// ListSubscriptions returns the webhook subscriptions of a service provider
+func (s *service) ListSubscriptions(ctx context.Context, serviceProviderID string) ([]Subscription, error) {
+	subscriptions, err := s.storage.ListSubscriptions(ctx, serviceProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	if subscriptions == nil {
+		subscriptions = []Subscription{}
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription returns a webhook subscription of a service provider
+func (s *service) GetSubscription(ctx context.Context, serviceProviderID, id string) (*Subscription, error) {
+	subscription, err := s.storage.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// the subscriptions of other service providers do not exist for the caller
+	if subscription.ServiceProviderID != serviceProviderID {
+		return nil, ErrNotFound
+	}
+	return &subscription, nil
+}
+
+// DeleteSubscription deletes a webhook subscription of a service provider and its delivery log
+func (s *service) DeleteSubscription(ctx context.Context, serviceProviderID, id string) error {
+	if _, err := s.GetSubscription(ctx, serviceProviderID, id); err != nil {
+		return err
+	}
+	if err := s.storage.DeleteSubscription(ctx, id); err != nil {
+		return err
+	}
+	s.breakers.Remove(breakerName(id))
+
+	s.logger.With(ctx, "service_provider_id", serviceProviderID, "subscription_id", id).
+		Info("Deleted webhook subscription")
+	return nil
+}
+
+// ListDeliveries returns the latest deliveries of a webhook subscription
+func (s *service) ListDeliveries(ctx context.Context, serviceProviderID, subscriptionID string, limit int) ([]Delivery, error) {
+	if _, err := s.GetSubscription(ctx, serviceProviderID, subscriptionID); err != nil {
+		return nil, err
+	}
+	return s.storage.ListDeliveries(ctx, subscriptionID, limit)
+}
+
+// Redeliver sends a finished delivery again
+func (s *service) Redeliver(ctx context.Context, serviceProviderID, subscriptionID, deliveryID string) (*Delivery, error) {
+	subscription, err := s.GetSubscription(ctx, serviceProviderID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := s.storage.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.SubscriptionID != subscriptionID {
+		return nil, ErrNotFound
+	}
+	if delivery.State == DeliveryPending {
+		return nil, ErrDeliveryPending
+	}
+
+	s.logger.With(ctx, "subscription_id", subscriptionID, "delivery_id", deliveryID).Info("Redelivering webhook")
+	_ = s.deliver(ctx, *subscription, &delivery)
+	return &delivery, nil
+}
+
+// Name returns the channel name
+func (s *service) Name() string {
+	return notification.ChannelWebhook
+}
+
+// GuardsRecipients reports that every subscription has its own circuit breaker
+func (s *service) GuardsRecipients() bool {
+	return true
+}
+
+// Send delivers a notification to every subscription of its service provider which receives its event type and has
+// not received it yet. The endpoints are called concurrently. The error is permanent when none of the failures can be
+// fixed by retrying.
+func (s *service) Send(ctx context.Context, n notification.Notification) error {
+	subscriptions, err := s.storage.ListSubscriptions(ctx, n.ServiceProviderID)
+	if err != nil {
+		return fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	var matching []Subscription
+	for _, subscription := range subscriptions {
+		if subscription.Matches(n.Type) {
+			matching = append(matching, subscription)
+		}
+	}
+	if len(matching) == 0 {
+		return fmt.Errorf("%w: no webhook subscription for %s events", notification.ErrChannelSkipped, n.Type)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		errs      []error
+		permanent = true
+	)
+	for _, subscription := range matching {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.sendTo(ctx, subscription, n); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, fmt.Errorf("subscription %s: %w", subscription.ID, err))
+				permanent = permanent && !isRetryableError(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	if err != nil && permanent {
+		return notification.Permanent(err)
+	}
+	return err
+}
+
+// sendTo delivers a notification to a subscription unless it already received it, reusing the delivery of
+// an earlier attempt.
+func (s *service) sendTo(ctx context.Context, subscription Subscription, n notification.Notification) error {
+	delivery, err := s.storage.FindDelivery(ctx, subscription.ID, n.ID)
+	if errors.Is(err, ErrNotFound) {
+		payload, err := json.Marshal(Event{ID: n.ID, Type: n.Type, CreatedAt: n.CreatedAt, Data: n})
+		if err != nil {
+			return notification.Permanent(fmt.Errorf("failed to marshal webhook event: %w", err))
+		}
+		delivery = Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			NotificationID: n.ID,
+			EventType:      n.Type,
+			CreatedAt:      time.Now(),
+			Payload:        payload,
+		}
+	} else if err != nil {
+		return err
+	}
+	if delivery.State == DeliverySucceeded {
+		return nil
+	}
+	return s.deliver(ctx, subscription, &delivery)
+}
+
+// deliver makes one attempt to send a delivery through the circuit breaker of its subscription and records the
+// outcome.
+func (s *service) deliver(ctx context.Context, subscription Subscription, delivery *Delivery) error {
+	ctx, span := tracer.Start(ctx, "webhook.deliver",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("webhook.subscription_id", subscription.ID),
+			attribute.String("webhook.delivery_id", delivery.ID),
+			semconv.HTTPRequestMethodKey.String("POST"),
+		),
+	)
+	delivery.State = DeliveryPending
+	delivery.UpdatedAt = time.Now()
+	if err := s.storage.SaveDelivery(ctx, *delivery); err != nil {
+		tracing.End(span, err)
+		return fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+
+	err := s.breaker(subscription.ID).Execute(ctx, func(ctx context.Context) error {
+		delivery.Attempts++
+		statusCode, err := s.send(ctx, subscription, *delivery)
+		delivery.StatusCode = statusCode
+		return err
+	})
+	tracing.End(span, err)
+
+	delivery.UpdatedAt = time.Now()
+	logger := s.logger.With(ctx, "subscription_id", subscription.ID, "delivery_id", delivery.ID, "attempts", delivery.Attempts)
+	if err != nil {
+		delivery.State = DeliveryFailed
+		delivery.Error = err.Error()
+		logger.With(ctx, "error", err).Error("Failed to deliver webhook")
+	} else {
+		delivery.State = DeliverySucceeded
+		delivery.Error = ""
+		logger.Info("Delivered webhook")
+	}
+	// the subscription may have been deleted in the meantime
+	if err := s.storage.SaveDelivery(ctx, *delivery); err != nil && !errors.Is(err, ErrNotFound) {
+		logger.With(ctx, "error", err).Error("Failed to save webhook delivery")
+	}
+	return err
+}
+
+// send posts the payload of a delivery to the subscription URL and returns the response status code.
+func (s *service) send(ctx context.Context, subscription Subscription, delivery Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notification-service/1.0")
+	req.Header.Set("X-Webhook-ID", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, time.Now(), delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	// read a bit of the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+// breaker returns the circuit breaker of a subscription, creating it on first use.
+func (s *service) breaker(subscriptionID string) *circuitbreaker.CircuitBreaker {
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+
+	name := breakerName(subscriptionID)
+	if cb, ok := s.breakers.Get(name); ok {
+		return cb
+	}
+	return s.breakers.New(name, s.config.CircuitBreaker, s.logger)
+}
+
+// breakerName returns the name of the circuit breaker of a subscription.
+func breakerName(subscriptionID string) string {
+	return "webhook:" + subscriptionID
+}
+
+// StatusError is returned when a webhook endpoint responds with a non-2xx status code.
+type StatusError struct {
+	StatusCode int
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook endpoint returned status %d", e.StatusCode)
+}
+
+// isRetryableError determines if a failed delivery attempt should be retried. Deliveries rejected by an open
+// circuit breaker are not retried, since the endpoint is known to be down, and neither are the ones to forbidden
+// addresses.
+func isRetryableError(err error) bool {
+	if errors.Is(err, circuitbreaker.ErrOpenState) || errors.Is(err, ErrForbiddenAddress) {
+		return false
+	}
+
+	// Retry on 408, 429 and 5xx HTTP status codes, but not on other client errors
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	// Retry on timeouts and network errors such as refused connections or DNS failures
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// newSecret generates a random subscription secret.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const serviceProviderID = "123e4567-e89b-12d3-a456-426614174000"
+
+// receiver is a webhook endpoint which records the requests it receives and responds with the given status codes
+// in turn, repeating the last one.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		status := r.statuses[min(len(r.requests), len(r.statuses)-1)]
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// received returns the number of received requests.
+func (r *receiver) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// testConfig returns webhook channel settings whose circuit breakers open on the first failure.
+func testConfig() config.ChannelConfig {
+	return config.ChannelConfig{
+		Timeout: time.Second,
+		CircuitBreaker: circuitbreaker.Config{
+			FailureThreshold: 1,
+			RecoveryTimeout:  time.Hour,
+			MinimumRequests:  1,
+		},
+	}
+}
+
+// newTestService creates a service which sends webhooks to the local test receivers.
+func newTestService(t *testing.T, cfg config.ChannelConfig) (Service, *circuitbreaker.Registry) {
+	logger, _ := log.NewForTest()
+	breakers := circuitbreaker.NewRegistry()
+	s := NewService(NewInMemoryStorage(), breakers, logger, cfg).(*service)
+	s.guard = addressGuard{resolver: staticResolver{}, forbidden: func(netip.Addr) bool { return false }}
+	return s, breakers
+}
+
+// subscribe registers a webhook endpoint of the test service provider.
+func subscribe(t *testing.T, service Service, url string) *CreateSubscriptionResponse {
+	resp, err := service.CreateSubscription(context.Background(), serviceProviderID, CreateSubscriptionRequest{
+		URL:        url,
+		EventTypes: []string{notification.EventRatingCreated},
+	})
+	require.NoError(t, err)
+	return resp
+}
+
+// newNotification returns a new notification of the test service provider.
+func newNotification(id string) notification.Notification {
+	return notification.Notification{
+		ID:                id,
+		ServiceProviderID: serviceProviderID,
+		RatingID:          "rating-" + id,
+		Type:              notification.EventRatingCreated,
+		Message:           "New 5-star rating received",
+		CreatedAt:         time.Now(),
+	}
+}
+
+// latestDelivery returns the latest delivery of a subscription.
+func latestDelivery(t *testing.T, service Service, subscriptionID string) Delivery {
+	deliveries, err := service.ListDeliveries(context.Background(), serviceProviderID, subscriptionID, 1)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	return deliveries[0]
+}
+
+func TestService_Send(t *testing.T) {
+	service, _ := newTestService(t, testConfig())
+	endpoint := newReceiver(t, http.StatusOK)
+	subscription := subscribe(t, service, endpoint.URL)
+	assert.True(t, strings.HasPrefix(subscription.Secret, "whsec_"))
+	assert.Equal(t, notification.ChannelWebhook, service.Name())
+
+	n := newNotification("n1")
+	require.NoError(t, service.Send(context.Background(), n))
+	delivery := latestDelivery(t, service, subscription.ID)
+	assert.Equal(t, DeliverySucceeded, delivery.State)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusOK, delivery.StatusCode)
+	assert.Equal(t, "n1", delivery.NotificationID)
+
+	require.Equal(t, 1, endpoint.received())
+	req, body := endpoint.requests[0], endpoint.bodies[0]
+	assert.Equal(t, delivery.ID, req.Header.Get("X-Webhook-ID"))
+	assert.Equal(t, notification.EventRatingCreated, req.Header.Get("X-Webhook-Event"))
+
+	// the signature covers the timestamp and the body
+	signature := req.Header.Get(SignatureHeader)
+	timestamp, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign(subscription.Secret, time.Unix(unix, 0), body), signature)
+	assert.NotEqual(t, Sign("other secret", time.Unix(unix, 0), body), signature)
+
+	var event Event
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, "n1", event.ID)
+	assert.Equal(t, notification.EventRatingCreated, event.Type)
+	assert.Equal(t, n.RatingID, event.Data.RatingID)
+
+	// sending the notification again does not call the endpoint which already received it
+	require.NoError(t, service.Send(context.Background(), n))
+	assert.Equal(t, 1, endpoint.received())
+}
+
+func TestService_SendSkipsOtherEvents(t *testing.T) {
+	service, _ := newTestService(t, testConfig())
+	endpoint := newReceiver(t, http.StatusOK)
+	subscription := subscribe(t, service, endpoint.URL)
+
+	err := service.Send(context.Background(), notification.Notification{ID: "n1", ServiceProviderID: serviceProviderID, Type: "rating.deleted"})
+	assert.ErrorIs(t, err, notification.ErrChannelSkipped)
+	err = service.Send(context.Background(), notification.Notification{ID: "n2", ServiceProviderID: "other", Type: notification.EventRatingCreated})
+	assert.ErrorIs(t, err, notification.ErrChannelSkipped)
+
+	deliveries, err := service.ListDeliveries(context.Background(), serviceProviderID, subscription.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestService_SendFailures(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int
+		wantPermanent []bool
+		state         string
+	}{
+		{"temporary failures", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}, []bool{false, false}, DeliverySucceeded},
+		{"permanent failure", []int{http.StatusGone}, []bool{true}, DeliveryFailed},
+		{"all attempts fail", []int{http.StatusInternalServerError}, []bool{false, false, false}, DeliveryFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CircuitBreaker.FailureThreshold = 5
+			service, _ := newTestService(t, cfg)
+			endpoint := newReceiver(t, tt.statuses...)
+			subscription := subscribe(t, service, endpoint.URL)
+			n := newNotification("n1")
+
+			// every retry of the dispatcher is a new attempt of the same delivery
+			attempts := 0
+			for _, wantPermanent := range tt.wantPermanent {
+				err := service.Send(context.Background(), n)
+				require.Error(t, err)
+				var permanentErr *notification.PermanentError
+				assert.Equal(t, wantPermanent, errors.As(err, &permanentErr))
+				assert.Contains(t, err.Error(), "webhook endpoint returned status")
+				attempts++
+			}
+			if tt.state == DeliverySucceeded {
+				require.NoError(t, service.Send(context.Background(), n))
+				attempts++
+			}
+
+			delivery := latestDelivery(t, service, subscription.ID)
+			assert.Equal(t, tt.state, delivery.State)
+			assert.Equal(t, attempts, delivery.Attempts)
+			assert.Equal(t, attempts, endpoint.received())
+		})
+	}
+}
+
+func TestService_CircuitBreakerPerEndpoint(t *testing.T) {
+	service, breakers := newTestService(t, testConfig())
+	failing := newReceiver(t, http.StatusInternalServerError)
+	healthy := newReceiver(t, http.StatusOK)
+	failingSubscription := subscribe(t, service, failing.URL)
+	healthySubscription := subscribe(t, service, healthy.URL)
+	ctx := context.Background()
+
+	err := service.Send(ctx, newNotification("n1"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), failingSubscription.ID)
+	assert.Equal(t, DeliveryFailed, latestDelivery(t, service, failingSubscription.ID).State)
+	assert.Equal(t, DeliverySucceeded, latestDelivery(t, service, healthySubscription.ID).State)
+
+	cb, ok := breakers.Get(breakerName(failingSubscription.ID))
+	require.True(t, ok)
+	assert.Equal(t, circuitbreaker.StateOpen, cb.GetState())
+
+	// the open circuit breaker fails the deliveries to its endpoint fast and permanently, while the other endpoint
+	// keeps receiving them
+	err = service.Send(ctx, newNotification("n2"))
+	require.Error(t, err)
+	var permanentErr *notification.PermanentError
+	assert.ErrorAs(t, err, &permanentErr)
+	assert.Equal(t, 2, healthy.received())
+	delivery := latestDelivery(t, service, failingSubscription.ID)
+	assert.Equal(t, "n2", delivery.NotificationID)
+	assert.Equal(t, DeliveryFailed, delivery.State)
+	assert.Equal(t, 0, delivery.Attempts)
+	assert.Equal(t, 1, failing.received())
+
+	require.NoError(t, service.DeleteSubscription(ctx, serviceProviderID, failingSubscription.ID))
+	_, ok = breakers.Get(breakerName(failingSubscription.ID))
+	assert.False(t, ok)
+}
+
+func TestService_Redeliver(t *testing.T) {
+	cfg := testConfig()
+	cfg.CircuitBreaker.FailureThreshold = 5
+	service, _ := newTestService(t, cfg)
+	endpoint := newReceiver(t, http.StatusBadRequest, http.StatusOK)
+	subscription := subscribe(t, service, endpoint.URL)
+	ctx := context.Background()
+
+	require.Error(t, service.Send(ctx, newNotification("n1")))
+	failed := latestDelivery(t, service, subscription.ID)
+	require.Equal(t, DeliveryFailed, failed.State)
+
+	redelivery, err := service.Redeliver(ctx, serviceProviderID, subscription.ID, failed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, failed.ID, redelivery.ID)
+	assert.Equal(t, DeliverySucceeded, redelivery.State)
+	assert.Equal(t, 2, redelivery.Attempts)
+	assert.Empty(t, redelivery.Error)
+	assert.Equal(t, *redelivery, latestDelivery(t, service, subscription.ID))
+	require.Equal(t, 2, endpoint.received())
+	assert.Equal(t, endpoint.bodies[0], endpoint.bodies[1])
+
+	_, err = service.Redeliver(ctx, serviceProviderID, subscription.ID, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = service.Redeliver(ctx, "other", subscription.ID, failed.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestService_Subscriptions(t *testing.T) {
+	service, _ := newTestService(t, testConfig())
+	ctx := context.Background()
+
+	for range maxSubscriptions {
+		subscribe(t, service, "https://example.com/hook")
+	}
+	_, err := service.CreateSubscription(ctx, serviceProviderID, CreateSubscriptionRequest{URL: "https://example.com/hook"})
+	assert.ErrorIs(t, err, ErrTooManySubscriptions)
+
+	subscriptions, err := service.ListSubscriptions(ctx, serviceProviderID)
+	require.NoError(t, err)
+	assert.Len(t, subscriptions, maxSubscriptions)
+	other, err := service.ListSubscriptions(ctx, "other")
+	require.NoError(t, err)
+	assert.Empty(t, other)
+
+	_, err = service.GetSubscription(ctx, "other", subscriptions[0].ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, service.DeleteSubscription(ctx, "other", subscriptions[0].ID), ErrNotFound)
+	require.NoError(t, service.DeleteSubscription(ctx, serviceProviderID, subscriptions[0].ID))
+	_, err = service.GetSubscription(ctx, serviceProviderID, subscriptions[0].ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// SignatureHeader is the request header which carries the signature of a delivery.
+const SignatureHeader = "X-Webhook-Signature"
+
+// Sign returns the signature header value of a delivery body sent at the given time: "t=<Unix seconds>,v1=<hex>",
+// where the hex value is the HMAC-SHA256 of "<Unix seconds>.<body>" keyed with the subscription secret.
+// Receivers recompute it to verify that a delivery is authentic, and reject old timestamps to prevent replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+)
+
+// ErrNotFound is returned when a subscription or delivery does not exist.
+var ErrNotFound = errors.New("not found")
+
+// maxDeliveries is the number of deliveries kept per subscription; older ones are removed from the delivery log.
+const maxDeliveries = 100
+
+// Storage represents the storage of the webhook subscriptions and their delivery log.
+type Storage interface {
+	// CreateSubscription creates a subscription unless its service provider already has limit subscriptions, in
+	// which case it returns ErrTooManySubscriptions. The check and the creation are atomic.
+	CreateSubscription(ctx context.Context, subscription Subscription, limit int) error
+	GetSubscription(ctx context.Context, id string) (Subscription, error)
+	// ListSubscriptions returns the subscriptions of a service provider in the order they were created.
+	ListSubscriptions(ctx context.Context, serviceProviderID string) ([]Subscription, error)
+	// DeleteSubscription deletes a subscription and its delivery log.
+	DeleteSubscription(ctx context.Context, id string) error
+	// SaveDelivery creates or updates a delivery.
+	SaveDelivery(ctx context.Context, delivery Delivery) error
+	GetDelivery(ctx context.Context, id string) (Delivery, error)
+	// FindDelivery returns the delivery of a notification to a subscription.
+	FindDelivery(ctx context.Context, subscriptionID, notificationID string) (Delivery, error)
+	// ListDeliveries returns up to limit deliveries of a subscription, the latest first.
+	ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]Delivery, error)
+	// Close releases the resources of the storage.
+	Close() error
+}
+
+// NewStorage creates the webhook storage of the configured notification storage backend. The bolt backend keeps the
+// webhooks in their own database file, see config.StorageConfig.WebhooksPath.
+func NewStorage(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Backend {
+	case "", config.StorageMemory:
+		return NewInMemoryStorage(), nil
+	case config.StorageBolt:
+		path := cfg.WebhooksPath
+		if path == "" {
+			path = filepath.Join(filepath.Dir(cfg.Path), "webhooks.db")
+		}
+		return NewBoltStorage(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// inMemoryStorage implements Storage in memory. Subscriptions are lost when the service restarts.
+type inMemoryStorage struct {
+	mu            sync.RWMutex
+	subscriptions map[string]Subscription
+	deliveries    map[string]Delivery
+	// the delivery IDs of every subscription, the oldest first
+	deliveryLog map[string][]string
+}
+
+// NewInMemoryStorage creates a new in-memory webhook storage.
+func NewInMemoryStorage() Storage {
+	return &inMemoryStorage{
+		subscriptions: make(map[string]Subscription),
+		deliveries:    make(map[string]Delivery),
+		deliveryLog:   make(map[string][]string),
+	}
+}
+
+func (s *inMemoryStorage) CreateSubscription(ctx context.Context, subscription Subscription, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, existing := range s.subscriptions {
+		if existing.ServiceProviderID == subscription.ServiceProviderID {
+			count++
+		}
+	}
+	if count >= limit {
+		return ErrTooManySubscriptions
+	}
+	s.subscriptions[subscription.ID] = subscription
+	return nil
+}
+
+func (s *inMemoryStorage) GetSubscription(ctx context.Context, id string) (Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subscription, ok := s.subscriptions[id]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	return subscription, nil
+}
+
+func (s *inMemoryStorage) ListSubscriptions(ctx context.Context, serviceProviderID string) ([]Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var subscriptions []Subscription
+	for _, subscription := range s.subscriptions {
+		if subscription.ServiceProviderID == serviceProviderID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+	return subscriptions, nil
+}
+
+func (s *inMemoryStorage) DeleteSubscription(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.subscriptions, id)
+	for _, deliveryID := range s.deliveryLog[id] {
+		delete(s.deliveries, deliveryID)
+	}
+	delete(s.deliveryLog, id)
+	return nil
+}
+
+func (s *inMemoryStorage) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscriptions[delivery.SubscriptionID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.deliveries[delivery.ID]; !ok {
+		ids := append(s.deliveryLog[delivery.SubscriptionID], delivery.ID)
+		if len(ids) > maxDeliveries {
+			delete(s.deliveries, ids[0])
+			ids = ids[1:]
+		}
+		s.deliveryLog[delivery.SubscriptionID] = ids
+	}
+	s.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (s *inMemoryStorage) GetDelivery(ctx context.Context, id string) (Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	return delivery, nil
+}
+
+func (s *inMemoryStorage) FindDelivery(ctx context.Context, subscriptionID, notificationID string) (Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.deliveryLog[subscriptionID]
+	for i := len(ids) - 1; i >= 0; i-- {
+		if delivery := s.deliveries[ids[i]]; delivery.NotificationID == notificationID {
+			return delivery, nil
+		}
+	}
+	return Delivery{}, ErrNotFound
+}
+
+func (s *inMemoryStorage) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.deliveryLog[subscriptionID]
+	deliveries := make([]Delivery, 0, min(len(ids), limit))
+	for i := len(ids) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		deliveries = append(deliveries, s.deliveries[ids[i]])
+	}
+	return deliveries, nil
+}
+
+func (s *inMemoryStorage) Close() error {
+	return nil
+}
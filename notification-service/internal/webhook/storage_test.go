@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storageBackends creates an instance of every Storage implementation.
+var storageBackends = map[string]func(t *testing.T) Storage{
+	"memory": func(t *testing.T) Storage {
+		return NewInMemoryStorage()
+	},
+	"bolt": func(t *testing.T) Storage {
+		storage, err := NewBoltStorage(filepath.Join(t.TempDir(), "webhooks.db"))
+		require.NoError(t, err)
+		return storage
+	},
+}
+
+// TestStorage runs the same contract tests against every Storage implementation.
+func TestStorage(t *testing.T) {
+	tests := map[string]func(t *testing.T, storage Storage){
+		"Subscriptions":     testStorageSubscriptions,
+		"SubscriptionLimit": testStorageSubscriptionLimit,
+		"DeliveryLog":       testStorageDeliveryLog,
+	}
+	for backend, newStorage := range storageBackends {
+		for name, test := range tests {
+			t.Run(backend+"/"+name, func(t *testing.T) {
+				storage := newStorage(t)
+				defer func() { assert.NoError(t, storage.Close()) }()
+				test(t, storage)
+			})
+		}
+	}
+}
+
+func testStorageSubscriptions(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	now := time.Now()
+	require.NoError(t, storage.CreateSubscription(ctx, Subscription{ID: "s1", ServiceProviderID: "sp-1", Secret: "whsec_1", CreatedAt: now}, maxSubscriptions))
+	require.NoError(t, storage.CreateSubscription(ctx, Subscription{ID: "s2", ServiceProviderID: "sp-1", CreatedAt: now.Add(time.Second)}, maxSubscriptions))
+	require.NoError(t, storage.CreateSubscription(ctx, Subscription{ID: "s3", ServiceProviderID: "sp-2", CreatedAt: now}, maxSubscriptions))
+
+	subscription, err := storage.GetSubscription(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "whsec_1", subscription.Secret, "the secret is stored")
+	_, err = storage.GetSubscription(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	subscriptions, err := storage.ListSubscriptions(ctx, "sp-1")
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 2)
+	assert.Equal(t, "s1", subscriptions[0].ID)
+	assert.Equal(t, "s2", subscriptions[1].ID)
+
+	require.NoError(t, storage.DeleteSubscription(ctx, "s1"))
+	subscriptions, err = storage.ListSubscriptions(ctx, "sp-1")
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, "s2", subscriptions[0].ID)
+}
+
+func testStorageSubscriptionLimit(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make([]error, 3*maxSubscriptions)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = storage.CreateSubscription(ctx, Subscription{ID: "s" + strconv.Itoa(i), ServiceProviderID: "sp-1", CreatedAt: time.Now()}, maxSubscriptions)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, ErrTooManySubscriptions)
+		}
+	}
+	assert.Equal(t, maxSubscriptions, created, "concurrent requests cannot exceed the limit")
+	subscriptions, err := storage.ListSubscriptions(ctx, "sp-1")
+	require.NoError(t, err)
+	assert.Len(t, subscriptions, maxSubscriptions)
+
+	require.NoError(t, storage.CreateSubscription(ctx, Subscription{ID: "other", ServiceProviderID: "sp-2", CreatedAt: time.Now()}, maxSubscriptions),
+		"the limit is per service provider")
+	require.NoError(t, storage.DeleteSubscription(ctx, subscriptions[0].ID))
+	assert.NoError(t, storage.CreateSubscription(ctx, Subscription{ID: "again", ServiceProviderID: "sp-1", CreatedAt: time.Now()}, maxSubscriptions))
+}
+
+func testStorageDeliveryLog(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	require.NoError(t, storage.CreateSubscription(ctx, Subscription{ID: "s1", ServiceProviderID: "sp-1", CreatedAt: time.Now()}, maxSubscriptions))
+
+	assert.ErrorIs(t, storage.SaveDelivery(ctx, Delivery{ID: "d0", SubscriptionID: "missing"}), ErrNotFound)
+	for i := range maxDeliveries + 5 {
+		require.NoError(t, storage.SaveDelivery(ctx, Delivery{ID: "d" + strconv.Itoa(i), SubscriptionID: "s1", NotificationID: "n" + strconv.Itoa(i), State: DeliveryPending}))
+	}
+	require.NoError(t, storage.SaveDelivery(ctx, Delivery{ID: "d10", SubscriptionID: "s1", NotificationID: "n10", State: DeliverySucceeded, Payload: []byte(`{"id":"n10"}`)}))
+
+	deliveries, err := storage.ListDeliveries(ctx, "s1", maxDeliveries*2)
+	require.NoError(t, err)
+	require.Len(t, deliveries, maxDeliveries, "the oldest deliveries are removed")
+	assert.Equal(t, "d104", deliveries[0].ID)
+	assert.Equal(t, "d5", deliveries[len(deliveries)-1].ID)
+	_, err = storage.GetDelivery(ctx, "d4")
+	assert.ErrorIs(t, err, ErrNotFound)
+	updated, err := storage.GetDelivery(ctx, "d10")
+	require.NoError(t, err)
+	assert.Equal(t, DeliverySucceeded, updated.State)
+	assert.Equal(t, `{"id":"n10"}`, string(updated.Payload), "the payload is stored")
+	found, err := storage.FindDelivery(ctx, "s1", "n10")
+	require.NoError(t, err)
+	assert.Equal(t, "d10", found.ID)
+	_, err = storage.FindDelivery(ctx, "s1", "n4")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	deliveries, err = storage.ListDeliveries(ctx, "s1", 2)
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 2)
+
+	require.NoError(t, storage.DeleteSubscription(ctx, "s1"))
+	_, err = storage.GetDelivery(ctx, "d10")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, storage.DeleteSubscription(ctx, "s1"), ErrNotFound)
+}
+
+func TestBoltStorage_PersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.StorageConfig{Backend: config.StorageBolt, Path: filepath.Join(t.TempDir(), "notifications.db")}
+	storage, err := NewStorage(cfg)
+	require.NoError(t, err)
+	require.NoError(t, storage.CreateSubscription(ctx, Subscription{ID: "s1", ServiceProviderID: "sp-1", Secret: "whsec_1", CreatedAt: time.Now()}, maxSubscriptions))
+	require.NoError(t, storage.SaveDelivery(ctx, Delivery{ID: "d1", SubscriptionID: "s1", State: DeliveryFailed, Payload: []byte("{}")}))
+	require.NoError(t, storage.Close())
+	assert.FileExists(t, filepath.Join(filepath.Dir(cfg.Path), "webhooks.db"), "webhooks are kept next to the notifications")
+
+	storage, err = NewStorage(cfg)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, storage.Close()) }()
+	subscriptions, err := storage.ListSubscriptions(ctx, "sp-1")
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, "whsec_1", subscriptions[0].Secret)
+	delivery, err := storage.GetDelivery(ctx, "d1")
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(delivery.Payload))
+}
@@ -23,3 +23,17 @@ func TestHandler(t *testing.T) {
 	assert.Equal(t, 1, entries.Len())
 	assert.Equal(t, "GET /healthcheck HTTP/1.1 200 0", entries.All()[0].Message)
 }
+
+func TestHandler_EchoesIDs(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/healthcheck", nil)
+	req.Header.Set(log.RequestIDHeader, "req-1")
+	req.Header.Set(log.CorrelationIDHeader, "corr-1")
+	ctx := routing.NewContext(res, req)
+
+	logger, _ := log.NewForTest()
+	assert.Nil(t, Handler(logger)(ctx))
+
+	assert.Equal(t, "req-1", res.Header().Get(log.RequestIDHeader))
+	assert.Equal(t, "corr-1", res.Header().Get(log.CorrelationIDHeader))
+}
@@ -2,14 +2,21 @@ package circuitbreaker
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const instrumentationName = "github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/circuitbreaker"
+
+// ErrOpenState is returned by Execute when the circuit breaker rejects a call.
+var ErrOpenState = errors.New("circuit breaker is OPEN, failing fast")
+
 // State represents the circuit breaker state
 type State int
 
@@ -35,11 +42,32 @@ func (s State) String() string {
 	}
 }
 
+const (
+	// ModeConsecutive opens the circuit breaker after FailureThreshold consecutive failures. This is the default mode.
+	ModeConsecutive = "consecutive"
+	// ModeCount opens the circuit breaker based on the failure and slow-call rates of the last WindowSize calls.
+	ModeCount = "count"
+	// ModeTime opens the circuit breaker based on the failure and slow-call rates of the calls made during the last WindowDuration.
+	ModeTime = "time"
+)
+
 // Config defines circuit breaker configuration
 type Config struct {
+	Mode             string        `yaml:"mode" json:"mode"`
 	FailureThreshold int           `yaml:"failure_threshold" json:"failureThreshold"`
 	RecoveryTimeout  time.Duration `yaml:"recovery_timeout" json:"recoveryTimeout"`
-	MinimumRequests  int           `yaml:"minimum_requests" json:"minimumRequests"`
+	// MinimumRequests is the number of successful probes needed in HALF_OPEN state to close the circuit breaker.
+	MinimumRequests int `yaml:"minimum_requests" json:"minimumRequests"`
+	// HalfOpenMaxCalls limits the number of concurrent probes in HALF_OPEN state. Defaults to 1.
+	HalfOpenMaxCalls int `yaml:"half_open_max_calls" json:"halfOpenMaxCalls"`
+
+	// sliding window settings, used by the count and time modes
+	WindowSize            int           `yaml:"window_size" json:"windowSize"`
+	WindowDuration        time.Duration `yaml:"window_duration" json:"windowDuration"`
+	MinimumCalls          int           `yaml:"minimum_calls" json:"minimumCalls"`
+	FailureRateThreshold  float64       `yaml:"failure_rate_threshold" json:"failureRateThreshold"`
+	SlowCallDuration      time.Duration `yaml:"slow_call_duration" json:"slowCallDuration"`
+	SlowCallRateThreshold float64       `yaml:"slow_call_rate_threshold" json:"slowCallRateThreshold"`
 }
 
 // DefaultConfig returns a default circuit breaker configuration
@@ -48,15 +76,28 @@ func DefaultConfig() Config {
 		FailureThreshold: 5,
 		RecoveryTimeout:  60 * time.Second,
 		MinimumRequests:  3,
+		HalfOpenMaxCalls: 1,
 	}
 }
 
 // Validate validates the circuit breaker configuration
 func (c Config) Validate() error {
+	windowed := c.Mode == ModeCount || c.Mode == ModeTime
 	return validation.ValidateStruct(&c,
-		validation.Field(&c.FailureThreshold, validation.Required, validation.Min(1)),
+		validation.Field(&c.Mode, validation.In(ModeConsecutive, ModeCount, ModeTime)),
+		validation.Field(&c.FailureThreshold, validation.When(!windowed, validation.Required, validation.Min(1))),
 		validation.Field(&c.RecoveryTimeout, validation.Required, validation.Min(time.Second)),
 		validation.Field(&c.MinimumRequests, validation.Required, validation.Min(1)),
+		validation.Field(&c.HalfOpenMaxCalls, validation.Min(0)),
+		validation.Field(&c.WindowSize, validation.When(c.Mode == ModeCount, validation.Required, validation.Min(1))),
+		validation.Field(&c.WindowDuration, validation.When(c.Mode == ModeTime, validation.Required, validation.Min(time.Second))),
+		validation.Field(&c.MinimumCalls, validation.When(windowed, validation.Required, validation.Min(1)),
+			// a count window holding fewer calls than required would never open the circuit breaker
+			validation.When(c.Mode == ModeCount && c.WindowSize > 0,
+				validation.Max(c.WindowSize).Error("must be no greater than the window size"))),
+		validation.Field(&c.FailureRateThreshold, validation.When(windowed, validation.Required), validation.Min(0.0), validation.Max(100.0)),
+		validation.Field(&c.SlowCallRateThreshold, validation.Min(0.0), validation.Max(100.0)),
+		validation.Field(&c.SlowCallDuration, validation.When(c.SlowCallRateThreshold > 0, validation.Required)),
 	)
 }
 
@@ -67,8 +108,14 @@ type CircuitBreaker struct {
 	failureCount int   // Count of consecutive failures
 	requestCount int   // Count of total requests
 	lastFailTime time.Time
-	mutex        sync.RWMutex
-	logger       log.Logger
+	openedAt     time.Time
+	forced       bool // set by Trip and ForceClose; suspends automatic state transitions
+	// generation changes on every state transition so that results of calls admitted in a previous state are ignored
+	generation    uint64
+	halfOpenCalls int    // probes in flight in HALF_OPEN state
+	window        window // nil in consecutive mode
+	mutex         sync.RWMutex
+	logger        log.Logger
 }
 
 // New creates a new circuit breaker
@@ -76,56 +123,113 @@ func New(config Config, logger log.Logger) *CircuitBreaker {
 	return &CircuitBreaker{
 		config: config,
 		state:  StateClosed,
+		window: newWindow(config),
 		logger: logger,
 	}
 }
 
 // Execute executes a function through the circuit breaker
 func (cb *CircuitBreaker) Execute(ctx context.Context, fn func(context.Context) error) error {
+	ctx, span := tracing.Tracer(instrumentationName).Start(ctx, "circuit_breaker.execute")
+
 	// Check if we can execute the function
-	if !cb.canExecute() {
-		return fmt.Errorf("circuit breaker is OPEN, failing fast")
+	generation, allowed := cb.canExecute()
+	span.SetAttributes(
+		attribute.String("circuit_breaker.state", cb.GetState().String()),
+		attribute.Bool("circuit_breaker.allowed", allowed),
+	)
+	if !allowed {
+		tracing.End(span, ErrOpenState)
+		return ErrOpenState
 	}
 
 	// Execute the function
+	start := time.Now()
 	err := fn(ctx)
 
 	// Record the result
-	cb.recordResult(err)
+	cb.recordResult(generation, err, time.Since(start))
 
+	tracing.End(span, err)
 	return err
 }
 
-// canExecute determines if the function can be executed
-func (cb *CircuitBreaker) canExecute() bool {
+// canExecute determines if the function can be executed and returns the generation the call is admitted in
+func (cb *CircuitBreaker) canExecute() (uint64, bool) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	if cb.forced {
+		return cb.generation, cb.state == StateClosed
+	}
+
 	switch cb.state {
 	case StateClosed:
-		return true
+		return cb.generation, true
 	case StateOpen:
 		// Check if recovery timeout has passed
-		if time.Since(cb.lastFailTime) >= cb.config.RecoveryTimeout {
-			cb.state = StateHalfOpen
+		if time.Since(cb.openedAt) >= cb.config.RecoveryTimeout {
+			cb.setState(StateHalfOpen)
 			cb.requestCount = 0
+			cb.halfOpenCalls++
 			cb.logger.Info("Circuit breaker transitioning to HALF_OPEN state")
-			return true
+			return cb.generation, true
 		}
-		return false
+		return cb.generation, false
 	case StateHalfOpen:
-		return cb.requestCount < cb.config.MinimumRequests
+		if cb.halfOpenCalls >= cb.halfOpenMaxCalls() || cb.requestCount+cb.halfOpenCalls >= cb.config.MinimumRequests {
+			return cb.generation, false
+		}
+		cb.halfOpenCalls++
+		return cb.generation, true
 	default:
-		return false
+		return cb.generation, false
+	}
+}
+
+// halfOpenMaxCalls returns the maximum number of concurrent probes in HALF_OPEN state
+func (cb *CircuitBreaker) halfOpenMaxCalls() int {
+	if cb.config.HalfOpenMaxCalls <= 0 {
+		return 1
+	}
+	return cb.config.HalfOpenMaxCalls
+}
+
+// setState transitions the circuit breaker to the given state. The caller must hold the mutex.
+func (cb *CircuitBreaker) setState(state State) {
+	cb.state = state
+	cb.generation++
+	cb.halfOpenCalls = 0
+	if state == StateOpen {
+		cb.openedAt = time.Now()
+	}
+	if cb.window != nil {
+		cb.window.reset()
 	}
 }
 
 // recordResult records the result of function execution
-func (cb *CircuitBreaker) recordResult(err error) {
+func (cb *CircuitBreaker) recordResult(generation uint64, err error, duration time.Duration) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	if generation != cb.generation {
+		// the state changed while the call was in flight
+		return
+	}
+	admittedState := cb.state
 	cb.requestCount++
+	if admittedState == StateHalfOpen {
+		cb.halfOpenCalls--
+	}
+
+	if cb.forced {
+		if err != nil {
+			cb.failureCount++
+			cb.lastFailTime = time.Now()
+		}
+		return
+	}
 
 	if err != nil {
 		cb.failureCount++
@@ -133,12 +237,12 @@ func (cb *CircuitBreaker) recordResult(err error) {
 
 		switch cb.state {
 		case StateClosed:
-			if cb.failureCount >= cb.config.FailureThreshold {
-				cb.state = StateOpen
+			if cb.window == nil && cb.failureCount >= cb.config.FailureThreshold {
+				cb.setState(StateOpen)
 				cb.logger.With(context.Background(), "failure_count", cb.failureCount).Error("Circuit breaker opening due to failure threshold")
 			}
 		case StateHalfOpen:
-			cb.state = StateOpen
+			cb.setState(StateOpen)
 			cb.logger.Error("Circuit breaker returning to OPEN state after failure in HALF_OPEN")
 		}
 	} else {
@@ -146,7 +250,7 @@ func (cb *CircuitBreaker) recordResult(err error) {
 		switch cb.state {
 		case StateHalfOpen:
 			if cb.requestCount >= cb.config.MinimumRequests {
-				cb.state = StateClosed
+				cb.setState(StateClosed)
 				cb.failureCount = 0
 				cb.requestCount = 0
 				cb.logger.Info("Circuit breaker closing after successful requests in HALF_OPEN")
@@ -158,6 +262,32 @@ func (cb *CircuitBreaker) recordResult(err error) {
 			}
 		}
 	}
+
+	if admittedState == StateClosed && cb.window != nil {
+		now := time.Now()
+		slow := cb.config.SlowCallDuration > 0 && duration >= cb.config.SlowCallDuration
+		cb.window.record(now, err != nil, slow)
+		stats := cb.window.stats(now)
+		if cb.exceedsThresholds(stats) {
+			cb.setState(StateOpen)
+			cb.logger.With(context.Background(),
+				"failure_rate", stats.failureRate(),
+				"slow_call_rate", stats.slowCallRate(),
+				"calls", stats.calls,
+			).Error("Circuit breaker opening due to failure or slow-call rate threshold")
+		}
+	}
+}
+
+// exceedsThresholds reports whether the sliding window holds enough calls and its failure or slow-call rate reaches a threshold
+func (cb *CircuitBreaker) exceedsThresholds(stats windowStats) bool {
+	if stats.calls < cb.config.MinimumCalls {
+		return false
+	}
+	if cb.config.FailureRateThreshold > 0 && stats.failureRate() >= cb.config.FailureRateThreshold {
+		return true
+	}
+	return cb.config.SlowCallRateThreshold > 0 && stats.slowCallRate() >= cb.config.SlowCallRateThreshold
 }
 
 // GetState returns the current state of the circuit breaker
@@ -172,10 +302,56 @@ func (cb *CircuitBreaker) GetStats() map[string]interface{} {
 	cb.mutex.RLock()
 	defer cb.mutex.RUnlock()
 
-	return map[string]interface{}{
-		"state":          cb.state.String(),
-		"failure_count":  cb.failureCount,
-		"request_count":  cb.requestCount,
-		"last_fail_time": cb.lastFailTime,
+	mode := cb.config.Mode
+	if mode == "" {
+		mode = ModeConsecutive
+	}
+	stats := map[string]interface{}{
+		"mode":            mode,
+		"state":           cb.state.String(),
+		"failure_count":   cb.failureCount,
+		"request_count":   cb.requestCount,
+		"half_open_calls": cb.halfOpenCalls,
+		"last_fail_time":  cb.lastFailTime,
+		"forced":          cb.forced,
 	}
+	if cb.window != nil {
+		window := cb.window.stats(time.Now())
+		stats["window_calls"] = window.calls
+		stats["failure_rate"] = window.failureRate()
+		stats["slow_call_rate"] = window.slowCallRate()
+	}
+	return stats
+}
+
+// Trip forces the circuit breaker open. It stays open, failing every call fast, until Reset is called.
+func (cb *CircuitBreaker) Trip() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.setState(StateOpen)
+	cb.forced = true
+	cb.logger.Info("Circuit breaker manually tripped to OPEN state")
+}
+
+// ForceClose forces the circuit breaker closed. Failures are still counted but do not open it until Reset is called.
+func (cb *CircuitBreaker) ForceClose() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.setState(StateClosed)
+	cb.forced = true
+	cb.logger.Info("Circuit breaker manually forced to CLOSED state")
+}
+
+// Reset returns the circuit breaker to normal operation in the CLOSED state and clears its counters.
+func (cb *CircuitBreaker) Reset() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.setState(StateClosed)
+	cb.forced = false
+	cb.failureCount = 0
+	cb.requestCount = 0
+	cb.logger.Info("Circuit breaker manually reset to CLOSED state")
 }
@@ -0,0 +1,73 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	logger, _ := log.NewForTest()
+	registry := NewRegistry()
+
+	b := registry.New("b", DefaultConfig(), logger)
+	a := New(DefaultConfig(), logger)
+	registry.Register("a", a)
+
+	assert.Equal(t, []string{"a", "b"}, registry.Names())
+	got, ok := registry.Get("b")
+	assert.True(t, ok)
+	assert.Same(t, b, got)
+	_, ok = registry.Get("missing")
+	assert.False(t, ok)
+
+	registry.Remove("b")
+	registry.Remove("missing")
+	assert.Equal(t, []string{"a"}, registry.Names())
+}
+
+func TestCircuitBreaker_Trip(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cb := New(Config{FailureThreshold: 3, RecoveryTimeout: time.Second, MinimumRequests: 1}, logger)
+	ctx := context.Background()
+
+	cb.Trip()
+	assert.Equal(t, StateOpen, cb.GetState())
+	assert.Equal(t, true, cb.GetStats()["forced"])
+
+	// a tripped breaker does not recover on its own
+	cb.openedAt = time.Now().Add(-time.Hour)
+	err := cb.Execute(ctx, func(ctx context.Context) error {
+		t.Fatal("This function should not be called when circuit is tripped")
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, StateOpen, cb.GetState())
+
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.GetState())
+	assert.NoError(t, cb.Execute(ctx, func(ctx context.Context) error { return nil }))
+}
+
+func TestCircuitBreaker_ForceClose(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cb := New(Config{FailureThreshold: 1, RecoveryTimeout: time.Second, MinimumRequests: 1}, logger)
+	ctx := context.Background()
+	testError := errors.New("test error")
+
+	cb.ForceClose()
+	for range 3 {
+		assert.Equal(t, testError, cb.Execute(ctx, func(ctx context.Context) error { return testError }))
+	}
+	assert.Equal(t, StateClosed, cb.GetState())
+	assert.Equal(t, 3, cb.GetStats()["failure_count"])
+
+	cb.Reset()
+	assert.Equal(t, 0, cb.GetStats()["failure_count"])
+	_ = cb.Execute(ctx, func(ctx context.Context) error { return testError })
+	assert.Equal(t, StateOpen, cb.GetState())
+}
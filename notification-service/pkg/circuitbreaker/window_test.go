@@ -0,0 +1,53 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountWindow(t *testing.T) {
+	w := newWindow(Config{Mode: ModeCount, WindowSize: 3})
+	now := time.Now()
+
+	w.record(now, true, false)
+	w.record(now, false, true)
+	assert.Equal(t, windowStats{calls: 2, failures: 1, slowCalls: 1}, w.stats(now))
+
+	// the oldest outcomes are evicted once the window is full
+	w.record(now, false, false)
+	w.record(now, false, false)
+	assert.Equal(t, windowStats{calls: 3, failures: 0, slowCalls: 1}, w.stats(now))
+	w.record(now, true, false)
+	assert.Equal(t, windowStats{calls: 3, failures: 1, slowCalls: 0}, w.stats(now))
+
+	w.reset()
+	assert.Equal(t, windowStats{}, w.stats(now))
+}
+
+func TestTimeWindow(t *testing.T) {
+	w := newWindow(Config{Mode: ModeTime, WindowDuration: 3 * time.Second})
+	start := time.Unix(1000, 0)
+
+	w.record(start, true, false)
+	w.record(start.Add(time.Second), false, true)
+	w.record(start.Add(2*time.Second), false, false)
+	assert.Equal(t, windowStats{calls: 3, failures: 1, slowCalls: 1}, w.stats(start.Add(2*time.Second)))
+
+	// calls older than the window duration are no longer counted
+	assert.Equal(t, windowStats{calls: 2, failures: 0, slowCalls: 1}, w.stats(start.Add(3*time.Second)))
+	w.record(start.Add(4*time.Second), true, false)
+	assert.Equal(t, windowStats{calls: 2, failures: 1, slowCalls: 0}, w.stats(start.Add(4*time.Second)))
+
+	w.reset()
+	assert.Equal(t, windowStats{}, w.stats(start.Add(4*time.Second)))
+}
+
+func TestWindowStats_Rates(t *testing.T) {
+	assert.Equal(t, 0.0, windowStats{}.failureRate())
+	assert.Equal(t, 0.0, windowStats{}.slowCallRate())
+	stats := windowStats{calls: 4, failures: 1, slowCalls: 3}
+	assert.Equal(t, 25.0, stats.failureRate())
+	assert.Equal(t, 75.0, stats.slowCallRate())
+}
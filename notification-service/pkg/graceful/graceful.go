@@ -0,0 +1,98 @@
+// Package graceful provides graceful shutdown of HTTP servers.
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Server wraps an http.Server and shuts it down gracefully when the process receives SIGINT or SIGTERM.
+type Server struct {
+	*http.Server
+	// Timeout bounds the time spent waiting for in-flight requests, and then again the time spent in the shutdown hooks.
+	Timeout time.Duration
+	// Delay is the time to wait between running the BeforeShutdown hooks and closing the listeners,
+	// which gives load balancers the chance to observe a failing readiness probe.
+	Delay time.Duration
+	// LogFunc logs the shutdown progress.
+	LogFunc func(format string, args ...interface{})
+
+	beforeShutdown []func()
+	onShutdown     []func(ctx context.Context)
+}
+
+// New creates a Server that gives in-flight requests the given timeout to complete during shutdown.
+func New(hs *http.Server, timeout time.Duration, logFunc func(format string, args ...interface{})) *Server {
+	return &Server{
+		Server:  hs,
+		Timeout: timeout,
+		LogFunc: logFunc,
+	}
+}
+
+// BeforeShutdown registers a function that is called as soon as shutdown starts, while the server still accepts requests.
+func (s *Server) BeforeShutdown(f func()) {
+	s.beforeShutdown = append(s.beforeShutdown, f)
+}
+
+// OnShutdown registers a function that is called after the server stopped serving requests,
+// typically to drain background work. Hooks are called in registration order and share a context with their own
+// Timeout, so that slow requests do not use up the time of the hooks.
+func (s *Server) OnShutdown(f func(ctx context.Context)) {
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// ListenAndServe starts the server and blocks until it has been shut down by a signal
+// and all shutdown hooks have returned.
+func (s *Server) ListenAndServe() error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-quit:
+		s.LogFunc("received signal %v, shutting down server...", sig)
+	}
+	return s.shutdown(errs)
+}
+
+// shutdown runs the shutdown sequence and waits for ListenAndServe to return.
+func (s *Server) shutdown(errs <-chan error) error {
+	for _, f := range s.beforeShutdown {
+		f()
+	}
+	if s.Delay > 0 {
+		time.Sleep(s.Delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	err := s.Server.Shutdown(ctx)
+	if serveErr := <-errs; serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) && err == nil {
+		err = serveErr
+	}
+
+	hookCtx, cancelHooks := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancelHooks()
+	for _, f := range s.onShutdown {
+		f(hookCtx)
+	}
+	if err != nil {
+		return err
+	}
+	s.LogFunc("server shut down gracefully")
+	return nil
+}
@@ -20,6 +20,8 @@ type Logger interface {
 	Debug(args ...interface{})
 	// Info uses fmt.Sprint to construct and log a message at INFO level
 	Info(args ...interface{})
+	// Warn uses fmt.Sprint to construct and log a message at WARN level
+	Warn(args ...interface{})
 	// Error uses fmt.Sprint to construct and log a message at ERROR level
 	Error(args ...interface{})
 
@@ -27,6 +29,8 @@ type Logger interface {
 	Debugf(format string, args ...interface{})
 	// Infof uses fmt.Sprintf to construct and log a message at INFO level
 	Infof(format string, args ...interface{})
+	// Warnf uses fmt.Sprintf to construct and log a message at WARN level
+	Warnf(format string, args ...interface{})
 	// Errorf uses fmt.Sprintf to construct and log a message at ERROR level
 	Errorf(format string, args ...interface{})
 }
@@ -42,6 +46,13 @@ const (
 	correlationIDKey
 )
 
+const (
+	// RequestIDHeader is the HTTP header that carries the request ID.
+	RequestIDHeader = "X-Request-ID"
+	// CorrelationIDHeader is the HTTP header that carries the correlation ID.
+	CorrelationIDHeader = "X-Correlation-ID"
+)
+
 // New creates a new logger using the default configuration.
 func New() Logger {
 	l, _ := zap.NewProduction()
@@ -82,24 +93,45 @@ func (l *logger) With(ctx context.Context, args ...interface{}) Logger {
 }
 
 // WithRequest returns a context which knows the request ID and correlation ID in the given request.
+//
+// If the request does not carry a correlation ID, the request ID is used as the correlation ID so that
+// every request starts a correlation that can be followed across service hops.
 func WithRequest(ctx context.Context, req *http.Request) context.Context {
 	id := getRequestID(req)
 	if id == "" {
 		id = uuid.New().String()
 	}
 	ctx = context.WithValue(ctx, requestIDKey, id)
-	if id := getCorrelationID(req); id != "" {
-		ctx = context.WithValue(ctx, correlationIDKey, id)
+	correlationID := getCorrelationID(req)
+	if correlationID == "" {
+		correlationID = id
 	}
-	return ctx
+	return WithCorrelationID(ctx, correlationID)
+}
+
+// WithCorrelationID returns a context which carries the given correlation ID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// RequestID returns the request ID recorded in the context, or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// CorrelationID returns the correlation ID recorded in the context, or an empty string if there is none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
 }
 
 // getCorrelationID extracts the correlation ID from the HTTP request
 func getCorrelationID(req *http.Request) string {
-	return req.Header.Get("X-Correlation-ID")
+	return req.Header.Get(CorrelationIDHeader)
 }
 
 // getRequestID extracts the request ID from the HTTP request
 func getRequestID(req *http.Request) string {
-	return req.Header.Get("X-Request-ID")
+	return req.Header.Get(RequestIDHeader)
 }
@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// ErrBudgetExhausted is returned by WithRetry when a failed attempt is not retried because the retry budget is exhausted.
+var ErrBudgetExhausted = errors.New("retry budget exhausted")
+
+// BudgetConfig defines the configuration of a retry budget.
+type BudgetConfig struct {
+	// Percent is the number of retries allowed as a percentage of the calls made. Zero disables the budget.
+	Percent float64 `yaml:"percent" json:"percent"`
+	// MinRetriesPerSecond allows a minimum rate of retries regardless of the call volume.
+	MinRetriesPerSecond float64 `yaml:"min_retries_per_second" json:"minRetriesPerSecond"`
+	// MaxTokens is the maximum number of retries that can be saved up. Defaults to 10.
+	MaxTokens float64 `yaml:"max_tokens" json:"maxTokens"`
+}
+
+// Validate validates the retry budget configuration
+func (c BudgetConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Percent, validation.Min(0.0), validation.Max(100.0)),
+		validation.Field(&c.MinRetriesPerSecond, validation.Min(0.0)),
+		validation.Field(&c.MaxTokens, validation.Min(0.0)),
+	)
+}
+
+// Budget caps retries at a percentage of recent calls so that retries do not amplify the load on a failing dependency.
+// Every call deposits Percent/100 tokens, every retry withdraws one token, and the bucket is refilled at
+// MinRetriesPerSecond and never holds more than MaxTokens. A Budget is safe for concurrent use and is meant
+// to be shared by all calls to the same dependency.
+type Budget struct {
+	config     BudgetConfig
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+// NewBudget creates a retry budget that starts with a full bucket.
+func NewBudget(config BudgetConfig) *Budget {
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = 10
+	}
+	return &Budget{
+		config:     config,
+		tokens:     config.MaxTokens,
+		lastRefill: time.Now(),
+	}
+}
+
+// deposit records a call.
+func (b *Budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens = min(b.tokens+b.config.Percent/100, b.config.MaxTokens)
+}
+
+// withdraw takes a token for a retry and reports whether the retry is allowed.
+func (b *Budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Tokens returns the number of retries currently available.
+func (b *Budget) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens
+}
+
+// refill adds the tokens accrued at MinRetriesPerSecond since the last refill. The caller must hold the mutex.
+func (b *Budget) refill() {
+	now := time.Now()
+	if b.config.MinRetriesPerSecond > 0 {
+		b.tokens = min(b.tokens+now.Sub(b.lastRefill).Seconds()*b.config.MinRetriesPerSecond, b.config.MaxTokens)
+	}
+	b.lastRefill = now
+}
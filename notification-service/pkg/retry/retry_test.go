@@ -367,3 +367,102 @@ func BenchmarkWithRetry_WithRetries(b *testing.B) {
 		_ = WithRetry(ctx, config, fn, nil, logger)
 	}
 }
+
+func TestWithRetry_DelayOverride(t *testing.T) {
+	logger, _ := log.NewForTest()
+
+	config := DefaultRetryConfig()
+	config.MaxAttempts = 3
+	config.InitialDelay = time.Millisecond
+	config.MaxDelay = 50 * time.Millisecond
+	config.Jitter = false
+
+	errRetryAfter := errors.New("retry after")
+	override := func(err error) (time.Duration, bool) {
+		if errors.Is(err, errRetryAfter) {
+			return time.Hour, true
+		}
+		return 0, false
+	}
+
+	var calls []time.Time
+	fn := func(ctx context.Context) error {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			return errRetryAfter
+		}
+		return errors.New("other error")
+	}
+
+	start := time.Now()
+	err := WithRetry(context.Background(), config, fn, nil, logger, WithDelayOverride(override))
+
+	assert.Error(t, err)
+	assert.Len(t, calls, 3)
+	// the requested delay is capped at MaxDelay
+	assert.GreaterOrEqual(t, calls[1].Sub(calls[0]), config.MaxDelay)
+	assert.Less(t, time.Since(start), time.Second)
+	// errors without a requested delay fall back to the computed backoff
+	assert.Less(t, calls[2].Sub(calls[1]), config.MaxDelay)
+}
+
+func TestWithRetry_Hooks(t *testing.T) {
+	logger, _ := log.NewForTest()
+
+	config := DefaultRetryConfig()
+	config.MaxAttempts = 3
+	config.InitialDelay = time.Millisecond
+
+	var retries []int
+	var succeeded, gaveUp int
+	hooks := Hooks{
+		OnRetry: func(ctx context.Context, attempt int, err error, delay time.Duration) {
+			retries = append(retries, attempt)
+		},
+		OnSuccess: func(ctx context.Context, attempts int) { succeeded = attempts },
+		OnGiveUp:  func(ctx context.Context, attempts int, err error) { gaveUp = attempts },
+	}
+
+	callCount := 0
+	err := WithRetry(context.Background(), config, func(ctx context.Context) error {
+		callCount++
+		if callCount < 3 {
+			return errors.New("temporary error")
+		}
+		return nil
+	}, nil, logger, WithHooks(hooks))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, retries)
+	assert.Equal(t, 3, succeeded)
+	assert.Equal(t, 0, gaveUp)
+
+	err = WithRetry(context.Background(), config, func(ctx context.Context) error {
+		return errors.New("permanent error")
+	}, func(error) bool { return false }, logger, WithHooks(hooks))
+	assert.Error(t, err)
+	assert.Equal(t, 1, gaveUp)
+}
+
+func TestWithRetryValue(t *testing.T) {
+	logger, _ := log.NewForTest()
+
+	config := DefaultRetryConfig()
+	config.InitialDelay = time.Millisecond
+
+	callCount := 0
+	value, err := WithRetryValue(context.Background(), config, func(ctx context.Context) (string, error) {
+		callCount++
+		if callCount < 2 {
+			return "partial", errors.New("temporary error")
+		}
+		return "done", nil
+	}, nil, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "done", value)
+
+	value, err = WithRetryValue(context.Background(), config, func(ctx context.Context) (string, error) {
+		return "partial", errors.New("permanent error")
+	}, func(error) bool { return false }, logger)
+	assert.Error(t, err)
+	assert.Empty(t, value)
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/berkaykrc/homerun-ratings-system/notification-service/pkg/tracing"
+
+// Handler returns a middleware that starts a server span for every HTTP request being processed.
+// The incoming traceparent/tracestate headers are honored so that the span joins the caller's trace.
+// Spans are named after the route template, e.g. "HTTP GET /api/notifications/<serviceProviderId>", so that the
+// requests of a route share a name.
+func Handler() routing.Handler {
+	tracer := Tracer(instrumentationName)
+	templates := &routeTemplates{}
+	return func(c *routing.Context) error {
+		name := "HTTP " + c.Request.Method
+		attributes := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.URLPath(c.Request.URL.Path),
+			semconv.UserAgentOriginal(c.Request.UserAgent()),
+		}
+		if route := templates.lookup(c); route != "" {
+			name += " " + route
+			attributes = append(attributes, semconv.HTTPRoute(route))
+		}
+
+		ctx := Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+		defer span.End()
+
+		rw := &access.LogResponseWriter{ResponseWriter: c.Response, Status: http.StatusOK}
+		c.Response = rw
+		c.Request = c.Request.WithContext(ctx)
+
+		err := c.Next()
+
+		// an error returned here is turned into a response by a middleware running before this one,
+		// so the response status is not written yet
+		status := rw.Status
+		if err != nil {
+			status = errorStatus(err)
+			span.RecordError(err)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
+
+// errorStatus returns the status code of the response to an error: the status code of errors which have one,
+// such as routing.HTTPError, and 500 otherwise.
+func errorStatus(err error) int {
+	var statusErr interface{ StatusCode() int }
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// routeTemplates caches the templates of the routes by the handlers the router finds for them, which are the same for
+// every request of a route, so that the routes are only scanned for the first request of a route instead of for every
+// request.
+type routeTemplates struct {
+	templates sync.Map // map[*routing.Handler]string
+}
+
+// lookup returns the template of the route matching the request, e.g. "/api/notifications/<serviceProviderId>", or ""
+// when no route matches.
+func (t *routeTemplates) lookup(c *routing.Context) string {
+	router := c.Router()
+	if router == nil {
+		return ""
+	}
+	handlers, params := router.Find(c.Request.Method, c.Request.URL.Path)
+	if len(handlers) == 0 {
+		return ""
+	}
+	if template, ok := t.templates.Load(&handlers[0]); ok {
+		return template.(string)
+	}
+
+	// requests without a route, which share the not found handlers, are cached with an empty template
+	template := ""
+	pairs := make([]interface{}, 0, 2*len(params))
+	for name, value := range params {
+		pairs = append(pairs, name, value)
+	}
+	for _, route := range router.Routes() {
+		if route.Method() != c.Request.Method {
+			continue
+		}
+		// the route's URL for the parameters of the request is the request path
+		if path, err := url.QueryUnescape(route.URL(pairs...)); err == nil && path == c.Request.URL.Path {
+			template = route.Path()
+			break
+		}
+	}
+	t.templates.Store(&handlers[0], template)
+	return template
+}
@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// setupRecorder installs a tracer provider that records finished spans in memory.
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"default", DefaultConfig(), false},
+		{"stdout", Config{Exporter: ExporterStdout, SampleRatio: 1}, false},
+		{"otlp without endpoint", Config{Exporter: ExporterOTLP, SampleRatio: 1}, true},
+		{"otlp with endpoint", Config{Exporter: ExporterOTLP, Endpoint: "localhost:4318", SampleRatio: 1}, false},
+		{"file without path", Config{Exporter: ExporterFile, SampleRatio: 1}, true},
+		{"unknown exporter", Config{Exporter: "zipkin", SampleRatio: 1}, true},
+		{"invalid sample ratio", Config{Exporter: ExporterNone, SampleRatio: 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterFile, FilePath: path, SampleRatio: 1}, "test-service", "1.0.0")
+	require.NoError(t, err)
+
+	_, span := Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "test-span")
+	assert.Contains(t, string(data), "test-service")
+}
+
+func TestInjectExtract(t *testing.T) {
+	setupRecorder(t)
+
+	ctx, span := Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+
+	header := http.Header{}
+	Inject(ctx, propagation.HeaderCarrier(header))
+	assert.NotEmpty(t, header.Get("traceparent"))
+
+	extracted := Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, child := Tracer("test").Start(extracted, "child")
+	assert.Equal(t, span.SpanContext().TraceID(), child.SpanContext().TraceID())
+	child.End()
+}
+
+func TestEnd(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	_, span := Tracer("test").Start(context.Background(), "failed")
+	End(span, errors.New("boom"))
+	_, span = Tracer("test").Start(context.Background(), "succeeded")
+	End(span, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestHandler(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	parentCtx, parent := Tracer("test").Start(context.Background(), "client")
+	parent.End()
+
+	router := routing.New()
+	router.Use(Handler())
+	router.Get("/api/notifications/<serviceProviderId>", func(c *routing.Context) error {
+		c.Response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/api/notifications/123", nil)
+	Inject(parentCtx, propagation.HeaderCarrier(req.Header))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	server := spans[1]
+	assert.Equal(t, "HTTP GET /api/notifications/<serviceProviderId>", server.Name())
+	assert.Contains(t, server.Attributes(), semconv.HTTPRoute("/api/notifications/<serviceProviderId>"))
+	assert.Equal(t, parent.SpanContext().TraceID(), server.SpanContext().TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), server.Parent().SpanID())
+	assert.Equal(t, codes.Error, server.Status().Code)
+}
+
+func TestRouteTemplates(t *testing.T) {
+	templates := &routeTemplates{}
+	var found []string
+	router := routing.New()
+	router.Use(func(c *routing.Context) error {
+		found = append(found, templates.lookup(c))
+		return nil
+	})
+	router.Get("/api/notifications/<serviceProviderId>", func(c *routing.Context) error { return nil })
+
+	for _, path := range []string{"/api/notifications/1", "/api/notifications/2", "/missing", "/other"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, []string{"/api/notifications/<serviceProviderId>", "/api/notifications/<serviceProviderId>", "", ""}, found)
+	count := 0
+	templates.templates.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, 2, count, "the templates are cached per route")
+}
+
+func TestHandler_ErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   codes.Code
+	}{
+		{"http error", routing.NewHTTPError(http.StatusNotFound), http.StatusNotFound, codes.Unset},
+		{"internal error", errors.New("boom"), http.StatusInternalServerError, codes.Error},
+		{"no error", nil, http.StatusOK, codes.Unset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := setupRecorder(t)
+
+			router := routing.New()
+			// the error is returned past the tracing middleware before any response is written
+			router.Use(func(c *routing.Context) error {
+				_ = c.Next()
+				return nil
+			}, Handler())
+			router.Post("/api/internal/notifications", func(c *routing.Context) error { return tt.err })
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/internal/notifications", nil))
+
+			spans := recorder.Ended()
+			require.Len(t, spans, 1)
+			assert.Equal(t, "HTTP POST /api/internal/notifications", spans[0].Name())
+			assert.Contains(t, spans[0].Attributes(), semconv.HTTPResponseStatusCode(tt.wantStatus))
+			assert.Equal(t, tt.wantCode, spans[0].Status().Code)
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/admin"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/config"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/customer"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/errors"
@@ -17,8 +18,11 @@ import (
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/rating"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/serviceprovider"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/accesslog"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/circuitbreaker"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/dbcontext"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/graceful"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/content"
@@ -43,6 +47,18 @@ func main() {
 		os.Exit(-1)
 	}
 
+	// set up distributed tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, "rating-service", Version)
+	if err != nil {
+		logger.Errorf("failed to set up tracing: %s", err)
+		os.Exit(-1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error(err)
+		}
+	}()
+
 	// connect to the database
 	db, err := dbx.MustOpen("postgres", cfg.DSN)
 	if err != nil {
@@ -57,46 +73,84 @@ func main() {
 		}
 	}()
 
+	dbCtx := dbcontext.New(db)
+
+	// every circuit breaker is registered by name so that it can be inspected and controlled through the admin API
+	breakers := circuitbreaker.NewRegistry()
+
+	// notifications are sent asynchronously by a bounded pool of workers
+	var spillStore notification.SpillStore
+	if cfg.NotificationService.Dispatcher.Overflow == notification.OverflowSpill {
+		spillStore = notification.NewSpillStore(dbCtx)
+	}
+	dispatcher := notification.NewDispatcher(
+		notification.NewHTTPClient(cfg.NotificationService, breakers, logger),
+		cfg.NotificationService.Dispatcher, spillStore, logger,
+	)
+
+	// readiness checks of the dependencies
+	checks := []healthcheck.Check{
+		healthcheck.PingCheck("database", db.DB(), 2*time.Second),
+		healthcheck.HTTPCheck("notification-service", cfg.NotificationService.BaseURL+"/livez", &http.Client{}, 2*time.Second),
+	}
+	if cb, ok := breakers.Get(notification.CircuitBreakerName); ok {
+		checks = append(checks, healthcheck.CircuitBreakerCheck("notification-circuit-breaker", cb))
+	}
+	checks = append(checks, healthcheck.Check{Name: "notification-queue", Run: dispatcher.Check})
+	health := healthcheck.New(Version, checks...)
+
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
+		Handler: buildHandler(cfg, logger, dbCtx, dispatcher, breakers, health),
 	}
 
-	// start the HTTP server with graceful shutdown
-	go routing.GracefulShutdown(hs, 10*time.Second, logger.Infof)
+	// start the HTTP server with graceful shutdown; readiness turns false as soon as shutdown starts
+	// and queued notifications are drained once the server no longer serves requests
+	server := graceful.New(hs, 30*time.Second, logger.Infof)
+	server.Delay = cfg.ShutdownDelay
+	server.BeforeShutdown(health.Shutdown)
+	server.OnShutdown(func(ctx context.Context) {
+		if err := dispatcher.Shutdown(ctx); err != nil {
+			logger.Error(err)
+		}
+	})
 	logger.Infof("server %v is running at %v", Version, address)
-	if err := hs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Error(err)
 		os.Exit(-1)
 	}
 }
 
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+func buildHandler(cfg *config.Config, logger log.Logger, db *dbcontext.DB, dispatcher *notification.Dispatcher, breakers *circuitbreaker.Registry, health *healthcheck.Health) http.Handler {
 	router := routing.New()
 
 	router.Use(
 		accesslog.Handler(logger),
+		tracing.Handler(),
 		errors.Handler(logger),
 		content.TypeNegotiator(content.JSON),
 		cors.Handler(cors.AllowAll),
 	)
 
-	healthcheck.RegisterHandlers(router, Version)
+	healthcheck.RegisterHandlers(router, health)
+	if cfg.AdminToken != "" {
+		adminGroup := router.Group("/admin")
+		admin.RegisterHandlers(adminGroup, breakers, cfg.AdminToken, logger)
+		notification.RegisterAdminHandlers(adminGroup, dispatcher)
+	}
 
 	rg := router.Group("/v1")
 
-	notificationClient := notification.NewHTTPClient(cfg.NotificationService, logger)
-
 	customerRepo := customer.NewRepository(db, logger)
 	serviceProviderRepo := serviceprovider.NewRepository(db, logger)
 	ratingRepo := rating.NewRepository(db, logger)
 
 	customerService := customer.NewService(customerRepo, logger)
 	serviceProviderService := serviceprovider.NewService(serviceProviderRepo, logger)
-	ratingService := rating.NewService(ratingRepo, customerService, serviceProviderService, notificationClient, logger)
+	ratingService := rating.NewService(ratingRepo, customerService, serviceProviderService, dispatcher, logger)
 
 	customer.RegisterHandlers(rg.Group(""), customerService, logger)
 	serviceprovider.RegisterHandlers(rg.Group(""), serviceProviderService, logger)
@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/test"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI(t *testing.T) {
+	logger, entries := log.NewForTest()
+	router := test.MockRouter(logger)
+	breakers := circuitbreaker.NewRegistry()
+	cb := breakers.New("notification-service", circuitbreaker.DefaultConfig(), logger)
+	RegisterHandlers(router.Group("/admin"), breakers, "secret", logger)
+
+	header := func(token, operator string) http.Header {
+		h := http.Header{}
+		if token != "" {
+			h.Set("Authorization", "Bearer "+token)
+		}
+		if operator != "" {
+			h.Set(OperatorHeader, operator)
+		}
+		return h
+	}
+
+	tests := []test.APITestCase{
+		{Name: "missing token", Method: "GET", URL: "/admin/circuit-breakers", Header: header("", "alice"), WantStatus: http.StatusUnauthorized},
+		{Name: "wrong token", Method: "GET", URL: "/admin/circuit-breakers", Header: header("wrong", "alice"), WantStatus: http.StatusUnauthorized},
+		{Name: "missing operator", Method: "GET", URL: "/admin/circuit-breakers", Header: header("secret", ""), WantStatus: http.StatusBadRequest},
+		{Name: "list", Method: "GET", URL: "/admin/circuit-breakers", Header: header("secret", "alice"), WantStatus: http.StatusOK, WantResponse: `*"name":"notification-service"*`},
+		{Name: "get unknown", Method: "GET", URL: "/admin/circuit-breakers/unknown", Header: header("secret", "alice"), WantStatus: http.StatusNotFound},
+		{Name: "trip", Method: "POST", URL: "/admin/circuit-breakers/notification-service/trip", Header: header("secret", "alice"), WantStatus: http.StatusOK, WantResponse: `*"state":"OPEN"*`},
+		{Name: "get tripped", Method: "GET", URL: "/admin/circuit-breakers/notification-service", Header: header("secret", "alice"), WantStatus: http.StatusOK, WantResponse: `*"forced":true*`},
+		{Name: "force-close", Method: "POST", URL: "/admin/circuit-breakers/notification-service/force-close", Header: header("secret", "alice"), WantStatus: http.StatusOK, WantResponse: `*"state":"CLOSED"*`},
+		{Name: "reset", Method: "POST", URL: "/admin/circuit-breakers/notification-service/reset", Header: header("secret", "alice"), WantStatus: http.StatusOK, WantResponse: `*"forced":false*`},
+		{Name: "reset unknown", Method: "POST", URL: "/admin/circuit-breakers/unknown/reset", Header: header("secret", "alice"), WantStatus: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+
+	assert.Equal(t, circuitbreaker.StateClosed, cb.GetState())
+	var actions []string
+	for _, entry := range entries.FilterMessage("Circuit breaker state changed by operator").All() {
+		assert.Equal(t, "alice", entry.ContextMap()["operator"])
+		actions = append(actions, entry.ContextMap()["action"].(string))
+	}
+	assert.Equal(t, []string{"trip", "force-close", "reset"}, actions)
+}
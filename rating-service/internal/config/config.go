@@ -2,9 +2,11 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/notification"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-env"
 	"gopkg.in/yaml.v2"
@@ -22,6 +24,12 @@ type Config struct {
 	DSN string `yaml:"dsn" env:"DSN,secret"`
 	// notification service configuration
 	NotificationService notification.Config `yaml:"notification_service" env:"NOTIFICATION_SERVICE"`
+	// distributed tracing configuration
+	Tracing tracing.Config `yaml:"tracing" env:"TRACING"`
+	// time to keep serving after readiness turns false on shutdown, so load balancers can drain the instance
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	// bearer token protecting the admin API. The admin API is disabled when empty.
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN,secret"`
 }
 
 // Validate validates the application configuration.
@@ -29,6 +37,7 @@ func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
 		validation.Field(&c.NotificationService, validation.Required),
+		validation.Field(&c.Tracing),
 	)
 }
 
@@ -37,6 +46,7 @@ func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
 		ServerPort: defaultServerPort,
+		Tracing:    tracing.DefaultConfig(),
 	}
 
 	// load from YAML config file
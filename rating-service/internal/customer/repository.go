@@ -6,6 +6,7 @@ import (
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/entity"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/dbcontext"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
 )
 
 // Repository encapsulates the logic to access customers from the data source.
@@ -18,6 +19,8 @@ type Repository interface {
 	Create(ctx context.Context, customer entity.Customer) error
 }
 
+var tracer = tracing.Tracer("github.com/berkaykrc/homerun-ratings-system/rating-service/internal/customer")
+
 // repository persists customers in database
 type repository struct {
 	db     *dbcontext.DB
@@ -31,19 +34,26 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 
 // Get reads the customer with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string) (entity.Customer, error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.Get")
 	var customer entity.Customer
 	err := r.db.With(ctx).Select().Model(id, &customer)
+	tracing.End(span, err)
 	return customer, err
 }
 
 // Create saves a new customer record in the database.
 func (r repository) Create(ctx context.Context, customer entity.Customer) error {
-	return r.db.With(ctx).Model(&customer).Insert()
+	ctx, span := tracer.Start(ctx, "customer.Repository.Create")
+	err := r.db.With(ctx).Model(&customer).Insert()
+	tracing.End(span, err)
+	return err
 }
 
 // Count returns the number of the customer records in the database.
 func (r repository) Count(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.Count")
 	var count int
 	err := r.db.With(ctx).Select("COUNT(*)").From("customers").Row(&count)
+	tracing.End(span, err)
 	return count, err
 }
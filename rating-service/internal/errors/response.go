@@ -45,6 +45,17 @@ func NotFound(msg string) ErrorResponse {
 	}
 }
 
+// Unauthorized creates a new error response representing an authentication failure (HTTP 401)
+func Unauthorized(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "You are not authenticated to perform the requested action."
+	}
+	return ErrorResponse{
+		Status:  http.StatusUnauthorized,
+		Message: msg,
+	}
+}
+
 // Forbidden creates a new error response representing an authorization failure (HTTP 403)
 func Forbidden(msg string) ErrorResponse {
 	if msg == "" {
@@ -67,6 +78,28 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// TooManyRequests creates a new error response representing a request rejected by a limit (HTTP 429)
+func TooManyRequests(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "You have sent too many requests."
+	}
+	return ErrorResponse{
+		Status:  http.StatusTooManyRequests,
+		Message: msg,
+	}
+}
+
+// ServiceUnavailable creates a new error response representing a temporarily unavailable service (HTTP 503)
+func ServiceUnavailable(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The service is temporarily unavailable."
+	}
+	return ErrorResponse{
+		Status:  http.StatusServiceUnavailable,
+		Message: msg,
+	}
+}
+
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
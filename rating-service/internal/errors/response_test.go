@@ -30,6 +30,14 @@ func TestInternalServerError(t *testing.T) {
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestUnauthorized(t *testing.T) {
+	res := Unauthorized("test")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = Unauthorized("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestNotFound(t *testing.T) {
 	res := NotFound("test")
 	assert.Equal(t, http.StatusNotFound, res.StatusCode())
@@ -54,6 +62,22 @@ func TestBadRequest(t *testing.T) {
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestTooManyRequests(t *testing.T) {
+	res := TooManyRequests("test")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = TooManyRequests("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestServiceUnavailable(t *testing.T) {
+	res := ServiceUnavailable("test")
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = ServiceUnavailable("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestInvalidInput(t *testing.T) {
 	err := InvalidInput(validation.Errors{
 		"xyz": fmt.Errorf("2"),
@@ -1,15 +1,39 @@
 package healthcheck
 
-import routing "github.com/go-ozzo/ozzo-routing/v2"
+import (
+	"strings"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
 
 // RegisterHandlers registers the handlers that perform healthchecks.
-func RegisterHandlers(r *routing.Router, version string) {
-	r.To("GET,HEAD", "/healthcheck", healthcheck(version))
+func RegisterHandlers(r *routing.Router, health *Health) {
+	r.To("GET,HEAD", "/healthcheck", healthcheck(health))
+	r.To("GET,HEAD", "/livez", livez(health))
+	r.To("GET,HEAD", "/readyz", readyz(health))
+}
+
+// healthcheck responds to a healthcheck request with the readiness status and the version, e.g. "OK 1.0.0" or
+// "FAIL 1.0.0" with 503 when a critical check failed. See readyz for the results of the checks.
+func healthcheck(health *Health) routing.Handler {
+	return func(c *routing.Context) error {
+		report := health.Ready(c.Request.Context())
+		return c.WriteWithStatus(strings.ToUpper(report.Status)+" "+report.Version, report.StatusCode())
+	}
+}
+
+// livez responds to a liveness probe.
+func livez(health *Health) routing.Handler {
+	return func(c *routing.Context) error {
+		report := health.Live()
+		return c.WriteWithStatus(report, report.StatusCode())
+	}
 }
 
-// healthcheck responds to a healthcheck request.
-func healthcheck(version string) routing.Handler {
+// readyz responds to a readiness probe with the result of every dependency check.
+func readyz(health *Health) routing.Handler {
 	return func(c *routing.Context) error {
-		return c.Write("OK " + version)
+		report := health.Ready(c.Request.Context())
+		return c.WriteWithStatus(report, report.StatusCode())
 	}
 }
@@ -1,6 +1,8 @@
 package healthcheck
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"testing"
 
@@ -11,7 +13,10 @@ import (
 func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
-	RegisterHandlers(router, "0.9.0")
+	health := New("0.9.0",
+		Check{Name: "database", Critical: true, Run: func(ctx context.Context) error { return nil }},
+	)
+	RegisterHandlers(router, health)
 	test.Endpoint(t, router, test.APITestCase{
 		Name:         "ok",
 		Method:       "GET",
@@ -21,4 +26,55 @@ func TestAPI(t *testing.T) {
 		WantStatus:   http.StatusOK,
 		WantResponse: `"OK 0.9.0"`,
 	})
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "livez",
+		Method:       "GET",
+		URL:          "/livez",
+		WantStatus:   http.StatusOK,
+		WantResponse: `*"version":"0.9.0"*`,
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "readyz",
+		Method:       "GET",
+		URL:          "/readyz",
+		WantStatus:   http.StatusOK,
+		WantResponse: `*"database":{"status":"ok"*`,
+	})
+
+	health.Shutdown()
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "readyz while shutting down",
+		Method:       "GET",
+		URL:          "/readyz",
+		WantStatus:   http.StatusServiceUnavailable,
+		WantResponse: `*"shuttingDown":true*`,
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		Name:       "livez while shutting down",
+		Method:     "GET",
+		URL:        "/livez",
+		WantStatus: http.StatusOK,
+	})
+}
+
+func TestAPI_ReadyzFailure(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	RegisterHandlers(router, New("0.9.0",
+		Check{Name: "database", Critical: true, Run: func(ctx context.Context) error { return errors.New("connection refused") }},
+	))
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "critical check failed",
+		Method:       "GET",
+		URL:          "/readyz",
+		WantStatus:   http.StatusServiceUnavailable,
+		WantResponse: `*connection refused*`,
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		Name:         "healthcheck with a failed critical check",
+		Method:       "GET",
+		URL:          "/healthcheck",
+		WantStatus:   http.StatusServiceUnavailable,
+		WantResponse: `"FAIL 0.9.0"`,
+	})
 }
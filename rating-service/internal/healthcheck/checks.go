@@ -0,0 +1,62 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/circuitbreaker"
+)
+
+// Pinger is implemented by database connections such as *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingCheck returns a critical check that pings a database connection.
+func PingCheck(name string, db Pinger, timeout time.Duration) Check {
+	return Check{
+		Name:     name,
+		Critical: true,
+		Timeout:  timeout,
+		Run:      db.PingContext,
+	}
+}
+
+// HTTPCheck returns a non-critical check that verifies a dependency answers GET requests on the given URL with a 2xx status.
+func HTTPCheck(name, url string, client *http.Client, timeout time.Duration) Check {
+	return Check{
+		Name:    name,
+		Timeout: timeout,
+		Run: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+			}
+			return nil
+		},
+	}
+}
+
+// CircuitBreakerCheck returns a non-critical check that fails while the given circuit breaker is open.
+func CircuitBreakerCheck(name string, cb *circuitbreaker.CircuitBreaker) Check {
+	return Check{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			stats := cb.GetStats()
+			if stats["state"] == circuitbreaker.StateOpen.String() {
+				return fmt.Errorf("circuit breaker is %v after %v failures", stats["state"], stats["failure_count"])
+			}
+			return nil
+		},
+	}
+}
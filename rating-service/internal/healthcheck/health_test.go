@@ -0,0 +1,79 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth_Ready(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	fail := func(ctx context.Context) error { return errors.New("down") }
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantStatus string
+	}{
+		{"no checks", nil, StatusOK},
+		{"all ok", []Check{{Name: "db", Critical: true, Run: ok}, {Name: "api", Run: ok}}, StatusOK},
+		{"non-critical failure", []Check{{Name: "db", Critical: true, Run: ok}, {Name: "api", Run: fail}}, StatusDegraded},
+		{"critical failure", []Check{{Name: "db", Critical: true, Run: fail}, {Name: "api", Run: fail}}, StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := New("1.0.0", tt.checks...).Ready(context.Background())
+			assert.Equal(t, tt.wantStatus, report.Status)
+			assert.Len(t, report.Checks, len(tt.checks))
+			assert.Equal(t, "1.0.0", report.Version)
+			assert.NotEmpty(t, report.Build.GoVersion)
+		})
+	}
+}
+
+func TestHealth_CheckTimeout(t *testing.T) {
+	health := New("1.0.0", Check{
+		Name:     "slow",
+		Critical: true,
+		Timeout:  10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	report := health.Ready(context.Background())
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+	assert.Equal(t, http.StatusServiceUnavailable, report.StatusCode())
+}
+
+func TestHTTPCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/livez" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	assert.NoError(t, HTTPCheck("up", server.URL+"/livez", server.Client(), time.Second).Run(context.Background()))
+	assert.Error(t, HTTPCheck("down", server.URL+"/other", server.Client(), time.Second).Run(context.Background()))
+}
+
+func TestCircuitBreakerCheck(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cb := circuitbreaker.New(circuitbreaker.Config{FailureThreshold: 1, RecoveryTimeout: time.Minute, MinimumRequests: 1}, logger)
+	check := CircuitBreakerCheck("breaker", cb)
+	assert.NoError(t, check.Run(context.Background()))
+
+	_ = cb.Execute(context.Background(), func(ctx context.Context) error { return errors.New("boom") })
+	assert.Error(t, check.Run(context.Background()))
+}
@@ -0,0 +1,10 @@
+package notification
+
+import routing "github.com/go-ozzo/ozzo-routing/v2"
+
+// RegisterAdminHandlers registers the handlers that expose the state of the dispatcher on the admin route group.
+func RegisterAdminHandlers(r *routing.RouteGroup, dispatcher *Dispatcher) {
+	r.Get("/notification-dispatcher", func(c *routing.Context) error {
+		return c.Write(dispatcher.Stats())
+	})
+}
@@ -0,0 +1,28 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := routing.New()
+	router.Use(content.TypeNegotiator(content.JSON))
+	d := NewDispatcher(newFakeClient(false), DispatcherConfig{Workers: 1, QueueSize: 5}, nil, logger)
+	defer func() { require.NoError(t, d.Shutdown(context.Background())) }()
+	RegisterAdminHandlers(router.Group("/admin"), d)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/admin/notification-dispatcher", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), `"queueCapacity":5`)
+}
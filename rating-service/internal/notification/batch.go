@@ -0,0 +1,227 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/retry"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxBatchSize is the maximum number of notifications the notification service accepts in a single batch request.
+const maxBatchSize = 100
+
+// BatchConfig configures the coalescing of notifications into batch requests.
+type BatchConfig struct {
+	Enabled bool          `yaml:"enabled" json:"enabled"`
+	MaxSize int           `yaml:"max_size" json:"maxSize"`
+	Linger  time.Duration `yaml:"linger" json:"linger"`
+}
+
+// Validate validates the batch configuration.
+func (c BatchConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.MaxSize, validation.Min(0), validation.Max(maxBatchSize)),
+		validation.Field(&c.Linger, validation.Min(time.Duration(0))),
+	)
+}
+
+// batchRequest is the payload of POST /api/internal/notifications/batch.
+type batchRequest struct {
+	Notifications []RatingNotification `json:"notifications"`
+}
+
+// batchItemResult is the outcome of a single notification of a batch request.
+type batchItemResult struct {
+	Index   int    `json:"index"`
+	Status  int    `json:"status"`
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// batchResponse is the response of POST /api/internal/notifications/batch.
+type batchResponse struct {
+	Results []batchItemResult `json:"results"`
+}
+
+// sendBatch sends the notifications in a single batch request with retry and circuit breaker
+// and returns the error of each notification. The notifications the notification service failed with a
+// retryable status, such as 429 or 503, are sent again in the next attempt.
+func (c *httpClient) sendBatch(ctx context.Context, notifications []RatingNotification) []error {
+	errs := make([]error, len(notifications))
+	// the indexes of the notifications which were neither accepted nor rejected for good yet
+	remaining := make([]int, len(notifications))
+	for i := range remaining {
+		remaining[i] = i
+	}
+
+	err := c.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
+		return retry.WithRetry(ctx, c.retryConfig, func(ctx context.Context) error {
+			batch := make([]RatingNotification, len(remaining))
+			for i, index := range remaining {
+				batch[i] = notifications[index]
+			}
+			var resp batchResponse
+			if err := c.post(ctx, "notification.send_batch", "/api/internal/notifications/batch", batchRequest{batch}, &resp); err != nil {
+				for _, index := range remaining {
+					errs[index] = err
+				}
+				return err
+			}
+
+			results := make([]error, len(batch))
+			for i := range results {
+				results[i] = errors.New("notification service returned no result for the notification")
+			}
+			for _, result := range resp.Results {
+				if result.Index < 0 || result.Index >= len(results) {
+					continue
+				}
+				if result.Status < 200 || result.Status >= 300 {
+					results[result.Index] = fmt.Errorf("%s: %w", result.Message, &StatusError{StatusCode: result.Status})
+				} else {
+					results[result.Index] = nil
+				}
+			}
+
+			var retryable []int
+			var retryErr error
+			for i, index := range remaining {
+				errs[index] = results[i]
+				if c.isRetryableError(results[i]) {
+					retryable = append(retryable, index)
+					retryErr = results[i]
+				}
+			}
+			remaining = retryable
+			return retryErr
+		}, c.isRetryableError, c.logger, c.retryOptions()...)
+	})
+	if err != nil {
+		// the circuit breaker or the context may fail the call before the notifications were sent
+		for _, index := range remaining {
+			if errs[index] == nil {
+				errs[index] = err
+			}
+		}
+	}
+	return errs
+}
+
+// pendingNotification is a notification waiting to be sent with the next batch.
+type pendingNotification struct {
+	ctx          context.Context
+	notification RatingNotification
+	done         chan error
+}
+
+// batchingClient coalesces concurrent notifications into batch requests. A batch is sent as soon as it holds
+// MaxSize notifications or Linger after its first notification was added, whichever comes first. The Dispatcher
+// collects the batches from its queue instead, see batcher.
+type batchingClient struct {
+	client  *httpClient
+	config  BatchConfig
+	mu      sync.Mutex
+	pending []pendingNotification
+	timer   *time.Timer
+}
+
+// newBatchingClient creates a client that sends notifications in batches through the given HTTP client.
+func newBatchingClient(client *httpClient, config BatchConfig) *batchingClient {
+	if config.MaxSize <= 0 {
+		config.MaxSize = 50
+	}
+	if config.Linger <= 0 {
+		config.Linger = 50 * time.Millisecond
+	}
+	return &batchingClient{client: client, config: config}
+}
+
+// SendRatingNotification adds the notification to the current batch and waits until the batch was sent.
+func (b *batchingClient) SendRatingNotification(ctx context.Context, notification RatingNotification) error {
+	item := pendingNotification{ctx: ctx, notification: notification, done: make(chan error, 1)}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, item)
+	if len(b.pending) >= b.config.MaxSize {
+		batch := b.take()
+		b.mu.Unlock()
+		b.send(batch)
+	} else {
+		if len(b.pending) == 1 {
+			b.timer = time.AfterFunc(b.config.Linger, b.flush)
+		}
+		b.mu.Unlock()
+	}
+
+	select {
+	case err := <-item.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// batchConfig returns the batch configuration with its defaults.
+func (b *batchingClient) batchConfig() BatchConfig {
+	return b.config
+}
+
+// sendBatch sends the notifications in a single batch request and returns the error of each notification.
+func (b *batchingClient) sendBatch(ctx context.Context, notifications []RatingNotification) []error {
+	return b.client.sendBatch(ctx, notifications)
+}
+
+// take removes and returns the pending notifications. The caller must hold the mutex.
+func (b *batchingClient) take() []pendingNotification {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// flush sends the pending notifications once the linger time has passed.
+func (b *batchingClient) flush() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	if len(batch) > 0 {
+		b.send(batch)
+	}
+}
+
+// send sends a batch and reports the outcome to every waiting caller. The request carries the values,
+// such as the request ID and the trace context, of the first notification in the batch, and is cancelled once
+// every caller stopped waiting for it.
+func (b *batchingClient) send(batch []pendingNotification) {
+	notifications := make([]RatingNotification, len(batch))
+	for i, item := range batch {
+		notifications[i] = item.notification
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(batch[0].ctx))
+	defer cancel()
+	var waiting atomic.Int64
+	waiting.Store(int64(len(batch)))
+	for _, item := range batch {
+		stop := context.AfterFunc(item.ctx, func() {
+			if waiting.Add(-1) == 0 {
+				cancel()
+			}
+		})
+		defer stop()
+	}
+	trace.SpanFromContext(ctx).AddEvent("notification.batch", trace.WithAttributes(attribute.Int("notification.batch_size", len(batch))))
+	for i, err := range b.client.sendBatch(ctx, notifications) {
+		batch[i].done <- err
+	}
+}
@@ -0,0 +1,278 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBatchServer returns a server that accepts batch requests, records their sizes
+// and rejects notifications of the given rating ID with 400.
+func newBatchServer(t *testing.T, rejectRatingID string) (*httptest.Server, *[]int, *sync.Mutex) {
+	var (
+		mu    sync.Mutex
+		sizes []int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/internal/notifications/batch", r.URL.Path)
+		var req batchRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		mu.Lock()
+		sizes = append(sizes, len(req.Notifications))
+		mu.Unlock()
+
+		var resp batchResponse
+		for i, n := range req.Notifications {
+			if n.RatingID == rejectRatingID {
+				resp.Results = append(resp.Results, batchItemResult{Index: i, Status: http.StatusBadRequest, Message: "invalid input"})
+				continue
+			}
+			resp.Results = append(resp.Results, batchItemResult{Index: i, Status: http.StatusCreated, ID: n.RatingID})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server, &sizes, &mu
+}
+
+func TestBatchingClient_FlushesWhenFull(t *testing.T) {
+	server, sizes, mu := newBatchServer(t, "")
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL: server.URL,
+		Timeout: time.Second,
+		Batch:   BatchConfig{Enabled: true, MaxSize: 3, Linger: time.Minute},
+	}, circuitbreaker.NewRegistry(), logger)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp-1", RatingID: "r"}))
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{3}, *sizes)
+}
+
+func TestBatchingClient_FlushesAfterLinger(t *testing.T) {
+	server, sizes, mu := newBatchServer(t, "")
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL: server.URL,
+		Timeout: time.Second,
+		Batch:   BatchConfig{Enabled: true, MaxSize: 10, Linger: 20 * time.Millisecond},
+	}, circuitbreaker.NewRegistry(), logger)
+
+	start := time.Now()
+	err := client.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp-1", RatingID: "r"})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{1}, *sizes)
+}
+
+func TestBatchingClient_ReportsItemErrors(t *testing.T) {
+	server, _, _ := newBatchServer(t, "bad")
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL: server.URL,
+		Timeout: time.Second,
+		Batch:   BatchConfig{Enabled: true, MaxSize: 2, Linger: time.Minute},
+	}, circuitbreaker.NewRegistry(), logger)
+
+	var (
+		wg       sync.WaitGroup
+		failures atomic.Int32
+	)
+	for _, id := range []string{"good", "bad"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			err := client.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp-1", RatingID: id})
+			if id == "bad" {
+				var statusErr *StatusError
+				if assert.ErrorAs(t, err, &statusErr) {
+					assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+				}
+				failures.Add(1)
+			} else {
+				assert.NoError(t, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), failures.Load())
+}
+
+func TestBatchingClient_RetriesItemErrors(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		defer mu.Unlock()
+		var ids []string
+		var resp batchResponse
+		for i, n := range req.Notifications {
+			ids = append(ids, n.RatingID)
+			switch {
+			case n.RatingID == "bad":
+				resp.Results = append(resp.Results, batchItemResult{Index: i, Status: http.StatusBadRequest, Message: "invalid input"})
+			case n.RatingID == "busy" && len(batches) == 0:
+				resp.Results = append(resp.Results, batchItemResult{Index: i, Status: http.StatusServiceUnavailable, Message: "storage unavailable"})
+			default:
+				resp.Results = append(resp.Results, batchItemResult{Index: i, Status: http.StatusCreated, ID: n.RatingID})
+			}
+		}
+		batches = append(batches, ids)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL:     server.URL,
+		Timeout:     time.Second,
+		RetryConfig: retry.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, BackoffFactor: 2},
+		Batch:       BatchConfig{Enabled: true, MaxSize: 3, Linger: time.Minute},
+	}, circuitbreaker.NewRegistry(), logger)
+
+	var wg sync.WaitGroup
+	errs := map[string]error{}
+	var errsMu sync.Mutex
+	for _, id := range []string{"good", "busy", "bad"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := client.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp-1", RatingID: id})
+			errsMu.Lock()
+			errs[id] = err
+			errsMu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.NoError(t, errs["good"])
+	assert.NoError(t, errs["busy"], "notifications failed with a retryable status are sent again")
+	var statusErr *StatusError
+	if assert.ErrorAs(t, errs["bad"], &statusErr) {
+		assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, batches, 2)
+	assert.Equal(t, []string{"busy"}, batches[1], "only the retryable notifications are sent again")
+}
+
+func TestDispatcher_FillsBatches(t *testing.T) {
+	server, sizes, mu := newBatchServer(t, "")
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL: server.URL,
+		Timeout: time.Second,
+		Batch:   BatchConfig{Enabled: true, MaxSize: 10, Linger: time.Minute},
+	}, circuitbreaker.NewRegistry(), logger)
+	d := NewDispatcher(client, DispatcherConfig{Workers: 2, QueueSize: 100}, nil, logger)
+	assert.Equal(t, 2, d.Stats().Workers, "the workers do not depend on the batch size")
+
+	for range 20 {
+		require.NoError(t, d.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp-1", RatingID: "r"}))
+	}
+	require.NoError(t, d.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{10, 10}, *sizes, "the batches are not limited by the number of workers")
+}
+
+func TestDispatcher_AbortsBatches(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL: server.URL,
+		Timeout: time.Minute,
+		Batch:   BatchConfig{Enabled: true, MaxSize: 10, Linger: time.Millisecond},
+	}, circuitbreaker.NewRegistry(), logger)
+	d := NewDispatcher(client, DispatcherConfig{Workers: 1, SendTimeout: time.Minute}, nil, logger)
+
+	require.NoError(t, d.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp-1", RatingID: "r"}))
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, d.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second, "the batch in flight is cancelled")
+	assert.Equal(t, uint64(1), d.Stats().Failed)
+}
+
+func TestBatchingClient_ContextCanceled(t *testing.T) {
+	server, _, _ := newBatchServer(t, "")
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL: server.URL,
+		Timeout: time.Second,
+		Batch:   BatchConfig{Enabled: true, MaxSize: 10, Linger: time.Minute},
+	}, circuitbreaker.NewRegistry(), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := client.SendRatingNotification(ctx, RatingNotification{ServiceProviderID: "sp-1", RatingID: "r"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBatchingClient_CancelsAbandonedBatches(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{
+		BaseURL: server.URL,
+		Timeout: time.Minute,
+		Batch:   BatchConfig{Enabled: true, MaxSize: 1},
+	}, circuitbreaker.NewRegistry(), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, client.SendRatingNotification(ctx, RatingNotification{ServiceProviderID: "sp-1", RatingID: "r"}))
+	assert.Less(t, time.Since(start), 5*time.Second, "a batch nobody waits for is cancelled")
+}
+
+func TestBatchConfig_Validate(t *testing.T) {
+	assert.NoError(t, BatchConfig{Enabled: true, MaxSize: 100}.Validate())
+	assert.Error(t, BatchConfig{Enabled: true, MaxSize: 101}.Validate())
+	assert.Error(t, BatchConfig{Linger: -time.Second}.Validate())
+}
@@ -4,30 +4,44 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/circuitbreaker"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/retry"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("github.com/berkaykrc/homerun-ratings-system/rating-service/internal/notification")
+
 // Client interface for notification service communication
 type Client interface {
 	SendRatingNotification(ctx context.Context, notification RatingNotification) error
 }
 
-// RatingNotification represents the notification payload sent to the notification service
+// EventRatingCreated is the event type of a notification about a new rating
+const EventRatingCreated = "rating.created"
+
+// RatingNotification represents the notification payload sent to the notification service.
+// The notification service creates at most one notification per service provider, rating ID and event type,
+// so a notification can be sent again safely. The service provider email is where email notifications are sent.
 type RatingNotification struct {
-	ServiceProviderID string `json:"serviceProviderId"`
-	RatingID          string `json:"ratingId"`
-	Rating            int    `json:"rating"`
-	CustomerName      string `json:"customerName"`
-	Comment           string `json:"comment"`
+	ServiceProviderID    string `json:"serviceProviderId"`
+	ServiceProviderEmail string `json:"serviceProviderEmail,omitempty"`
+	RatingID             string `json:"ratingId"`
+	Type                 string `json:"type"`
+	Rating               int    `json:"rating"`
+	CustomerName         string `json:"customerName"`
+	Comment              string `json:"comment"`
 }
 
 // Config represents notification service configuration
@@ -36,6 +50,8 @@ type Config struct {
 	Timeout       time.Duration         `yaml:"timeout" json:"timeout"`
 	RetryConfig   retry.RetryConfig     `yaml:"retry" json:"retry"`
 	CircuitConfig circuitbreaker.Config `yaml:"circuit_breaker" json:"circuitBreaker"`
+	Dispatcher    DispatcherConfig      `yaml:"dispatcher" json:"dispatcher"`
+	Batch         BatchConfig           `yaml:"batch" json:"batch"`
 }
 
 // Validate validates the notification service configuration
@@ -43,6 +59,8 @@ func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.BaseURL, validation.Required, is.URL),
 		validation.Field(&c.Timeout, validation.Required),
+		validation.Field(&c.Dispatcher),
+		validation.Field(&c.Batch),
 	)
 }
 
@@ -52,11 +70,16 @@ type httpClient struct {
 	baseURL        string
 	logger         log.Logger
 	retryConfig    retry.RetryConfig
+	retryBudget    *retry.Budget
 	circuitBreaker *circuitbreaker.CircuitBreaker
 }
 
-// NewHTTPClient creates a new HTTP-based notification client
-func NewHTTPClient(config Config, logger log.Logger) Client {
+// CircuitBreakerName is the name under which the client registers its circuit breaker.
+const CircuitBreakerName = "notification-service"
+
+// NewHTTPClient creates a new HTTP-based notification client and registers its circuit breaker with the given registry.
+// When batching is enabled, concurrent notifications are coalesced into batch requests.
+func NewHTTPClient(config Config, breakers *circuitbreaker.Registry, logger log.Logger) Client {
 	timeout := config.Timeout
 	if timeout == 0 {
 		timeout = 10 * time.Second
@@ -68,19 +91,24 @@ func NewHTTPClient(config Config, logger log.Logger) Client {
 	}
 
 	circuitConfig := config.CircuitConfig
-	if circuitConfig.FailureThreshold == 0 {
+	if circuitConfig == (circuitbreaker.Config{}) {
 		circuitConfig = circuitbreaker.DefaultConfig()
 	}
 
-	return &httpClient{
+	client := &httpClient{
 		client: &http.Client{
 			Timeout: timeout,
 		},
 		baseURL:        config.BaseURL,
 		logger:         logger,
 		retryConfig:    retryConfig,
-		circuitBreaker: circuitbreaker.New(circuitConfig, logger),
+		retryBudget:    newRetryBudget(retryConfig.Budget),
+		circuitBreaker: breakers.New(CircuitBreakerName, circuitConfig, logger),
+	}
+	if config.Batch.Enabled {
+		return newBatchingClient(client, config.Batch)
 	}
+	return client
 }
 
 // SendRatingNotification sends a rating notification using HTTP with retry and circuit breaker
@@ -90,17 +118,48 @@ func (c *httpClient) SendRatingNotification(ctx context.Context, notification Ra
 		// Use retry mechanism
 		return retry.WithRetry(ctx, c.retryConfig, func(ctx context.Context) error {
 			return c.sendHTTPNotification(ctx, notification)
-		}, c.isRetryableError, c.logger)
+		}, c.isRetryableError, c.logger, c.retryOptions()...)
 	})
 }
 
+// newRetryBudget creates the retry budget shared by all notification calls, or nil when no budget is configured.
+func newRetryBudget(config retry.BudgetConfig) *retry.Budget {
+	if config.Percent == 0 && config.MinRetriesPerSecond == 0 {
+		return nil
+	}
+	return retry.NewBudget(config)
+}
+
+// retryOptions returns the options applied to every notification call.
+func (c *httpClient) retryOptions() []retry.Option {
+	opts := []retry.Option{retry.WithDelayOverride(c.retryAfter)}
+	if c.retryBudget != nil {
+		opts = append(opts, retry.WithBudget(c.retryBudget))
+	}
+	return opts
+}
+
 // sendHTTPNotification performs the actual HTTP request
 func (c *httpClient) sendHTTPNotification(ctx context.Context, notification RatingNotification) error {
+	return c.post(ctx, "notification.send", "/api/internal/notifications", notification, nil)
+}
+
+// post sends the payload as JSON to the given path of the notification service and decodes the response into result unless it is nil
+func (c *httpClient) post(ctx context.Context, spanName, path string, payload, result interface{}) (err error) {
 	// Build the notification service endpoint
-	url := fmt.Sprintf("%s/api/internal/notifications", c.baseURL)
+	url := c.baseURL + path
+
+	ctx, span := tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("POST"),
+			semconv.URLFull(url),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
 
 	// Convert domain model to JSON
-	jsonData, err := json.Marshal(notification)
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		c.logger.With(ctx, "error", err).Error("Failed to marshal notification")
 		return fmt.Errorf("failed to marshal notification: %w", err)
@@ -117,6 +176,17 @@ func (c *httpClient) sendHTTPNotification(ctx context.Context, notification Rati
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "rating-service/1.0")
 
+	// Forward the request and correlation IDs so that both services log under the same correlation
+	if id := log.RequestID(ctx); id != "" {
+		req.Header.Set(log.RequestIDHeader, id)
+	}
+	if id := log.CorrelationID(ctx); id != "" {
+		req.Header.Set(log.CorrelationIDHeader, id)
+	}
+
+	// Propagate the W3C trace context (traceparent/tracestate) to the notification service
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
 	// Log the outgoing request
 	c.logger.With(ctx, "url", url, "method", "POST").Info("Sending rating notification")
 
@@ -129,11 +199,19 @@ func (c *httpClient) sendHTTPNotification(ctx context.Context, notification Rati
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
-	// Check HTTP status code
+	// Check HTTP status code; a notification that was already created is acknowledged with 200 instead of 201
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		c.logger.With(ctx, "status_code", resp.StatusCode, "url", url).Error("Notification service returned error")
-		return fmt.Errorf("notification service returned status %d", resp.StatusCode)
+		return &StatusError{StatusCode: resp.StatusCode, Header: resp.Header}
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			c.logger.With(ctx, "error", err, "url", url).Error("Failed to decode notification service response")
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
 	}
 
 	c.logger.With(ctx, "status_code", resp.StatusCode).Info("Successfully sent rating notification")
@@ -146,28 +224,32 @@ func (c *httpClient) isRetryableError(err error) bool {
 		return false
 	}
 
-	errorStr := err.Error()
+	// Retry on 408, 429 and 5xx HTTP status codes, but not on other client errors
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
 
-	// Retry on network errors
-	if strings.Contains(errorStr, "connection refused") ||
-		strings.Contains(errorStr, "timeout") ||
-		strings.Contains(errorStr, "context deadline exceeded") ||
-		strings.Contains(errorStr, "no such host") {
-		return true
+	// Don't retry when the caller gave up
+	if errors.Is(err, context.Canceled) {
+		return false
 	}
 
-	// Retry on 5xx HTTP status codes
-	if strings.Contains(errorStr, "status 5") {
+	// Retry on timeouts and network errors such as refused connections or DNS failures
+	if errors.Is(err, context.DeadlineExceeded) {
 		return true
 	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
 
-	// Don't retry on 4xx status codes (client errors)
-	if strings.Contains(errorStr, "status 4") {
-		return false
+// retryAfter returns the delay the notification service requested with a Retry-After header
+func (c *httpClient) retryAfter(err error) (time.Duration, bool) {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return 0, false
 	}
-
-	// By default, retry other errors
-	return true
+	return statusErr.RetryAfter(time.Now())
 }
 
 // mockClient is a test implementation of Client interface
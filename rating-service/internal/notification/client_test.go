@@ -0,0 +1,166 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/circuitbreaker"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestHTTPClient_PropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{BaseURL: server.URL, Timeout: time.Second}, circuitbreaker.NewRegistry(), logger)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "rating.create")
+	err := client.SendRatingNotification(ctx, RatingNotification{ServiceProviderID: "sp", RatingID: "r", Rating: 5})
+	parent.End()
+	require.NoError(t, err)
+
+	require.NotEmpty(t, traceparent)
+	assert.Contains(t, traceparent, parent.SpanContext().TraceID().String())
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+		names = append(names, span.Name())
+	}
+	assert.Contains(t, names, "notification.send")
+	assert.Contains(t, names, "retry.attempt")
+	assert.Contains(t, names, "circuit_breaker.execute")
+}
+
+func TestHTTPClient_ForwardsRequestAndCorrelationIDs(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{BaseURL: server.URL, Timeout: time.Second}, circuitbreaker.NewRegistry(), logger)
+
+	req, _ := http.NewRequest("POST", "/v1/ratings", nil)
+	req.Header.Set(log.RequestIDHeader, "req-1")
+	req.Header.Set(log.CorrelationIDHeader, "corr-1")
+	ctx := context.WithoutCancel(log.WithRequest(context.Background(), req))
+
+	err := client.SendRatingNotification(ctx, RatingNotification{ServiceProviderID: "sp", RatingID: "r", Rating: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", header.Get(log.RequestIDHeader))
+	assert.Equal(t, "corr-1", header.Get(log.CorrelationIDHeader))
+}
+
+func TestHTTPClient_isRetryableError(t *testing.T) {
+	c := &httpClient{}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"server error", &StatusError{StatusCode: http.StatusBadGateway}, true},
+		{"too many requests", fmt.Errorf("wrapped: %w", &StatusError{StatusCode: http.StatusTooManyRequests}), true},
+		{"bad request", &StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"network error", &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{"deadline exceeded", fmt.Errorf("failed to send notification: %w", context.DeadlineExceeded), true},
+		{"canceled", &url.Error{Op: "Post", URL: "http://localhost", Err: context.Canceled}, false},
+		{"other error", errors.New("failed to marshal notification"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, c.isRetryableError(tt.err))
+		})
+	}
+}
+
+func TestHTTPClient_HonorsRetryAfter(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	logger, _ := log.NewForTest()
+	retryConfig := retry.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 100 * time.Millisecond, BackoffFactor: 2}
+	client := NewHTTPClient(Config{BaseURL: server.URL, Timeout: time.Second, RetryConfig: retryConfig}, circuitbreaker.NewRegistry(), logger)
+
+	start := time.Now()
+	err := client.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp", RatingID: "r", Rating: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	// the requested second is capped at MaxDelay
+	assert.GreaterOrEqual(t, time.Since(start), retryConfig.MaxDelay)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestHTTPClient_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{BaseURL: server.URL, Timeout: time.Second}, circuitbreaker.NewRegistry(), logger)
+
+	err := client.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp", RatingID: "r", Rating: 5})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	assert.Equal(t, 1, calls)
+}
+
+func TestHTTPClient_TreatsReplayAsSuccess(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// the notification service acknowledges a notification it already created with 200
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"id":"original","message":"Notification already exists","duplicate":true}`))
+	}))
+	defer server.Close()
+
+	logger, _ := log.NewForTest()
+	client := NewHTTPClient(Config{BaseURL: server.URL, Timeout: time.Second}, circuitbreaker.NewRegistry(), logger)
+
+	err := client.SendRatingNotification(context.Background(), RatingNotification{ServiceProviderID: "sp", RatingID: "r", Type: EventRatingCreated, Rating: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,442 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// OverflowBlock makes SendRatingNotification wait for room in the queue. This is the default policy.
+	OverflowBlock = "block"
+	// OverflowDropOldest discards the oldest queued notification to make room for the new one.
+	OverflowDropOldest = "drop_oldest"
+	// OverflowSpill stores notifications that do not fit in the queue in a SpillStore and re-enqueues them later.
+	OverflowSpill = "spill"
+)
+
+// ErrDispatcherClosed is returned when a notification is submitted after the dispatcher was shut down.
+var ErrDispatcherClosed = errors.New("notification dispatcher is closed")
+
+// DispatcherConfig represents the configuration of the asynchronous notification dispatcher.
+type DispatcherConfig struct {
+	Workers       int           `yaml:"workers" json:"workers"`
+	QueueSize     int           `yaml:"queue_size" json:"queueSize"`
+	Overflow      string        `yaml:"overflow" json:"overflow"`
+	SendTimeout   time.Duration `yaml:"send_timeout" json:"sendTimeout"`
+	SpillInterval time.Duration `yaml:"spill_interval" json:"spillInterval"`
+}
+
+// DefaultDispatcherConfig returns the default dispatcher configuration.
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		Workers:       4,
+		QueueSize:     1000,
+		Overflow:      OverflowBlock,
+		SendTimeout:   60 * time.Second,
+		SpillInterval: 5 * time.Second,
+	}
+}
+
+// Validate validates the dispatcher configuration.
+func (c DispatcherConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Workers, validation.Min(0)),
+		validation.Field(&c.QueueSize, validation.Min(0)),
+		validation.Field(&c.Overflow, validation.In(OverflowBlock, OverflowDropOldest, OverflowSpill)),
+	)
+}
+
+// DispatcherStats describes the state of the dispatcher queue.
+type DispatcherStats struct {
+	QueueDepth    int    `json:"queueDepth"`
+	QueueCapacity int    `json:"queueCapacity"`
+	Workers       int    `json:"workers"`
+	Overflow      string `json:"overflow"`
+	Dropped       uint64 `json:"dropped"`
+	Spilled       uint64 `json:"spilled"`
+	Failed        uint64 `json:"failed"`
+}
+
+// batcher is implemented by clients which send notifications in batches. The dispatcher collects the batches from
+// its queue itself, so that a worker sends a whole batch instead of waiting for a single notification.
+type batcher interface {
+	batchConfig() BatchConfig
+	sendBatch(ctx context.Context, notifications []RatingNotification) []error
+}
+
+// job is a notification waiting in the dispatcher queue. The notifications loaded from the spill store have the ID
+// of their record, which is deleted once they are sent.
+type job struct {
+	ctx          context.Context
+	notification RatingNotification
+	spillID      int64
+}
+
+// Dispatcher sends rating notifications asynchronously through a bounded queue served by a fixed number of workers.
+// It implements Client, so it can be used in place of the client it wraps.
+type Dispatcher struct {
+	client Client
+	config DispatcherConfig
+	spill  SpillStore
+	logger log.Logger
+
+	queue chan job
+	// mu guards closed; submitters hold the read lock while enqueuing so that the queue is not closed under them
+	mu      sync.RWMutex
+	closed  bool
+	stop    chan struct{}
+	abort   context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	poller  sync.WaitGroup
+
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// NewDispatcher creates a dispatcher that sends notifications through the given client and starts its workers.
+// With a batching client, every worker collects a batch from the queue and sends it, so that up to the configured
+// number of workers batches are sent at a time. The spill store is only used by the spill overflow policy; without a store the block policy is used instead.
+func NewDispatcher(client Client, config DispatcherConfig, spill SpillStore, logger log.Logger) *Dispatcher {
+	defaults := DefaultDispatcherConfig()
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.Overflow == "" {
+		config.Overflow = defaults.Overflow
+	}
+	if config.SendTimeout <= 0 {
+		config.SendTimeout = defaults.SendTimeout
+	}
+	if config.SpillInterval <= 0 {
+		config.SpillInterval = defaults.SpillInterval
+	}
+	if config.Overflow == OverflowSpill && spill == nil {
+		logger.Error("Notification dispatcher has no spill store, falling back to the block overflow policy")
+		config.Overflow = OverflowBlock
+	}
+
+	abort, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		client: client,
+		config: config,
+		spill:  spill,
+		logger: logger,
+		queue:  make(chan job, config.QueueSize),
+		stop:   make(chan struct{}),
+		abort:  abort,
+		cancel: cancel,
+	}
+	b, batching := client.(batcher)
+	for range config.Workers {
+		d.workers.Add(1)
+		if batching {
+			go d.workBatches(b)
+		} else {
+			go d.work()
+		}
+	}
+	if spill != nil {
+		d.poller.Add(1)
+		go d.pollSpilled()
+	}
+	return d
+}
+
+// SendRatingNotification queues the notification for delivery and returns once it is queued, spilled or dropped
+// according to the overflow policy. The notification is sent with a context that is not cancelled with ctx
+// but keeps its values, such as the request ID and the trace context.
+func (d *Dispatcher) SendRatingNotification(ctx context.Context, notification RatingNotification) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		if d.spill != nil {
+			return d.spillNotification(ctx, notification)
+		}
+		return ErrDispatcherClosed
+	}
+
+	j := job{ctx: context.WithoutCancel(ctx), notification: notification}
+	switch d.config.Overflow {
+	case OverflowDropOldest:
+		d.enqueueDropOldest(j)
+		return nil
+	case OverflowSpill:
+		select {
+		case d.queue <- j:
+			return nil
+		default:
+			return d.spillNotification(ctx, notification)
+		}
+	default:
+		select {
+		case d.queue <- j:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("failed to queue notification: %w", ctx.Err())
+		}
+	}
+}
+
+// enqueueDropOldest queues the job, discarding the oldest queued jobs while the queue is full.
+func (d *Dispatcher) enqueueDropOldest(j job) {
+	for {
+		select {
+		case d.queue <- j:
+			return
+		default:
+		}
+		select {
+		case old := <-d.queue:
+			d.dropped.Add(1)
+			d.logger.With(old.ctx, "rating_id", old.notification.RatingID).Error("Notification queue is full, dropped the oldest notification")
+		default:
+		}
+	}
+}
+
+// spillNotification stores a notification that does not fit in the queue.
+func (d *Dispatcher) spillNotification(ctx context.Context, notification RatingNotification) error {
+	if err := d.spill.Spill(context.WithoutCancel(ctx), notification); err != nil {
+		return fmt.Errorf("failed to spill notification: %w", err)
+	}
+	d.spilled.Add(1)
+	d.logger.With(ctx, "rating_id", notification.RatingID).Info("Notification queue is full, spilled notification to the database")
+	return nil
+}
+
+// work sends queued notifications until the queue is closed.
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for j := range d.queue {
+		d.send(j)
+	}
+}
+
+// workBatches collects batches of queued notifications and sends them until the queue is closed. A batch is sent
+// once it holds the batch size of notifications or the linger time after its first notification, whichever comes
+// first.
+func (d *Dispatcher) workBatches(b batcher) {
+	defer d.workers.Done()
+	config := b.batchConfig()
+	for j := range d.queue {
+		batch := []job{j}
+		linger := time.NewTimer(config.Linger)
+	collect:
+		for len(batch) < config.MaxSize {
+			select {
+			case j, ok := <-d.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, j)
+			case <-linger.C:
+				break collect
+			}
+		}
+		linger.Stop()
+		d.sendBatch(b, batch)
+	}
+}
+
+// sendBatch delivers a batch of notifications in a single request, which carries the values, such as the request ID
+// and the trace context, of the first notification. The batch has the send timeout of a single notification and is
+// cancelled when the dispatcher is aborted.
+func (d *Dispatcher) sendBatch(b batcher, batch []job) {
+	errs := make([]error, len(batch))
+	if err := d.abort.Err(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	} else {
+		notifications := make([]RatingNotification, len(batch))
+		for i, j := range batch {
+			notifications[i] = j.notification
+		}
+		ctx, cancel := context.WithTimeout(batch[0].ctx, d.config.SendTimeout)
+		stop := context.AfterFunc(d.abort, cancel)
+		trace.SpanFromContext(ctx).AddEvent("notification.batch", trace.WithAttributes(attribute.Int("notification.batch_size", len(batch))))
+		errs = b.sendBatch(ctx, notifications)
+		stop()
+		cancel()
+	}
+	for i, j := range batch {
+		d.finish(j, errs[i])
+	}
+}
+
+// send delivers a single notification.
+func (d *Dispatcher) send(j job) {
+	err := d.abort.Err()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(j.ctx, d.config.SendTimeout)
+		stop := context.AfterFunc(d.abort, cancel)
+		err = d.client.SendRatingNotification(ctx, j.notification)
+		stop()
+		cancel()
+	}
+	d.finish(j, err)
+}
+
+// finish records the outcome of sending a notification. When the dispatcher is aborted during shutdown, undelivered
+// notifications are spilled if a spill store is available. Spilled notifications are removed from the store once
+// they are sent or rejected for good, and returned to it otherwise, so that they are sent again later.
+func (d *Dispatcher) finish(j job, err error) {
+	if err == nil {
+		if j.spillID != 0 {
+			d.deleteSpilled(j)
+		}
+		return
+	}
+
+	if j.spillID != 0 && !isPermanentError(err) {
+		d.logger.With(j.ctx, "error", err, "rating_id", j.notification.RatingID).
+			Error("Failed to send spilled rating notification, it stays in the spill store")
+		d.releaseSpilled(j)
+		return
+	}
+	if d.abort.Err() != nil && d.spill != nil {
+		if spillErr := d.spillNotification(j.ctx, j.notification); spillErr == nil {
+			return
+		}
+	}
+	if j.spillID != 0 {
+		d.deleteSpilled(j)
+	}
+	d.failed.Add(1)
+	d.logger.With(j.ctx, "error", err, "rating_id", j.notification.RatingID).Error("Failed to send rating notification")
+}
+
+// deleteSpilled removes a spilled notification from the spill store. A notification which cannot be removed is
+// sent again once its claim expires.
+func (d *Dispatcher) deleteSpilled(j job) {
+	if err := d.spill.Delete(context.WithoutCancel(j.ctx), j.spillID); err != nil {
+		d.logger.With(j.ctx, "error", err, "rating_id", j.notification.RatingID).Error("Failed to delete spilled notification")
+	}
+}
+
+// releaseSpilled returns a spilled notification which was not sent to the spill store.
+func (d *Dispatcher) releaseSpilled(j job) {
+	if err := d.spill.Release(context.WithoutCancel(j.ctx), j.spillID); err != nil {
+		d.logger.With(j.ctx, "error", err, "rating_id", j.notification.RatingID).Error("Failed to release spilled notification")
+	}
+}
+
+// isPermanentError reports whether the notification service rejected a notification, so that sending it again
+// cannot succeed.
+func isPermanentError(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && !statusErr.Temporary()
+}
+
+// pollSpilled periodically moves spilled notifications back into the queue while it has room.
+func (d *Dispatcher) pollSpilled() {
+	defer d.poller.Done()
+	ticker := time.NewTicker(d.config.SpillInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.requeueSpilled()
+		}
+	}
+}
+
+// requeueSpilled loads as many spilled notifications as fit in the queue.
+func (d *Dispatcher) requeueSpilled() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+
+	free := cap(d.queue) - len(d.queue)
+	if free <= 0 {
+		return
+	}
+	ctx := context.Background()
+	notifications, err := d.spill.Unspill(ctx, free)
+	if err != nil {
+		d.logger.With(ctx, "error", err).Error("Failed to load spilled notifications")
+		return
+	}
+	for _, notification := range notifications {
+		j := job{ctx: ctx, notification: notification.RatingNotification, spillID: notification.ID}
+		select {
+		case d.queue <- j:
+		default:
+			d.releaseSpilled(j)
+		}
+	}
+}
+
+// Stats returns the current state of the dispatcher.
+func (d *Dispatcher) Stats() DispatcherStats {
+	return DispatcherStats{
+		QueueDepth:    len(d.queue),
+		QueueCapacity: cap(d.queue),
+		Workers:       d.config.Workers,
+		Overflow:      d.config.Overflow,
+		Dropped:       d.dropped.Load(),
+		Spilled:       d.spilled.Load(),
+		Failed:        d.failed.Load(),
+	}
+}
+
+// Check reports an error while the queue is full. It can be used as a readiness check.
+func (d *Dispatcher) Check(ctx context.Context) error {
+	if stats := d.Stats(); stats.QueueDepth >= stats.QueueCapacity {
+		return fmt.Errorf("notification queue is full (%d/%d)", stats.QueueDepth, stats.QueueCapacity)
+	}
+	return nil
+}
+
+// Shutdown stops accepting new notifications and waits until the queued and in-flight notifications are sent.
+// If ctx expires first, in-flight sends are cancelled and the remaining notifications are spilled when a
+// spill store is available, or dropped otherwise.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.stop)
+	close(d.queue)
+	d.mu.Unlock()
+	d.poller.Wait()
+
+	d.logger.With(ctx, "queue_depth", len(d.queue)).Info("Draining notification queue")
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		d.logger.Info("Notification queue drained")
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return fmt.Errorf("notification queue was not drained: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,267 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient records the notifications it sends. While gate is open, sends block until gate is closed or ctx is done.
+type fakeClient struct {
+	mu      sync.Mutex
+	sent    []string
+	gate    chan struct{}
+	started chan string
+}
+
+func newFakeClient(blocking bool) *fakeClient {
+	c := &fakeClient{started: make(chan string, 100)}
+	if blocking {
+		c.gate = make(chan struct{})
+	}
+	return c
+}
+
+func (c *fakeClient) SendRatingNotification(ctx context.Context, notification RatingNotification) error {
+	c.started <- notification.RatingID
+	if c.gate != nil {
+		select {
+		case <-c.gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, notification.RatingID)
+	return nil
+}
+
+func (c *fakeClient) Sent() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.sent...)
+}
+
+// memorySpillStore keeps spilled notifications in memory. Notifications returned by Unspill stay in the store until
+// they are deleted.
+type memorySpillStore struct {
+	mu       sync.Mutex
+	nextID   int64
+	items    []SpilledNotification
+	inFlight map[int64]bool
+}
+
+func (s *memorySpillStore) Spill(ctx context.Context, notification RatingNotification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	s.items = append(s.items, SpilledNotification{ID: s.nextID, RatingNotification: notification})
+	return nil
+}
+
+func (s *memorySpillStore) Unspill(ctx context.Context, limit int) ([]SpilledNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inFlight == nil {
+		s.inFlight = map[int64]bool{}
+	}
+	var items []SpilledNotification
+	for _, item := range s.items {
+		if len(items) < limit && !s.inFlight[item.ID] {
+			s.inFlight[item.ID] = true
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (s *memorySpillStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.items {
+		if item.ID == id {
+			s.items = append(s.items[:i], s.items[i+1:]...)
+			break
+		}
+	}
+	delete(s.inFlight, id)
+	return nil
+}
+
+func (s *memorySpillStore) Release(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, id)
+	return nil
+}
+
+// IDs returns the rating IDs of the stored notifications, including the ones in flight.
+func (s *memorySpillStore) IDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, item := range s.items {
+		ids = append(ids, item.RatingID)
+	}
+	return ids
+}
+
+func send(t *testing.T, d *Dispatcher, id string) {
+	require.NoError(t, d.SendRatingNotification(context.Background(), RatingNotification{RatingID: id}))
+}
+
+func TestDispatcher_DrainsOnShutdown(t *testing.T) {
+	logger, _ := log.NewForTest()
+	client := newFakeClient(false)
+	d := NewDispatcher(client, DispatcherConfig{Workers: 2, QueueSize: 10}, nil, logger)
+
+	ids := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+	for _, id := range ids {
+		send(t, d, id)
+	}
+	require.NoError(t, d.Shutdown(context.Background()))
+	assert.ElementsMatch(t, ids, client.Sent())
+
+	err := d.SendRatingNotification(context.Background(), RatingNotification{RatingID: "9"})
+	assert.ErrorIs(t, err, ErrDispatcherClosed)
+}
+
+func TestDispatcher_Block(t *testing.T) {
+	logger, _ := log.NewForTest()
+	client := newFakeClient(true)
+	d := NewDispatcher(client, DispatcherConfig{Workers: 1, QueueSize: 1, Overflow: OverflowBlock}, nil, logger)
+
+	send(t, d, "1")
+	<-client.started
+	send(t, d, "2")
+	assert.Error(t, d.Check(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.SendRatingNotification(ctx, RatingNotification{RatingID: "3"}), context.DeadlineExceeded)
+
+	close(client.gate)
+	require.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"1", "2"}, client.Sent())
+}
+
+func TestDispatcher_DropOldest(t *testing.T) {
+	logger, _ := log.NewForTest()
+	client := newFakeClient(true)
+	d := NewDispatcher(client, DispatcherConfig{Workers: 1, QueueSize: 2, Overflow: OverflowDropOldest}, nil, logger)
+
+	send(t, d, "1")
+	<-client.started
+	send(t, d, "2")
+	send(t, d, "3")
+	send(t, d, "4")
+
+	stats := d.Stats()
+	assert.Equal(t, 2, stats.QueueDepth)
+	assert.Equal(t, 2, stats.QueueCapacity)
+	assert.Equal(t, uint64(1), stats.Dropped)
+
+	close(client.gate)
+	require.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"1", "3", "4"}, client.Sent())
+}
+
+func TestDispatcher_Spill(t *testing.T) {
+	logger, _ := log.NewForTest()
+	client := newFakeClient(true)
+	store := &memorySpillStore{}
+	d := NewDispatcher(client, DispatcherConfig{Workers: 1, QueueSize: 1, Overflow: OverflowSpill, SpillInterval: 10 * time.Millisecond}, store, logger)
+
+	send(t, d, "1")
+	<-client.started
+	send(t, d, "2")
+	send(t, d, "3")
+	assert.Equal(t, []string{"3"}, store.IDs())
+	assert.Equal(t, uint64(1), d.Stats().Spilled)
+
+	// spilled notifications are moved back into the queue once it has room
+	close(client.gate)
+	assert.Eventually(t, func() bool { return len(client.Sent()) == 3 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, store.IDs())
+	require.NoError(t, d.Shutdown(context.Background()))
+}
+
+// scriptedClient fails the sends of a rating ID with the given errors in turn and records the successful ones.
+type scriptedClient struct {
+	mu       sync.Mutex
+	errs     map[string][]error
+	attempts map[string]int
+	sent     []string
+}
+
+func (c *scriptedClient) SendRatingNotification(ctx context.Context, notification RatingNotification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts[notification.RatingID]++
+	if errs := c.errs[notification.RatingID]; len(errs) > 0 {
+		c.errs[notification.RatingID] = errs[1:]
+		return errs[0]
+	}
+	c.sent = append(c.sent, notification.RatingID)
+	return nil
+}
+
+func (c *scriptedClient) Sent() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.sent...)
+}
+
+func TestDispatcher_SpilledNotificationsStayUntilSent(t *testing.T) {
+	logger, _ := log.NewForTest()
+	client := &scriptedClient{
+		errs: map[string][]error{
+			"1": {&StatusError{StatusCode: http.StatusServiceUnavailable}},
+			"2": {&StatusError{StatusCode: http.StatusBadRequest}},
+		},
+		attempts: map[string]int{},
+	}
+	store := &memorySpillStore{}
+	require.NoError(t, store.Spill(context.Background(), RatingNotification{RatingID: "1"}))
+	require.NoError(t, store.Spill(context.Background(), RatingNotification{RatingID: "2"}))
+	d := NewDispatcher(client, DispatcherConfig{Workers: 1, QueueSize: 5, Overflow: OverflowSpill, SpillInterval: 10 * time.Millisecond}, store, logger)
+
+	// a notification which failed is sent again, and removed from the store once it was sent
+	assert.Eventually(t, func() bool { return len(client.Sent()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"1"}, client.Sent())
+	require.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, 2, client.attempts["1"])
+	// a notification which the notification service rejected is removed without sending it again
+	assert.Equal(t, 1, client.attempts["2"])
+	assert.Equal(t, uint64(1), d.Stats().Failed)
+	assert.Empty(t, store.IDs())
+}
+
+func TestDispatcher_ShutdownTimeoutSpillsRemaining(t *testing.T) {
+	logger, _ := log.NewForTest()
+	client := newFakeClient(true)
+	store := &memorySpillStore{}
+	d := NewDispatcher(client, DispatcherConfig{Workers: 1, QueueSize: 5, Overflow: OverflowSpill, SpillInterval: time.Hour}, store, logger)
+
+	send(t, d, "1")
+	<-client.started
+	send(t, d, "2")
+	send(t, d, "3")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, d.Shutdown(ctx))
+	assert.Empty(t, client.Sent())
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, store.IDs())
+
+	// notifications submitted after shutdown are spilled as well
+	send(t, d, "4")
+	assert.Contains(t, store.IDs(), "4")
+}
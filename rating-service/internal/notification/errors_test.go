@@ -0,0 +1,45 @@
+package notification
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusError(t *testing.T) {
+	err := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	assert.Equal(t, "notification service returned status 503", err.Error())
+	assert.True(t, err.Temporary())
+	assert.True(t, (&StatusError{StatusCode: http.StatusTooManyRequests}).Temporary())
+	assert.False(t, (&StatusError{StatusCode: http.StatusBadRequest}).Temporary())
+}
+
+func TestStatusError_RetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 16, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "3", 3 * time.Second, true},
+		{"negative seconds", "-1", 0, false},
+		{"http date", now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second, true},
+		{"http date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"invalid", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			got, ok := (&StatusError{StatusCode: http.StatusTooManyRequests, Header: header}).RetryAfter(now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
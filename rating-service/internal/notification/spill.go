@@ -0,0 +1,133 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/dbcontext"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// spillClaimTimeout is how long a notification loaded from the notification_outbox table stays in flight before it is
+// loaded again, e.g. because the instance which loaded it stopped before sending it. The notification service drops
+// the duplicates this may cause.
+const spillClaimTimeout = 10 * time.Minute
+
+// SpillStore keeps notifications that did not fit in the dispatcher queue.
+type SpillStore interface {
+	// Spill saves a notification.
+	Spill(ctx context.Context, notification RatingNotification) error
+	// Unspill marks up to limit notifications as in flight and returns them in the order they were spilled. They stay
+	// in the store until they are deleted, so that they are not lost when the service stops before sending them.
+	Unspill(ctx context.Context, limit int) ([]SpilledNotification, error)
+	// Delete removes a notification once it was sent.
+	Delete(ctx context.Context, id int64) error
+	// Release returns a notification which is in flight to the store, so that Unspill returns it again.
+	Release(ctx context.Context, id int64) error
+}
+
+// SpilledNotification is a notification loaded from a SpillStore, identified by the ID of its record.
+type SpilledNotification struct {
+	ID int64
+	RatingNotification
+}
+
+// outboxRecord is a row of the notification_outbox table.
+type outboxRecord struct {
+	ID                   int64      `db:"id"`
+	ServiceProviderID    string     `db:"service_provider_id"`
+	ServiceProviderEmail string     `db:"service_provider_email"`
+	RatingID             string     `db:"rating_id"`
+	Type                 string     `db:"type"`
+	Rating               int        `db:"rating"`
+	CustomerName         string     `db:"customer_name"`
+	Comment              string     `db:"comment"`
+	CreatedAt            time.Time  `db:"created_at"`
+	ClaimedAt            *time.Time `db:"claimed_at"`
+}
+
+// dbSpillStore persists spilled notifications in the notification_outbox table.
+type dbSpillStore struct {
+	db *dbcontext.DB
+}
+
+// NewSpillStore creates a SpillStore backed by the notification_outbox table.
+func NewSpillStore(db *dbcontext.DB) SpillStore {
+	return dbSpillStore{db}
+}
+
+// Spill inserts the notification into the outbox table.
+func (s dbSpillStore) Spill(ctx context.Context, notification RatingNotification) error {
+	ctx, span := tracer.Start(ctx, "notification.SpillStore.Spill")
+	_, err := s.db.With(ctx).Insert("notification_outbox", dbx.Params{
+		"service_provider_id":    notification.ServiceProviderID,
+		"service_provider_email": notification.ServiceProviderEmail,
+		"rating_id":              notification.RatingID,
+		"type":                   notification.Type,
+		"rating":                 notification.Rating,
+		"customer_name":          notification.CustomerName,
+		"comment":                notification.Comment,
+		"created_at":             time.Now(),
+	}).Execute()
+	tracing.End(span, err)
+	return err
+}
+
+// Unspill marks the oldest outbox records which are not in flight as in flight and returns them. Rows locked by
+// another instance are skipped.
+func (s dbSpillStore) Unspill(ctx context.Context, limit int) (notifications []SpilledNotification, err error) {
+	ctx, span := tracer.Start(ctx, "notification.SpillStore.Unspill")
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
+	err = s.db.Transactional(ctx, func(ctx context.Context) error {
+		var records []outboxRecord
+		err := s.db.With(ctx).NewQuery(
+			"SELECT * FROM notification_outbox WHERE claimed_at IS NULL OR claimed_at < {:stale} " +
+				"ORDER BY id LIMIT {:limit} FOR UPDATE SKIP LOCKED",
+		).Bind(dbx.Params{"stale": now.Add(-spillClaimTimeout), "limit": limit}).All(&records)
+		if err != nil || len(records) == 0 {
+			return err
+		}
+
+		ids := make([]interface{}, len(records))
+		for i, record := range records {
+			ids[i] = record.ID
+			notifications = append(notifications, SpilledNotification{
+				ID: record.ID,
+				RatingNotification: RatingNotification{
+					ServiceProviderID:    record.ServiceProviderID,
+					ServiceProviderEmail: record.ServiceProviderEmail,
+					RatingID:             record.RatingID,
+					Type:                 record.Type,
+					Rating:               record.Rating,
+					CustomerName:         record.CustomerName,
+					Comment:              record.Comment,
+				},
+			})
+		}
+		_, err = s.db.With(ctx).Update("notification_outbox", dbx.Params{"claimed_at": now}, dbx.In("id", ids...)).Execute()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// Delete deletes an outbox record.
+func (s dbSpillStore) Delete(ctx context.Context, id int64) error {
+	ctx, span := tracer.Start(ctx, "notification.SpillStore.Delete")
+	_, err := s.db.With(ctx).Delete("notification_outbox", dbx.HashExp{"id": id}).Execute()
+	tracing.End(span, err)
+	return err
+}
+
+// Release clears the in-flight mark of an outbox record.
+func (s dbSpillStore) Release(ctx context.Context, id int64) error {
+	ctx, span := tracer.Start(ctx, "notification.SpillStore.Release")
+	_, err := s.db.With(ctx).Update("notification_outbox", dbx.Params{"claimed_at": nil}, dbx.HashExp{"id": id}).Execute()
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,136 @@
+// The tests of the spill store are in an external package, since the test package imports the configuration, which
+// imports this package.
+package notification_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/notification"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/test"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedClient records the notifications it sends once its gate is closed.
+type gatedClient struct {
+	mu      sync.Mutex
+	gate    chan struct{}
+	started chan string
+	sent    []string
+}
+
+func (c *gatedClient) SendRatingNotification(ctx context.Context, n notification.RatingNotification) error {
+	c.started <- n.RatingID
+	select {
+	case <-c.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, n.RatingID)
+	return nil
+}
+
+func (c *gatedClient) Sent() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.sent...)
+}
+
+// ratingIDs returns the rating IDs of spilled notifications.
+func ratingIDs(notifications []notification.SpilledNotification) []string {
+	ids := []string{}
+	for _, n := range notifications {
+		ids = append(ids, n.RatingID)
+	}
+	return ids
+}
+
+// countOutbox returns the number of rows of the notification_outbox table.
+func countOutbox(t *testing.T, db *dbx.DB) int {
+	var count int
+	require.NoError(t, db.NewQuery("SELECT COUNT(*) FROM notification_outbox").Row(&count))
+	return count
+}
+
+func TestSpillStore(t *testing.T) {
+	db := test.DB(t)
+	test.ResetTables(t, db, "notification_outbox")
+	store := notification.NewSpillStore(db)
+	ctx := context.Background()
+
+	for _, id := range []string{"r1", "r2", "r3"} {
+		require.NoError(t, store.Spill(ctx, notification.RatingNotification{
+			ServiceProviderID:    "sp-1",
+			ServiceProviderEmail: "provider@example.com",
+			RatingID:             id,
+			Type:                 notification.EventRatingCreated,
+			Rating:               5,
+			CustomerName:         "Jane",
+		}))
+	}
+
+	// notifications are returned in the order they were spilled
+	first, err := store.Unspill(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r1", "r2"}, ratingIDs(first))
+	assert.Equal(t, "provider@example.com", first[0].ServiceProviderEmail)
+	assert.Equal(t, 3, countOutbox(t, db.DB()), "notifications in flight stay in the store")
+
+	// notifications in flight are not returned again
+	rest, err := store.Unspill(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r3"}, ratingIDs(rest))
+	none, err := store.Unspill(ctx, 5)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	// released notifications and the ones in flight for too long are returned again
+	require.NoError(t, store.Release(ctx, first[0].ID))
+	_, err = db.DB().Update("notification_outbox", dbx.Params{"claimed_at": time.Now().Add(-time.Hour)}, dbx.HashExp{"id": first[1].ID}).Execute()
+	require.NoError(t, err)
+	again, err := store.Unspill(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r1", "r2"}, ratingIDs(again))
+
+	for _, n := range append(again, rest...) {
+		require.NoError(t, store.Delete(ctx, n.ID))
+	}
+	assert.Zero(t, countOutbox(t, db.DB()))
+}
+
+func TestDispatcher_SpillToDatabase(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "notification_outbox")
+	client := &gatedClient{gate: make(chan struct{}), started: make(chan string, 10)}
+	d := notification.NewDispatcher(client, notification.DispatcherConfig{
+		Workers:       1,
+		QueueSize:     1,
+		Overflow:      notification.OverflowSpill,
+		SpillInterval: 10 * time.Millisecond,
+	}, notification.NewSpillStore(db), logger)
+	ctx := context.Background()
+
+	for _, id := range []string{"r1", "r2", "r3", "r4"} {
+		require.NoError(t, d.SendRatingNotification(ctx, notification.RatingNotification{ServiceProviderID: "sp-1", RatingID: id, Rating: 4}))
+		if id == "r1" {
+			<-client.started
+		}
+	}
+	assert.Equal(t, 2, countOutbox(t, db.DB()), "the notifications which do not fit in the queue are spilled")
+	assert.Equal(t, uint64(2), d.Stats().Spilled)
+
+	// spilled notifications are sent in the order they were spilled and deleted once they were sent
+	close(client.gate)
+	assert.Eventually(t, func() bool { return len(client.Sent()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"r1", "r2", "r3", "r4"}, client.Sent())
+	assert.Eventually(t, func() bool { return countOutbox(t, db.DB()) == 0 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, d.Shutdown(ctx))
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/entity"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/dbcontext"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
 	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
@@ -22,6 +23,8 @@ type Repository interface {
 	GetAverageRatingByServiceProvider(ctx context.Context, serviceProviderID string) (float64, int, error)
 }
 
+var tracer = tracing.Tracer("github.com/berkaykrc/homerun-ratings-system/rating-service/internal/rating")
+
 // repository persists ratings in database
 type repository struct {
 	db     *dbcontext.DB
@@ -35,26 +38,34 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 
 // Get reads the rating with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string) (entity.Rating, error) {
+	ctx, span := tracer.Start(ctx, "rating.Repository.Get")
 	var rating entity.Rating
 	err := r.db.With(ctx).Select().Model(id, &rating)
+	tracing.End(span, err)
 	return rating, err
 }
 
 // Create saves a new rating record in the database.
 // It returns the ID of the newly inserted rating record.
 func (r repository) Create(ctx context.Context, rating entity.Rating) error {
-	return r.db.With(ctx).Model(&rating).Insert()
+	ctx, span := tracer.Start(ctx, "rating.Repository.Create")
+	err := r.db.With(ctx).Model(&rating).Insert()
+	tracing.End(span, err)
+	return err
 }
 
 // Count returns the number of the rating records in the database.
 func (r repository) Count(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "rating.Repository.Count")
 	var count int
 	err := r.db.With(ctx).Select("COUNT(*)").From("ratings").Row(&count)
+	tracing.End(span, err)
 	return count, err
 }
 
 // GetAverageRatingByServiceProvider returns the average rating and total count for a service provider.
 func (r repository) GetAverageRatingByServiceProvider(ctx context.Context, serviceProviderID string) (float64, int, error) {
+	ctx, span := tracer.Start(ctx, "rating.Repository.GetAverageRatingByServiceProvider")
 	var avgRating sql.NullFloat64
 	var totalCount int
 
@@ -62,6 +73,7 @@ func (r repository) GetAverageRatingByServiceProvider(ctx context.Context, servi
 		From("ratings").
 		Where(dbx.HashExp{"service_provider_id": serviceProviderID}).
 		Row(&avgRating, &totalCount)
+	tracing.End(span, err)
 	if err != nil {
 		return 0, 0, err
 	}
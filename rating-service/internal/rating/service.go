@@ -85,7 +85,7 @@ func (s service) Create(ctx context.Context, req CreateRatingRequest) (Rating, e
 		return Rating{}, fmt.Errorf("customer validation error: %v", err)
 	}
 
-	_, err = s.serviceProviderService.Get(ctx, req.ServiceProviderID)
+	serviceProvider, err := s.serviceProviderService.Get(ctx, req.ServiceProviderID)
 	if err != nil {
 		return Rating{}, fmt.Errorf("service provider validation error: %v", err)
 	}
@@ -107,21 +107,20 @@ func (s service) Create(ctx context.Context, req CreateRatingRequest) (Rating, e
 	}
 
 	notification := notification.RatingNotification{
-		ServiceProviderID: req.ServiceProviderID,
-		RatingID:          id,
-		Rating:            req.RatingValue,
-		CustomerName:      customer.Name,
-		Comment:           req.Comment,
+		ServiceProviderID:    req.ServiceProviderID,
+		ServiceProviderEmail: serviceProvider.Email,
+		RatingID:             id,
+		Type:                 notification.EventRatingCreated,
+		Rating:               req.RatingValue,
+		CustomerName:         customer.Name,
+		Comment:              req.Comment,
 	}
 
-	go func() {
-		notificationCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancel()
-
-		if err := s.notificationClient.SendRatingNotification(notificationCtx, notification); err != nil {
-			s.logger.With(notificationCtx, "error", err, "rating_id", id).Error("Failed to send rating notification")
-		}
-	}()
+	// the notification client queues the notification for asynchronous delivery; a failure to queue it
+	// must not fail the rating, which is already stored
+	if err := s.notificationClient.SendRatingNotification(ctx, notification); err != nil {
+		s.logger.With(ctx, "error", err, "rating_id", id).Error("Failed to queue rating notification")
+	}
 
 	return Rating{rating}, nil
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/customer"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/entity"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/notification"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/serviceprovider"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
 	"github.com/stretchr/testify/assert"
@@ -59,18 +60,30 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, "good service", rating.Comment)
 	count, _ = s.Count(ctx)
 	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, notificationClient.CallCount)
+	assert.Equal(t, id, notificationClient.LastNotification.RatingID)
+	assert.Equal(t, notification.EventRatingCreated, notificationClient.LastNotification.Type)
+	assert.Equal(t, "test@provider.com", notificationClient.LastNotification.ServiceProviderEmail)
+
+	// a failure to queue the notification does not fail the rating
+	notificationClient.ShouldReturnError = true
+	_, err = s.Create(ctx, CreateRatingRequest{CustomerID: "customer123", ServiceProviderID: "service123", RatingValue: 4, Comment: "good service"})
+	assert.Nil(t, err)
+	notificationClient.ShouldReturnError = false
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 2, count)
 
 	// validation error in creation
 	_, err = s.Create(ctx, CreateRatingRequest{CustomerID: "", ServiceProviderID: "service123", RatingValue: 5, Comment: "good service"})
 	assert.NotNil(t, err)
 	count, _ = s.Count(ctx)
-	assert.Equal(t, 1, count)
+	assert.Equal(t, 2, count)
 
 	// unexpected error in creation
 	_, err = s.Create(ctx, CreateRatingRequest{CustomerID: "customer123", ServiceProviderID: "service123", RatingValue: 5, Comment: "error"})
 	assert.Equal(t, errCRUD, err)
 	count, _ = s.Count(ctx)
-	assert.Equal(t, 1, count)
+	assert.Equal(t, 2, count)
 
 	_, _ = s.Create(ctx, CreateRatingRequest{CustomerID: "customer123", ServiceProviderID: "service123", RatingValue: 5, Comment: "good service"})
 
@@ -6,6 +6,7 @@ import (
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/internal/entity"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/dbcontext"
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
 )
 
 // Repository encapsulates the logic to access service providers from the data source.
@@ -18,6 +19,8 @@ type Repository interface {
 	Create(ctx context.Context, serviceProvider entity.ServiceProvider) error
 }
 
+var tracer = tracing.Tracer("github.com/berkaykrc/homerun-ratings-system/rating-service/internal/serviceprovider")
+
 // repository persists service providers in database
 type repository struct {
 	db     *dbcontext.DB
@@ -31,19 +34,26 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 
 // Get reads the service provider with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string) (entity.ServiceProvider, error) {
+	ctx, span := tracer.Start(ctx, "serviceprovider.Repository.Get")
 	var serviceProvider entity.ServiceProvider
 	err := r.db.With(ctx).Select().Model(id, &serviceProvider)
+	tracing.End(span, err)
 	return serviceProvider, err
 }
 
 // Create saves a new service provider record in the database.
 func (r repository) Create(ctx context.Context, serviceProvider entity.ServiceProvider) error {
-	return r.db.With(ctx).Model(&serviceProvider).Insert()
+	ctx, span := tracer.Start(ctx, "serviceprovider.Repository.Create")
+	err := r.db.With(ctx).Model(&serviceProvider).Insert()
+	tracing.End(span, err)
+	return err
 }
 
 // Count returns the number of the service provider records in the database.
 func (r repository) Count(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "serviceprovider.Repository.Count")
 	var count int
 	err := r.db.With(ctx).Select("COUNT(*)").From("service_providers").Row(&count)
+	tracing.End(span, err)
 	return count, err
 }
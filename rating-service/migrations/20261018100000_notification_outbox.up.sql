@@ -0,0 +1,9 @@
+CREATE TABLE notification_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    service_provider_id VARCHAR NOT NULL,
+    rating_id VARCHAR NOT NULL,
+    rating INTEGER NOT NULL,
+    customer_name VARCHAR NOT NULL,
+    comment TEXT,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE notification_outbox ADD COLUMN type VARCHAR NOT NULL DEFAULT 'rating.created';
@@ -0,0 +1 @@
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS service_provider_email;
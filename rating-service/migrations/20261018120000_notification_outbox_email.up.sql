@@ -0,0 +1 @@
+ALTER TABLE notification_outbox ADD COLUMN service_provider_email VARCHAR NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE notification_outbox ADD COLUMN claimed_at TIMESTAMP;
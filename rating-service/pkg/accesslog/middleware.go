@@ -24,6 +24,10 @@ func Handler(logger log.Logger) routing.Handler {
 		ctx = log.WithRequest(ctx, c.Request)
 		c.Request = c.Request.WithContext(ctx)
 
+		// echo the IDs back so that callers can correlate their request with our logs
+		c.Response.Header().Set(log.RequestIDHeader, log.RequestID(ctx))
+		c.Response.Header().Set(log.CorrelationIDHeader, log.CorrelationID(ctx))
+
 		err := c.Next()
 
 		// generate an access log message
@@ -69,7 +69,7 @@ func TestCircuitBreaker_Execute_FailureThreshold(t *testing.T) {
 	})
 
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "circuit breaker is OPEN")
+	assert.ErrorIs(t, err, ErrOpenState)
 }
 
 func TestCircuitBreaker_Recovery(t *testing.T) {
@@ -213,6 +213,87 @@ func TestCircuitBreakerConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid mode",
+			config: Config{
+				Mode:             "unknown",
+				FailureThreshold: 5,
+				RecoveryTimeout:  time.Second,
+				MinimumRequests:  1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid count mode",
+			config: Config{
+				Mode:                 ModeCount,
+				RecoveryTimeout:      time.Second,
+				MinimumRequests:      1,
+				WindowSize:           20,
+				MinimumCalls:         10,
+				FailureRateThreshold: 50,
+			},
+			wantErr: false,
+		},
+		{
+			name: "count mode without window size",
+			config: Config{
+				Mode:                 ModeCount,
+				RecoveryTimeout:      time.Second,
+				MinimumRequests:      1,
+				MinimumCalls:         10,
+				FailureRateThreshold: 50,
+			},
+			wantErr: true,
+		},
+		{
+			name: "count mode with more minimum calls than the window holds",
+			config: Config{
+				Mode:                 ModeCount,
+				RecoveryTimeout:      time.Second,
+				MinimumRequests:      1,
+				WindowSize:           5,
+				MinimumCalls:         10,
+				FailureRateThreshold: 50,
+			},
+			wantErr: true,
+		},
+		{
+			name: "time mode without window duration",
+			config: Config{
+				Mode:                 ModeTime,
+				RecoveryTimeout:      time.Second,
+				MinimumRequests:      1,
+				MinimumCalls:         10,
+				FailureRateThreshold: 50,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid failure rate threshold",
+			config: Config{
+				Mode:                 ModeTime,
+				RecoveryTimeout:      time.Second,
+				MinimumRequests:      1,
+				WindowDuration:       time.Minute,
+				MinimumCalls:         10,
+				FailureRateThreshold: 150,
+			},
+			wantErr: true,
+		},
+		{
+			name: "slow call rate without slow call duration",
+			config: Config{
+				Mode:                  ModeTime,
+				RecoveryTimeout:       time.Second,
+				MinimumRequests:       1,
+				WindowDuration:        time.Minute,
+				MinimumCalls:          10,
+				FailureRateThreshold:  50,
+				SlowCallRateThreshold: 50,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -286,3 +367,96 @@ func TestCircuitBreaker_ConcurrentAccess(t *testing.T) {
 	stats := cb.GetStats()
 	assert.NotNil(t, stats)
 }
+
+func TestCircuitBreaker_CountWindowFailureRate(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cb := New(Config{
+		Mode:                 ModeCount,
+		RecoveryTimeout:      time.Second,
+		MinimumRequests:      1,
+		WindowSize:           10,
+		MinimumCalls:         5,
+		FailureRateThreshold: 50,
+	}, logger)
+	ctx := context.Background()
+	testError := errors.New("test error")
+
+	// interleaved successes never open the breaker in consecutive mode, but a 60% failure rate does
+	for _, fail := range []bool{true, false, true, false} {
+		_ = cb.Execute(ctx, func(ctx context.Context) error {
+			if fail {
+				return testError
+			}
+			return nil
+		})
+	}
+	assert.Equal(t, StateClosed, cb.GetState(), "below the minimum number of calls")
+
+	_ = cb.Execute(ctx, func(ctx context.Context) error { return testError })
+	assert.Equal(t, StateOpen, cb.GetState())
+}
+
+func TestCircuitBreaker_TimeWindowSlowCallRate(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cb := New(Config{
+		Mode:                  ModeTime,
+		RecoveryTimeout:       time.Second,
+		MinimumRequests:       1,
+		WindowDuration:        time.Minute,
+		MinimumCalls:          2,
+		FailureRateThreshold:  100,
+		SlowCallDuration:      10 * time.Millisecond,
+		SlowCallRateThreshold: 50,
+	}, logger)
+	ctx := context.Background()
+
+	assert.NoError(t, cb.Execute(ctx, func(ctx context.Context) error { return nil }))
+	assert.NoError(t, cb.Execute(ctx, func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}))
+	assert.Equal(t, StateOpen, cb.GetState())
+
+	stats := cb.GetStats()
+	assert.Equal(t, ModeTime, stats["mode"])
+	assert.Contains(t, stats, "slow_call_rate")
+}
+
+func TestCircuitBreaker_HalfOpenConcurrentProbes(t *testing.T) {
+	logger, _ := log.NewForTest()
+	cb := New(Config{
+		FailureThreshold: 1,
+		RecoveryTimeout:  50 * time.Millisecond,
+		MinimumRequests:  3,
+		HalfOpenMaxCalls: 1,
+	}, logger)
+	ctx := context.Background()
+
+	_ = cb.Execute(ctx, func(ctx context.Context) error { return errors.New("test error") })
+	assert.Equal(t, StateOpen, cb.GetState())
+	time.Sleep(60 * time.Millisecond)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- cb.Execute(ctx, func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// a second probe is rejected while the first one is still in flight
+	err := cb.Execute(ctx, func(ctx context.Context) error {
+		t.Fatal("This function should not be called while a probe is in flight")
+		return nil
+	})
+	assert.Error(t, err)
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, StateHalfOpen, cb.GetState())
+	assert.NoError(t, cb.Execute(ctx, func(ctx context.Context) error { return nil }))
+}
@@ -0,0 +1,61 @@
+package circuitbreaker
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+)
+
+// Registry keeps track of named circuit breakers so that they can be inspected and controlled at runtime.
+type Registry struct {
+	mu       sync.RWMutex
+	breakers map[string]*CircuitBreaker
+}
+
+// NewRegistry creates an empty circuit breaker registry.
+func NewRegistry() *Registry {
+	return &Registry{breakers: make(map[string]*CircuitBreaker)}
+}
+
+// New creates a circuit breaker whose log messages are tagged with the given name and registers it under that name.
+func (r *Registry) New(name string, config Config, logger log.Logger) *CircuitBreaker {
+	cb := New(config, logger.With(context.Background(), "circuit_breaker", name))
+	r.Register(name, cb)
+	return cb
+}
+
+// Register adds a circuit breaker under the given name, replacing any breaker previously registered with that name.
+func (r *Registry) Register(name string, cb *CircuitBreaker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakers[name] = cb
+}
+
+// Remove removes the circuit breaker registered under the given name, if any.
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.breakers, name)
+}
+
+// Get returns the circuit breaker registered under the given name.
+func (r *Registry) Get(name string) (*CircuitBreaker, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cb, ok := r.breakers[name]
+	return cb, ok
+}
+
+// Names returns the names of all registered circuit breakers in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.breakers))
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,144 @@
+package circuitbreaker
+
+import "time"
+
+// windowStats aggregates the outcomes recorded in a sliding window.
+type windowStats struct {
+	calls     int
+	failures  int
+	slowCalls int
+}
+
+// failureRate returns the percentage of failed calls in the window.
+func (s windowStats) failureRate() float64 {
+	if s.calls == 0 {
+		return 0
+	}
+	return float64(s.failures) * 100 / float64(s.calls)
+}
+
+// slowCallRate returns the percentage of slow calls in the window.
+func (s windowStats) slowCallRate() float64 {
+	if s.calls == 0 {
+		return 0
+	}
+	return float64(s.slowCalls) * 100 / float64(s.calls)
+}
+
+// window records call outcomes over a sliding window.
+type window interface {
+	record(now time.Time, failed, slow bool)
+	stats(now time.Time) windowStats
+	reset()
+}
+
+// newWindow creates the sliding window for the configured mode, or nil in consecutive mode.
+func newWindow(config Config) window {
+	switch config.Mode {
+	case ModeCount:
+		return &countWindow{outcomes: make([]outcome, config.WindowSize)}
+	case ModeTime:
+		return newTimeWindow(config.WindowDuration)
+	default:
+		return nil
+	}
+}
+
+// outcome is the result of a single call.
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+// countWindow keeps the outcomes of the last N calls in a ring buffer.
+type countWindow struct {
+	outcomes []outcome
+	next     int
+	total    windowStats
+}
+
+func (w *countWindow) record(_ time.Time, failed, slow bool) {
+	if w.total.calls == len(w.outcomes) {
+		evicted := w.outcomes[w.next]
+		w.total.calls--
+		if evicted.failed {
+			w.total.failures--
+		}
+		if evicted.slow {
+			w.total.slowCalls--
+		}
+	}
+	w.outcomes[w.next] = outcome{failed: failed, slow: slow}
+	w.next = (w.next + 1) % len(w.outcomes)
+	w.total.calls++
+	if failed {
+		w.total.failures++
+	}
+	if slow {
+		w.total.slowCalls++
+	}
+}
+
+func (w *countWindow) stats(time.Time) windowStats {
+	return w.total
+}
+
+func (w *countWindow) reset() {
+	w.next = 0
+	w.total = windowStats{}
+}
+
+// bucketSize is the time resolution of a timeWindow.
+const bucketSize = time.Second
+
+// bucket aggregates the outcomes of the calls made during one bucketSize interval.
+type bucket struct {
+	epoch int64
+	windowStats
+}
+
+// timeWindow keeps the outcomes of the calls made during the last duration in per-second buckets.
+type timeWindow struct {
+	buckets []bucket
+}
+
+func newTimeWindow(duration time.Duration) *timeWindow {
+	n := int((duration + bucketSize - 1) / bucketSize)
+	if n < 1 {
+		n = 1
+	}
+	return &timeWindow{buckets: make([]bucket, n)}
+}
+
+func (w *timeWindow) record(now time.Time, failed, slow bool) {
+	epoch := now.UnixNano() / int64(bucketSize)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	b.calls++
+	if failed {
+		b.failures++
+	}
+	if slow {
+		b.slowCalls++
+	}
+}
+
+func (w *timeWindow) stats(now time.Time) windowStats {
+	epoch := now.UnixNano() / int64(bucketSize)
+	var total windowStats
+	for _, b := range w.buckets {
+		if epoch-b.epoch >= int64(len(w.buckets)) {
+			continue
+		}
+		total.calls += b.calls
+		total.failures += b.failures
+		total.slowCalls += b.slowCalls
+	}
+	return total
+}
+
+func (w *timeWindow) reset() {
+	clear(w.buckets)
+}
@@ -0,0 +1,76 @@
+package graceful
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ListenAndServe(t *testing.T) {
+	var order []string
+	s := New(&http.Server{Addr: "127.0.0.1:0"}, time.Second, t.Logf)
+	s.BeforeShutdown(func() { order = append(order, "before") })
+	s.OnShutdown(func(ctx context.Context) {
+		assert.NoError(t, ctx.Err())
+		order = append(order, "on")
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe()
+	}()
+
+	// give the server time to install the signal handler and start listening
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	assert.Equal(t, []string{"before", "on"}, order)
+}
+
+func TestServer_ShutdownHooksHaveTheirOwnTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	s := New(hs, 50*time.Millisecond, t.Logf)
+	called := false
+	s.OnShutdown(func(ctx context.Context) {
+		assert.NoError(t, ctx.Err(), "the slow request does not use up the time of the hooks")
+		called = true
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- hs.Serve(ln)
+	}()
+	go func() {
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-started
+
+	assert.ErrorIs(t, s.shutdown(errs), context.DeadlineExceeded)
+	assert.True(t, called)
+}
+
+func TestServer_ListenAndServeError(t *testing.T) {
+	s := New(&http.Server{Addr: "invalid-address"}, time.Second, t.Logf)
+	assert.Error(t, s.ListenAndServe())
+}
@@ -31,6 +31,22 @@ func TestWithRequest(t *testing.T) {
 	ctx = WithRequest(context.Background(), req)
 	assert.NotEmpty(t, ctx.Value(requestIDKey).(string))
 	assert.Equal(t, "123", ctx.Value(correlationIDKey).(string))
+
+	req = buildRequest("abc", "")
+	ctx = WithRequest(context.Background(), req)
+	assert.Equal(t, "abc", ctx.Value(correlationIDKey).(string))
+}
+
+func TestRequestIDAndCorrelationID(t *testing.T) {
+	assert.Empty(t, RequestID(context.Background()))
+	assert.Empty(t, CorrelationID(context.Background()))
+
+	ctx := WithRequest(context.Background(), buildRequest("abc", "123"))
+	assert.Equal(t, "abc", RequestID(ctx))
+	assert.Equal(t, "123", CorrelationID(ctx))
+
+	ctx = WithCorrelationID(ctx, "456")
+	assert.Equal(t, "456", CorrelationID(ctx))
 }
 
 func Test_getCorrelationID(t *testing.T) {
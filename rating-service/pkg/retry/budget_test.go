@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(BudgetConfig{Percent: 50, MaxTokens: 2})
+	assert.Equal(t, 2.0, b.Tokens())
+
+	assert.True(t, b.withdraw())
+	assert.True(t, b.withdraw())
+	assert.False(t, b.withdraw())
+
+	// every call earns half a retry
+	b.deposit()
+	assert.False(t, b.withdraw())
+	b.deposit()
+	assert.True(t, b.withdraw())
+
+	// the bucket never holds more than MaxTokens
+	for range 10 {
+		b.deposit()
+	}
+	assert.Equal(t, 2.0, b.Tokens())
+}
+
+func TestBudget_MinRetriesPerSecond(t *testing.T) {
+	b := NewBudget(BudgetConfig{MinRetriesPerSecond: 100, MaxTokens: 1})
+	assert.True(t, b.withdraw())
+	assert.False(t, b.withdraw())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, b.withdraw())
+}
+
+func TestBudgetConfig_Validate(t *testing.T) {
+	assert.NoError(t, BudgetConfig{}.Validate())
+	assert.NoError(t, BudgetConfig{Percent: 20, MinRetriesPerSecond: 1, MaxTokens: 10}.Validate())
+	assert.Error(t, BudgetConfig{Percent: 120}.Validate())
+	assert.Error(t, BudgetConfig{MinRetriesPerSecond: -1}.Validate())
+}
+
+func TestWithRetry_BudgetExhausted(t *testing.T) {
+	logger, _ := log.NewForTest()
+
+	config := DefaultRetryConfig()
+	config.MaxAttempts = 5
+	config.InitialDelay = time.Millisecond
+	budget := NewBudget(BudgetConfig{Percent: 10, MaxTokens: 1})
+
+	callCount := 0
+	fn := func(ctx context.Context) error {
+		callCount++
+		return errors.New("persistent error")
+	}
+
+	err := WithRetry(context.Background(), config, fn, nil, logger, WithBudget(budget))
+
+	assert.ErrorIs(t, err, ErrBudgetExhausted)
+	assert.Equal(t, 2, callCount)
+}
@@ -8,9 +8,13 @@ import (
 	"time"
 
 	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/log"
+	"github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/tracing"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const instrumentationName = "github.com/berkaykrc/homerun-ratings-system/rating-service/pkg/retry"
+
 // RetryConfig defines the configuration for retry logic
 type RetryConfig struct {
 	MaxAttempts   int           `yaml:"max_attempts" json:"maxAttempts"`
@@ -18,6 +22,7 @@ type RetryConfig struct {
 	MaxDelay      time.Duration `yaml:"max_delay" json:"maxDelay"`
 	BackoffFactor float64       `yaml:"backoff_factor" json:"backoffFactor"`
 	Jitter        bool          `yaml:"jitter" json:"jitter"`
+	Budget        BudgetConfig  `yaml:"budget" json:"budget"`
 }
 
 // DefaultRetryConfig returns a default retry configuration
@@ -43,6 +48,53 @@ func DefaultRetryableError(err error) bool {
 	return true
 }
 
+// DelayOverride returns the delay requested by a failed attempt, for example through a Retry-After header,
+// and whether the error carries such a delay.
+type DelayOverride func(error) (time.Duration, bool)
+
+// Option customizes the behavior of WithRetry.
+type Option func(*options)
+
+// Hooks are callbacks invoked by WithRetry, for example to emit metrics. Any of them may be nil.
+type Hooks struct {
+	// OnRetry is called before waiting for the next attempt after the given attempt failed.
+	OnRetry func(ctx context.Context, attempt int, err error, delay time.Duration)
+	// OnGiveUp is called when WithRetry returns an error, with the number of attempts made.
+	OnGiveUp func(ctx context.Context, attempts int, err error)
+	// OnSuccess is called when an attempt succeeds, with the number of attempts made.
+	OnSuccess func(ctx context.Context, attempts int)
+}
+
+// options holds the optional settings of WithRetry.
+type options struct {
+	delayOverride DelayOverride
+	budget        *Budget
+	hooks         Hooks
+}
+
+// WithBudget makes WithRetry withdraw every retry from the given budget. A failed attempt is not retried
+// when the budget is exhausted, and ErrBudgetExhausted is returned.
+func WithBudget(b *Budget) Option {
+	return func(o *options) {
+		o.budget = b
+	}
+}
+
+// WithHooks registers callbacks that are invoked on retries, on success and when WithRetry gives up.
+func WithHooks(h Hooks) Option {
+	return func(o *options) {
+		o.hooks = h
+	}
+}
+
+// WithDelayOverride makes WithRetry wait for the delay returned by f instead of the computed backoff
+// whenever f reports one. The delay is capped at MaxDelay.
+func WithDelayOverride(f DelayOverride) Option {
+	return func(o *options) {
+		o.delayOverride = f
+	}
+}
+
 // Validate validates the retry configuration
 func (c RetryConfig) Validate() error {
 	return validation.ValidateStruct(&c,
@@ -51,52 +103,112 @@ func (c RetryConfig) Validate() error {
 		validation.Field(&c.MaxDelay, validation.Required, validation.Min(time.Millisecond)),
 		validation.Field(&c.BackoffFactor, validation.Required, validation.Min(1.0)),
 		validation.Field(&c.Jitter),
+		validation.Field(&c.Budget),
 	)
 }
 
 // WithRetry executes a function with retry logic
-func WithRetry(ctx context.Context, config RetryConfig, fn RetryableFunc, isRetryable IsRetryableError, logger log.Logger) error {
+func WithRetry(ctx context.Context, config RetryConfig, fn RetryableFunc, isRetryable IsRetryableError, logger log.Logger, opts ...Option) error {
 	if isRetryable == nil {
 		isRetryable = DefaultRetryableError
 	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.budget != nil {
+		o.budget.deposit()
+	}
 
 	var lastErr error
 
 	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
 		// Try to execute the function
-		err := fn(ctx)
+		err := executeAttempt(ctx, attempt, fn)
 		if err == nil {
 			if attempt > 1 {
 				logger.With(ctx, "attempt", attempt).Info("Function succeeded after retry")
 			}
+			if o.hooks.OnSuccess != nil {
+				o.hooks.OnSuccess(ctx, attempt)
+			}
 			return nil
 		}
 
 		lastErr = err
 
+		// If this is the last attempt, don't retry
 		if attempt == config.MaxAttempts {
 			logger.With(ctx, "attempt", attempt, "error", err).Error("All retry attempts exhausted")
 			break
 		}
 
+		// Check if the error is retryable
 		if !isRetryable(err) {
 			logger.With(ctx, "attempt", attempt, "error", err).Info("Error is not retryable, stopping")
-			break
+			return o.giveUp(ctx, attempt, fmt.Errorf("function failed after %d attempts: %w", attempt, err))
+		}
+
+		// Check if the retry budget allows another attempt
+		if o.budget != nil && !o.budget.withdraw() {
+			logger.With(ctx, "attempt", attempt, "error", err).Error("Retry budget exhausted, stopping")
+			return o.giveUp(ctx, attempt, fmt.Errorf("function failed after %d attempts: %w: %w", attempt, ErrBudgetExhausted, err))
 		}
 
+		// Calculate delay for next attempt
 		delay := calculateDelay(attempt, config)
+		if o.delayOverride != nil {
+			if override, ok := o.delayOverride(err); ok {
+				delay = max(min(override, config.MaxDelay), 0)
+			}
+		}
 
 		logger.With(ctx, "attempt", attempt, "error", err, "delay_ms", delay.Milliseconds()).
 			Infof("Function failed, retrying after delay")
+		if o.hooks.OnRetry != nil {
+			o.hooks.OnRetry(ctx, attempt, err, delay)
+		}
 
+		// Wait before retry (respecting context cancellation)
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("context cancelled during retry: %w", ctx.Err())
+			return o.giveUp(ctx, attempt, fmt.Errorf("context cancelled during retry: %w", ctx.Err()))
 		case <-time.After(delay):
+			// Continue to next attempt
+		}
+	}
+
+	return o.giveUp(ctx, config.MaxAttempts, fmt.Errorf("function failed after %d attempts: %w", config.MaxAttempts, lastErr))
+}
+
+// WithRetryValue executes a function that returns a value with retry logic and returns the value of the successful attempt.
+func WithRetryValue[T any](ctx context.Context, config RetryConfig, fn func(ctx context.Context) (T, error), isRetryable IsRetryableError, logger log.Logger, opts ...Option) (T, error) {
+	var result T
+	err := WithRetry(ctx, config, func(ctx context.Context) error {
+		value, err := fn(ctx)
+		if err == nil {
+			result = value
 		}
+		return err
+	}, isRetryable, logger, opts...)
+	return result, err
+}
+
+// giveUp invokes the OnGiveUp hook and returns err.
+func (o options) giveUp(ctx context.Context, attempts int, err error) error {
+	if o.hooks.OnGiveUp != nil {
+		o.hooks.OnGiveUp(ctx, attempts, err)
 	}
+	return err
+}
 
-	return fmt.Errorf("function failed after %d attempts: %w", config.MaxAttempts, lastErr)
+// executeAttempt runs a single attempt of fn inside its own span.
+func executeAttempt(ctx context.Context, attempt int, fn RetryableFunc) error {
+	ctx, span := tracing.Tracer(instrumentationName).Start(ctx, "retry.attempt")
+	span.SetAttributes(attribute.Int("retry.attempt", attempt))
+	err := fn(ctx)
+	tracing.End(span, err)
+	return err
 }
 
 // calculateDelay calculates the delay for the next retry attempt